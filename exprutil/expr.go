@@ -0,0 +1,723 @@
+package exprutil
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 表达式示例: amount > 100 && level == "vip"
+// 支持 算术 + - * / %、比较 == != < <= > >=、逻辑 && || ! and or not、
+// in / not in、函数调用、a.b.c和a[0]形式的路径访问
+// 不存在的路径返回nil 数字统一为float64
+
+var (
+	NotBoolResultError = errors.New("expression result is not bool")
+)
+
+type tokenType int
+
+const (
+	eofToken tokenType = iota
+	numberToken
+	stringToken
+	identToken
+	opToken
+)
+
+type token struct {
+	typ tokenType
+	val string
+	pos int
+}
+
+// Program 编译后的表达式 并发安全
+type Program struct {
+	expr string
+	root node
+}
+
+// Compile 编译表达式
+func Compile(expr string) (*Program, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{
+		tokens: tokens,
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.typ != eofToken {
+		return nil, fmt.Errorf("unexpected token %q at %d", t.val, t.pos)
+	}
+	return &Program{
+		expr: expr,
+		root: root,
+	}, nil
+}
+
+func (p *Program) String() string {
+	return p.expr
+}
+
+// Eval 执行表达式
+func (p *Program) Eval(env map[string]any) (any, error) {
+	return p.root.eval(env)
+}
+
+// EvalBool 执行表达式 结果必须为bool
+func (p *Program) EvalBool(env map[string]any) (bool, error) {
+	ret, err := p.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := ret.(bool)
+	if !ok {
+		return false, NotBoolResultError
+	}
+	return b, nil
+}
+
+func lex(expr string) ([]token, error) {
+	tokens := make([]token, 0, 16)
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{typ: numberToken, val: string(runes[start:i]), pos: start})
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, token{typ: identToken, val: string(runes[start:i]), pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			for ; i < len(runes) && runes[i] != c; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						sb.WriteRune('\n')
+					case 't':
+						sb.WriteRune('\t')
+					default:
+						sb.WriteRune(runes[i])
+					}
+					continue
+				}
+				sb.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			tokens = append(tokens, token{typ: stringToken, val: sb.String(), pos: start})
+		default:
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					tokens = append(tokens, token{typ: opToken, val: two, pos: i})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("+-*/%<>!()[],.", c) {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+			tokens = append(tokens, token{typ: opToken, val: string(c), pos: i})
+			i++
+		}
+	}
+	return append(tokens, token{typ: eofToken, pos: len(runes)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != eofToken {
+		p.pos++
+	}
+	return t
+}
+
+// isOp 当前token是否为指定运算符或关键字
+func (p *parser) isOp(ops ...string) bool {
+	t := p.peek()
+	if t.typ != opToken && t.typ != identToken {
+		return false
+	}
+	for _, op := range ops {
+		if t.val == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	t := p.next()
+	if t.typ != opToken || t.val != op {
+		return fmt.Errorf("expect %q at %d", op, t.pos)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||", "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{or: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&", "and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.isOp("!", "not") {
+		p.next()
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{n: n}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.isOp("==", "!=", "<", "<=", ">", ">=", "in"):
+		op := p.next().val
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: op, left: left, right: right}, nil
+	case p.isOp("not"):
+		// not in
+		p.next()
+		if !p.isOp("in") {
+			return nil, fmt.Errorf("expect \"in\" at %d", p.peek().pos)
+		}
+		p.next()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{n: &binaryNode{op: "in", left: left, right: right}}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().typ == opToken && p.isOp("+", "-") {
+		op := p.next().val
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().typ == opToken && p.isOp("*", "/", "%") {
+		op := p.next().val
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.peek().typ == opToken && p.isOp("-") {
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: "-", left: &constNode{val: float64(0)}, right: n}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.peek().typ == opToken && p.peek().val == ".":
+			p.next()
+			t := p.next()
+			if t.typ != identToken {
+				return nil, fmt.Errorf("expect field name at %d", t.pos)
+			}
+			n = &indexNode{target: n, index: &constNode{val: t.val}}
+		case p.peek().typ == opToken && p.peek().val == "[":
+			p.next()
+			index, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect("]"); err != nil {
+				return nil, err
+			}
+			n = &indexNode{target: n, index: index}
+		default:
+			return n, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.typ {
+	case numberToken:
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.val, t.pos)
+		}
+		return &constNode{val: f}, nil
+	case stringToken:
+		return &constNode{val: t.val}, nil
+	case identToken:
+		switch t.val {
+		case "true":
+			return &constNode{val: true}, nil
+		case "false":
+			return &constNode{val: false}, nil
+		case "nil", "null":
+			return &constNode{val: nil}, nil
+		}
+		if p.peek().typ == opToken && p.peek().val == "(" {
+			return p.parseCall(t)
+		}
+		return &identNode{name: t.val}, nil
+	case opToken:
+		switch t.val {
+		case "(":
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			items, err := p.parseList("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{items: items}, nil
+		}
+	}
+	if t.typ == eofToken {
+		return nil, errors.New("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected token %q at %d", t.val, t.pos)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := funcs[name.val]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s at %d", name.val, name.pos)
+	}
+	p.next()
+	args, err := p.parseList(")")
+	if err != nil {
+		return nil, err
+	}
+	return &callNode{name: name.val, fn: fn, args: args}, nil
+}
+
+// parseList 解析逗号分隔的表达式直到end
+func (p *parser) parseList(end string) ([]node, error) {
+	ret := make([]node, 0, 4)
+	if p.peek().typ == opToken && p.peek().val == end {
+		p.next()
+		return ret, nil
+	}
+	for {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, n)
+		t := p.next()
+		if t.typ == opToken && t.val == end {
+			return ret, nil
+		}
+		if t.typ != opToken || t.val != "," {
+			return nil, fmt.Errorf("expect %q at %d", end, t.pos)
+		}
+	}
+}
+
+type node interface {
+	eval(env map[string]any) (any, error)
+}
+
+type constNode struct {
+	val any
+}
+
+func (n *constNode) eval(map[string]any) (any, error) {
+	return n.val, nil
+}
+
+type identNode struct {
+	name string
+}
+
+func (n *identNode) eval(env map[string]any) (any, error) {
+	return normalise(env[n.name]), nil
+}
+
+type listNode struct {
+	items []node
+}
+
+func (n *listNode) eval(env map[string]any) (any, error) {
+	ret := make([]any, 0, len(n.items))
+	for _, item := range n.items {
+		v, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, v)
+	}
+	return ret, nil
+}
+
+type indexNode struct {
+	target node
+	index  node
+}
+
+func (n *indexNode) eval(env map[string]any) (any, error) {
+	target, err := n.target.eval(env)
+	if err != nil || target == nil {
+		return nil, err
+	}
+	index, err := n.index.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	r := reflect.ValueOf(target)
+	switch r.Kind() {
+	case reflect.Map:
+		key, ok := index.(string)
+		if !ok || r.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("invalid map key: %v", index)
+		}
+		v := r.MapIndex(reflect.ValueOf(key).Convert(r.Type().Key()))
+		if !v.IsValid() {
+			return nil, nil
+		}
+		return normalise(v.Interface()), nil
+	case reflect.Slice, reflect.Array:
+		f, ok := index.(float64)
+		if !ok {
+			return nil, fmt.Errorf("invalid array index: %v", index)
+		}
+		i := int(f)
+		if i < 0 || i >= r.Len() {
+			return nil, nil
+		}
+		return normalise(r.Index(i).Interface()), nil
+	default:
+		return nil, fmt.Errorf("can not index %T", target)
+	}
+}
+
+type notNode struct {
+	n node
+}
+
+func (n *notNode) eval(env map[string]any) (any, error) {
+	v, err := n.n.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("operator not expect bool but got %T", v)
+	}
+	return !b, nil
+}
+
+type logicNode struct {
+	or          bool
+	left, right node
+}
+
+func (n *logicNode) eval(env map[string]any) (any, error) {
+	left, err := evalBool(n.left, env)
+	if err != nil {
+		return nil, err
+	}
+	// 短路
+	if left == n.or {
+		return left, nil
+	}
+	return evalBool(n.right, env)
+}
+
+func evalBool(n node, env map[string]any) (bool, error) {
+	v, err := n.eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("logic operator expect bool but got %T", v)
+	}
+	return b, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(env map[string]any) (any, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		return in(left, right)
+	case "<", "<=", ">", ">=":
+		c, err := compare(left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	}
+	if n.op == "+" {
+		if ls, ok := left.(string); ok {
+			if rs, ok := right.(string); ok {
+				return ls + rs, nil
+			}
+		}
+	}
+	lf, lok := left.(float64)
+	rf, rok := right.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s expect numbers but got %T and %T", n.op, left, right)
+	}
+	switch n.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return lf / rf, nil
+	default:
+		if int64(rf) == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return float64(int64(lf) % int64(rf)), nil
+	}
+}
+
+type callNode struct {
+	name string
+	fn   func([]any) (any, error)
+	args []node
+}
+
+func (n *callNode) eval(env map[string]any) (any, error) {
+	args := make([]any, 0, len(n.args))
+	for _, arg := range n.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	ret, err := n.fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return ret, nil
+}
+
+// normalise 数字统一转为float64
+func normalise(v any) any {
+	switch t := v.(type) {
+	case nil, string, bool, float64:
+		return v
+	case int:
+		return float64(t)
+	case int64:
+		return float64(t)
+	case int32:
+		return float64(t)
+	case float32:
+		return float64(t)
+	}
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(r.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(r.Uint())
+	case reflect.Float32, reflect.Float64:
+		return r.Float()
+	case reflect.String:
+		return r.String()
+	case reflect.Bool:
+		return r.Bool()
+	}
+	return v
+}
+
+func equal(left, right any) bool {
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+	switch l := left.(type) {
+	case float64, string, bool:
+		return l == right
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func compare(left, right any) (int, error) {
+	switch l := left.(type) {
+	case float64:
+		if r, ok := right.(float64); ok {
+			switch {
+			case l < r:
+				return -1, nil
+			case l > r:
+				return 1, nil
+			default:
+				return 0, nil
+			}
+		}
+	case string:
+		if r, ok := right.(string); ok {
+			return strings.Compare(l, r), nil
+		}
+	}
+	return 0, fmt.Errorf("can not compare %T with %T", left, right)
+}
+
+// in 数组包含元素、map包含key、字符串包含子串
+func in(item, collection any) (bool, error) {
+	if collection == nil {
+		return false, nil
+	}
+	if s, ok := collection.(string); ok {
+		sub, ok := item.(string)
+		if !ok {
+			return false, fmt.Errorf("operator in expect string but got %T", item)
+		}
+		return strings.Contains(s, sub), nil
+	}
+	r := reflect.ValueOf(collection)
+	switch r.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < r.Len(); i++ {
+			if equal(item, normalise(r.Index(i).Interface())) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case reflect.Map:
+		key, ok := item.(string)
+		if !ok || r.Type().Key().Kind() != reflect.String {
+			return false, nil
+		}
+		return r.MapIndex(reflect.ValueOf(key).Convert(r.Type().Key())).IsValid(), nil
+	default:
+		return false, fmt.Errorf("operator in not support %T", collection)
+	}
+}
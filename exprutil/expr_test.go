@@ -0,0 +1,162 @@
+package exprutil
+
+import (
+	"errors"
+	"testing"
+)
+
+func newTestEnv() map[string]any {
+	return map[string]any{
+		"amount": 200,
+		"price":  int64(3),
+		"rate":   float32(0.5),
+		"level":  "vip",
+		"flag":   true,
+		"user": map[string]any{
+			"name": "bob",
+			"age":  30,
+			"tags": []string{"a", "b"},
+		},
+		"scores": []int{1, 2, 3},
+		"empty":  nil,
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expr   string
+		expect any
+	}{
+		// 算术优先级
+		{`1 + 2 * 3`, float64(7)},
+		{`(1 + 2) * 3`, float64(9)},
+		{`10 - 4 - 3`, float64(3)},
+		{`2 * 3 % 4`, float64(2)},
+		{`-2 * 3`, float64(-6)},
+		{`- -2`, float64(2)},
+		{`amount / 8 + price`, float64(28)},
+		{`rate * 4`, float64(2)},
+		{`"a" + "b"`, "ab"},
+		// 比较和逻辑优先级
+		{`1 + 1 == 2`, true},
+		{`amount > 100 && level == "vip"`, true},
+		{`false || true && false`, false},
+		{`(false || true) && false`, false},
+		{`true || false && false`, true},
+		{`amount > 100 and not flag or level == "vip"`, true},
+		// !的优先级低于比较 !a == b等价于!(a == b)
+		{`!amount > 300`, true},
+		{`!flag == false`, true},
+		{`!(flag == false)`, true},
+		{`!!flag`, true},
+		{`not not flag`, true},
+		{`!flag || flag`, true},
+		// 路径和下标
+		{`user.name`, "bob"},
+		{`user["age"] >= 30`, true},
+		{`user.tags[1]`, "b"},
+		{`scores[0] + scores[2]`, float64(4)},
+		// in
+		{`"a" in user.tags`, true},
+		{`"c" not in user.tags`, true},
+		{`2 in scores`, true},
+		{`"name" in user`, true},
+		{`"ip" in level`, true},
+		{`level in ["vip", "svip"]`, true},
+		{`"a" in missing`, false},
+		// 不存在的字段为nil
+		{`missing`, nil},
+		{`missing == nil`, true},
+		{`empty == null`, true},
+		{`user.missing.deep == nil`, true},
+		{`scores[10] == nil`, true},
+		{`missing != 1`, true},
+		{`missing == false`, false},
+		// 短路时不计算右侧
+		{`false && missing > 1`, false},
+		{`true || missing > 1`, true},
+		// 函数
+		{`len(user.tags) == 2`, true},
+		{`upper(level)`, "VIP"},
+		{`max(1, amount, 3)`, float64(200)},
+		{`num("1.5") + 1`, 2.5},
+		{`str(amount)`, "200"},
+		{`matches(level, "^v")`, true},
+	}
+	env := newTestEnv()
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			program, err := Compile(test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := program.Eval(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.expect {
+				t.Fatalf("expect %v(%T) but got %v(%T)", test.expect, test.expect, got, got)
+			}
+		})
+	}
+}
+
+func TestEvalError(t *testing.T) {
+	tests := []string{
+		// 类型错误
+		`level > 1`,
+		`amount + "a"`,
+		`missing > 1`,
+		`missing + 1`,
+		`!amount`,
+		`amount && true`,
+		`!flag || amount`,
+		`1 / 0`,
+		`1 % 0`,
+		`1 in amount`,
+		`1 in level`,
+		`upper(amount)`,
+		`len(amount)`,
+		`matches(level, "(")`,
+	}
+	env := newTestEnv()
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			program, err := Compile(expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := program.Eval(env); err == nil {
+				t.Fatalf("expect error but got %v", got)
+			}
+		})
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	for _, expr := range []string{``, `amount >`, `(1 + 2`, `unknown(1)`, `"abc`, `a ? b`, `a.`, `a[1`, `1 2`, `not`, `a not 1`} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := Compile(expr); err == nil {
+				t.Fatal("expect compile error")
+			}
+		})
+	}
+}
+
+func TestEvalBool(t *testing.T) {
+	program, err := Compile(`amount + 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = program.EvalBool(newTestEnv()); !errors.Is(err, NotBoolResultError) {
+		t.Fatalf("expect NotBoolResultError but got %v", err)
+	}
+	program, err = Compile(`amount > 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := program.EvalBool(newTestEnv())
+	if err != nil || !b {
+		t.Fatalf("expect true but got %v %v", b, err)
+	}
+}
@@ -0,0 +1,164 @@
+package exprutil
+
+import (
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zsf-utils/strutil"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// funcs 内置函数
+var funcs = map[string]func([]any) (any, error){
+	"len":        lenFunc,
+	"lower":      stringFunc(strings.ToLower),
+	"upper":      stringFunc(strings.ToUpper),
+	"trim":       stringFunc(strings.TrimSpace),
+	"contains":   stringPredicate(strings.Contains),
+	"startsWith": stringPredicate(strings.HasPrefix),
+	"endsWith":   stringPredicate(strings.HasSuffix),
+	"matches":    matchesFunc,
+	"abs":        numberFunc(math.Abs),
+	"floor":      numberFunc(math.Floor),
+	"ceil":       numberFunc(math.Ceil),
+	"min":        minMaxFunc(true),
+	"max":        minMaxFunc(false),
+	"str":        strFunc,
+	"num":        numFunc,
+}
+
+func checkArgs(args []any, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("expect %d args but got %d", n, len(args))
+	}
+	return nil
+}
+
+func lenFunc(args []any) (any, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return float64(0), nil
+	}
+	if s, ok := args[0].(string); ok {
+		return float64(len([]rune(s))), nil
+	}
+	r := reflect.ValueOf(args[0])
+	switch r.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(r.Len()), nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", args[0])
+	}
+}
+
+func stringFunc(fn func(string) string) func([]any) (any, error) {
+	return func(args []any) (any, error) {
+		if err := checkArgs(args, 1); err != nil {
+			return nil, err
+		}
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("expect string but got %T", args[0])
+		}
+		return fn(s), nil
+	}
+}
+
+func stringPredicate(fn func(string, string) bool) func([]any) (any, error) {
+	return func(args []any) (any, error) {
+		if err := checkArgs(args, 2); err != nil {
+			return nil, err
+		}
+		s, ok1 := args[0].(string)
+		sub, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("expect strings but got %T and %T", args[0], args[1])
+		}
+		return fn(s, sub), nil
+	}
+}
+
+func matchesFunc(args []any) (any, error) {
+	if err := checkArgs(args, 2); err != nil {
+		return nil, err
+	}
+	s, ok1 := args[0].(string)
+	pattern, ok2 := args[1].(string)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("expect strings but got %T and %T", args[0], args[1])
+	}
+	re, err := strutil.CompileRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(s), nil
+}
+
+func numberFunc(fn func(float64) float64) func([]any) (any, error) {
+	return func(args []any) (any, error) {
+		if err := checkArgs(args, 1); err != nil {
+			return nil, err
+		}
+		f, ok := args[0].(float64)
+		if !ok {
+			return nil, fmt.Errorf("expect number but got %T", args[0])
+		}
+		return fn(f), nil
+	}
+}
+
+func minMaxFunc(min bool) func([]any) (any, error) {
+	return func(args []any) (any, error) {
+		if len(args) == 0 {
+			return nil, errors.New("expect at least 1 arg")
+		}
+		var ret float64
+		for i, arg := range args {
+			f, ok := arg.(float64)
+			if !ok {
+				return nil, fmt.Errorf("expect number but got %T", arg)
+			}
+			if i == 0 || (min && f < ret) || (!min && f > ret) {
+				ret = f
+			}
+		}
+		return ret, nil
+	}
+}
+
+func strFunc(args []any) (any, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return nil, err
+	}
+	switch t := args[0].(type) {
+	case nil:
+		return "", nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	default:
+		return fmt.Sprint(t), nil
+	}
+}
+
+func numFunc(args []any) (any, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return nil, err
+	}
+	switch t := args[0].(type) {
+	case float64:
+		return t, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(t), 64)
+	case bool:
+		if t {
+			return float64(1), nil
+		}
+		return float64(0), nil
+	default:
+		return nil, fmt.Errorf("can not convert %T to number", t)
+	}
+}
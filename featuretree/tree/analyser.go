@@ -2,6 +2,7 @@ package tree
 
 import (
 	"errors"
+	"sync"
 	"time"
 )
 
@@ -67,6 +68,10 @@ func (t *leafAnalyser) getFeatureResult(featureKey string, ctx *FeatureAnalyseCo
 	}
 	featureType := t.leaf.FeatureType
 	fetcher, _ := GetFetcher(featureType)
+	batchFetcher, ok := fetcher.(BatchFeatureFetcher)
+	if ok {
+		return t.batchGetFeatureResult(batchFetcher, featureKey, ctx)
+	}
 	ret, err := fetcher.Execute(ctx)
 	if err != nil {
 		return nil, err
@@ -75,11 +80,62 @@ func (t *leafAnalyser) getFeatureResult(featureKey string, ctx *FeatureAnalyseCo
 	return ret, nil
 }
 
+// batchGetFeatureResult 一次获取树中同类型且未缓存的所有特征
+func (t *leafAnalyser) batchGetFeatureResult(fetcher BatchFeatureFetcher, featureKey string, ctx *FeatureAnalyseContext) (any, error) {
+	featureKeys := []string{featureKey}
+	if ctx.FeatureTree != nil {
+		featureKeys = collectUncachedFeatureKeys(ctx.FeatureTree.Node, t.leaf.FeatureType, ctx, featureKeys)
+	}
+	ret, err := fetcher.BatchExecute(ctx, featureKeys)
+	if err != nil {
+		return nil, err
+	}
+	for key, val := range ret {
+		ctx.PutFeatureResult2Cache(key, val)
+	}
+	result := ret[featureKey]
+	ctx.PutFeatureResult2Cache(featureKey, result)
+	return result, nil
+}
+
+// collectUncachedFeatureKeys 收集特征类型相同且未缓存的特征key
+func collectUncachedFeatureKeys(node *Node, featureType string, ctx *FeatureAnalyseContext, keys []string) []string {
+	if node == nil {
+		return keys
+	}
+	if node.IsLeave() {
+		if node.Leaf.FeatureType != featureType || node.Leaf.KeyNameInfo == nil {
+			return keys
+		}
+		key := node.Leaf.KeyNameInfo.FeatureKey
+		if _, ok := ctx.GetFeatureResultByKey(key); ok {
+			return keys
+		}
+		for _, k := range keys {
+			if k == key {
+				return keys
+			}
+		}
+		return append(keys, key)
+	}
+	for _, n := range node.And {
+		keys = collectUncachedFeatureKeys(n, featureType, ctx, keys)
+	}
+	for _, n := range node.Or {
+		keys = collectUncachedFeatureKeys(n, featureType, ctx, keys)
+	}
+	return keys
+}
+
 // NodeAnalyser 节点解析器
 type NodeAnalyser struct {
 	FeatureAnalyseContext *FeatureAnalyseContext
 	missResult            []*AnalyseDetail
 	metrics               []*SingleFeatureAnalyseMetrics
+	// metricsMu 超时返回时解析协程可能仍在写入metrics
+	metricsMu sync.Mutex
+	// nodeObserver 节点解析完成回调 用于统计覆盖率
+	nodeObserver func(*Node, bool, error)
 }
 
 // Analyse 解析整棵树
@@ -96,10 +152,8 @@ func (t *NodeAnalyser) AnalyseWithInterceptors(interceptors []Interceptor) Analy
 	if !hasTimeout {
 		return t.doAnalyse(interceptors)
 	}
-	resultChan := make(chan AnalyseResult)
-	defer func() {
-		close(resultChan)
-	}()
+	// 超时返回后解析仍可能完成 带缓冲避免写入阻塞或写入已关闭的channel
+	resultChan := make(chan AnalyseResult, 1)
 	go func() {
 		resultChan <- t.doAnalyse(interceptors)
 	}()
@@ -112,7 +166,7 @@ func (t *NodeAnalyser) AnalyseWithInterceptors(interceptors []Interceptor) Analy
 		if ok {
 			return &TimeoutMetricsResult{
 				AnalyseMetrics: &AnalyseMetrics{
-					LeafAnalyseMetrics: t.metrics,
+					LeafAnalyseMetrics: t.metricsSnapshot(),
 					Duration:           time.Since(beginTime),
 				},
 				Timeout: deadline.Sub(beginTime),
@@ -121,7 +175,7 @@ func (t *NodeAnalyser) AnalyseWithInterceptors(interceptors []Interceptor) Analy
 			//context中断
 			return &CancelMetricsResult{
 				AnalyseMetrics: &AnalyseMetrics{
-					LeafAnalyseMetrics: t.metrics,
+					LeafAnalyseMetrics: t.metricsSnapshot(),
 					Duration:           time.Since(beginTime),
 				},
 			}
@@ -169,6 +223,14 @@ func (t *NodeAnalyser) doAnalyse(interceptors []Interceptor) AnalyseResult {
 }
 
 func (t *NodeAnalyser) analyseNode(fctx *FeatureAnalyseContext, node *Node) (bool, error) {
+	ret, err := t.doAnalyseNode(fctx, node)
+	if t.nodeObserver != nil {
+		t.nodeObserver(node, ret, err)
+	}
+	return ret, err
+}
+
+func (t *NodeAnalyser) doAnalyseNode(fctx *FeatureAnalyseContext, node *Node) (bool, error) {
 	if fctx.Ctx != nil && fctx.Ctx.Err() != nil {
 		return false, fctx.Ctx.Err()
 	}
@@ -177,6 +239,8 @@ func (t *NodeAnalyser) analyseNode(fctx *FeatureAnalyseContext, node *Node) (boo
 	if node.IsLeave() {
 		//统计耗时
 		defer func() {
+			t.metricsMu.Lock()
+			defer t.metricsMu.Unlock()
 			t.metrics = append(t.metrics, &SingleFeatureAnalyseMetrics{
 				FeatureKey:  node.Leaf.KeyNameInfo.FeatureKey,
 				FeatureType: node.Leaf.FeatureType,
@@ -225,6 +289,15 @@ func (t *NodeAnalyser) analyseNode(fctx *FeatureAnalyseContext, node *Node) (boo
 	return false, errors.New("node config error")
 }
 
+// metricsSnapshot 超时或取消时已完成的叶子节点统计
+func (t *NodeAnalyser) metricsSnapshot() []*SingleFeatureAnalyseMetrics {
+	t.metricsMu.Lock()
+	defer t.metricsMu.Unlock()
+	ret := make([]*SingleFeatureAnalyseMetrics, len(t.metrics))
+	copy(ret, t.metrics)
+	return ret
+}
+
 // InitTreeAnalyser 初始化叶子节点解析器
 func InitTreeAnalyser(featureAnalyseContext *FeatureAnalyseContext) *NodeAnalyser {
 	return &NodeAnalyser{
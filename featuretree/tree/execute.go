@@ -19,6 +19,13 @@ type FeatureFetcher interface {
 	Execute(ctx *FeatureAnalyseContext) (any, error)
 }
 
+// BatchFeatureFetcher 支持一次获取多个特征的fetcher
+type BatchFeatureFetcher interface {
+	FeatureFetcher
+	// BatchExecute 批量获取特征 返回特征key和特征值
+	BatchExecute(ctx *FeatureAnalyseContext, featureKeys []string) (map[string]any, error)
+}
+
 // RegisterFetcher 注册fetcher
 func RegisterFetcher(fetcher FeatureFetcher) {
 	if fetcher.GetFeatureType() != "" {
@@ -51,7 +51,7 @@ func (m *ScriptFetcher) Execute(ctx *FeatureAnalyseContext) (any, error) {
 	if err != nil {
 		return nil, err
 	}
-	return GetDefaultScriptExecutor().Execute(proto, luautil.Copy2Bindings(ctx.OriginMessage))
+	return GetDefaultScriptExecutor().ExecuteCtx(ctx.Ctx, proto, luautil.Copy2Bindings(ctx.OriginMessage))
 }
 
 func init() {
@@ -244,7 +244,7 @@ func (m *ScriptFeatureHandler) Handle(value *StringValue, _ *Operator, userValue
 	if err != nil {
 		return false, err
 	}
-	return GetDefaultScriptExecutor().ExecuteAndReturnBool(proto, bindings)
+	return GetDefaultScriptExecutor().ExecuteAndReturnBoolCtx(ctx.Ctx, proto, bindings)
 }
 
 func NewScriptFeatureHandler() FeatureHandler {
@@ -0,0 +1,261 @@
+package tree
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// HarnessCase 特征树测试用例
+type HarnessCase struct {
+	// Name 用例名称
+	Name string `json:"name"`
+	// Message 输入报文
+	Message map[string]any `json:"message"`
+	// ExpectSuccess 期待结果
+	ExpectSuccess bool `json:"expectSuccess"`
+	// ExpectMissKeys 期待未命中的特征key 为nil不校验
+	ExpectMissKeys []string `json:"expectMissKeys"`
+}
+
+// HarnessCaseResult 单个用例执行结果
+type HarnessCaseResult struct {
+	Name     string   `json:"name"`
+	Pass     bool     `json:"pass"`
+	Success  bool     `json:"success"`
+	MissKeys []string `json:"missKeys"`
+	// Desc 特征树解释结果
+	Desc string `json:"desc"`
+	// Reason 用例不通过的原因
+	Reason string `json:"reason,omitempty"`
+}
+
+// HarnessCoverage 单个节点覆盖情况
+type HarnessCoverage struct {
+	// Path 节点路径 如and[0].or[1]
+	Path string `json:"path"`
+	// Leaf 叶子节点描述 非叶子节点为空
+	Leaf string `json:"leaf,omitempty"`
+	// Evaluated 是否被执行过
+	Evaluated bool `json:"evaluated"`
+	// CoveredTrue 是否有结果为true的用例
+	CoveredTrue bool `json:"coveredTrue"`
+	// CoveredFalse 是否有结果为false的用例
+	CoveredFalse bool `json:"coveredFalse"`
+}
+
+// HarnessReport 测试报告
+type HarnessReport struct {
+	TreeId string               `json:"treeId"`
+	Total  int                  `json:"total"`
+	Passed int                  `json:"passed"`
+	Failed int                  `json:"failed"`
+	Cases  []*HarnessCaseResult `json:"cases"`
+	// Coverage 节点覆盖情况
+	Coverage []*HarnessCoverage `json:"coverage"`
+	// LeafCoverage 被执行过的叶子节点比例
+	LeafCoverage float64 `json:"leafCoverage"`
+	// BranchCoverage 节点true和false结果的覆盖比例
+	BranchCoverage float64 `json:"branchCoverage"`
+}
+
+// AllPassed 用例是否全部通过
+func (r *HarnessReport) AllPassed() bool {
+	return r.Failed == 0
+}
+
+// UncoveredNodes 未完全覆盖的节点
+func (r *HarnessReport) UncoveredNodes() []*HarnessCoverage {
+	ret := make([]*HarnessCoverage, 0)
+	for _, c := range r.Coverage {
+		if !c.CoveredTrue || !c.CoveredFalse {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// Json 输出json格式报告 便于CI解析
+func (r *HarnessReport) Json() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// LoadFeatureTreeFile 从PlainInfo的json文件加载特征树
+func LoadFeatureTreeFile(id, path string) (*FeatureTree, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var info PlainInfo
+	err = json.Unmarshal(content, &info)
+	if err != nil {
+		return nil, err
+	}
+	return BuildFeatureTree(id, &info)
+}
+
+// LoadHarnessCaseFile 加载json数组格式的用例文件
+func LoadHarnessCaseFile(path string) ([]*HarnessCase, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cases []*HarnessCase
+	err = json.Unmarshal(content, &cases)
+	if err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+// RunHarnessFiles 加载特征树和用例文件并执行
+func RunHarnessFiles(treeId, treePath, casePath string) (*HarnessReport, error) {
+	tree, err := LoadFeatureTreeFile(treeId, treePath)
+	if err != nil {
+		return nil, err
+	}
+	cases, err := LoadHarnessCaseFile(casePath)
+	if err != nil {
+		return nil, err
+	}
+	return RunHarness(tree, cases)
+}
+
+// RunHarness 执行用例并统计覆盖率
+func RunHarness(tree *FeatureTree, cases []*HarnessCase) (*HarnessReport, error) {
+	if tree == nil || tree.Node == nil {
+		return nil, errors.New("nil tree")
+	}
+	coverage := make(map[*Node]*HarnessCoverage)
+	order := make([]*Node, 0)
+	collectCoverage(tree.Node, "root", coverage, &order)
+	report := &HarnessReport{
+		TreeId: tree.Id,
+		Total:  len(cases),
+		Cases:  make([]*HarnessCaseResult, 0, len(cases)),
+	}
+	observer := func(node *Node, ret bool, err error) {
+		c, ok := coverage[node]
+		if !ok || err != nil {
+			return
+		}
+		c.Evaluated = true
+		if ret {
+			c.CoveredTrue = true
+		} else {
+			c.CoveredFalse = true
+		}
+	}
+	for i, c := range cases {
+		result := runHarnessCase(tree, c, observer)
+		if result.Name == "" {
+			result.Name = "case" + strconv.Itoa(i)
+		}
+		if result.Pass {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Cases = append(report.Cases, result)
+	}
+	var (
+		leaves, evaluatedLeaves, outcomes int
+	)
+	for _, node := range order {
+		c := coverage[node]
+		report.Coverage = append(report.Coverage, c)
+		if node.IsLeave() {
+			leaves++
+			if c.Evaluated {
+				evaluatedLeaves++
+			}
+		}
+		if c.CoveredTrue {
+			outcomes++
+		}
+		if c.CoveredFalse {
+			outcomes++
+		}
+	}
+	if leaves > 0 {
+		report.LeafCoverage = float64(evaluatedLeaves) / float64(leaves)
+	}
+	if len(order) > 0 {
+		report.BranchCoverage = float64(outcomes) / float64(2*len(order))
+	}
+	return report, nil
+}
+
+func runHarnessCase(tree *FeatureTree, c *HarnessCase, observer func(*Node, bool, error)) *HarnessCaseResult {
+	ctx := BuildFeatureAnalyseContext(tree, c.Message, context.Background())
+	analyser := InitTreeAnalyser(ctx)
+	analyser.nodeObserver = observer
+	result := analyser.Analyse()
+	ret := &HarnessCaseResult{
+		Name:     c.Name,
+		Success:  result.IsSuccess(),
+		MissKeys: []string{},
+		Desc:     result.GetMissResultDetailDesc(),
+	}
+	if errResult, ok := result.(*ErrMetricsResult); ok {
+		ret.Reason = "execute err: " + fmt.Sprint(errResult.Err)
+		return ret
+	}
+	if failResult, ok := result.(*FailMetricsResult); ok {
+		for _, detail := range failResult.AnalyseDetails {
+			ret.MissKeys = append(ret.MissKeys, detail.FeatureKey)
+		}
+	}
+	if ret.Success != c.ExpectSuccess {
+		ret.Reason = fmt.Sprintf("expect success: %v, actual: %v", c.ExpectSuccess, ret.Success)
+		return ret
+	}
+	if c.ExpectMissKeys != nil && !sameStringSet(c.ExpectMissKeys, ret.MissKeys) {
+		ret.Reason = fmt.Sprintf("expect miss keys: %v, actual: %v", c.ExpectMissKeys, ret.MissKeys)
+		return ret
+	}
+	ret.Pass = true
+	return ret
+}
+
+func collectCoverage(node *Node, path string, coverage map[*Node]*HarnessCoverage, order *[]*Node) {
+	if node == nil {
+		return
+	}
+	c := &HarnessCoverage{
+		Path: path,
+	}
+	if node.IsLeave() {
+		c.Leaf = describeLeaf(node.Leaf)
+	}
+	coverage[node] = c
+	*order = append(*order, node)
+	for i, n := range node.And {
+		collectCoverage(n, fmt.Sprintf("%s.and[%d]", path, i), coverage, order)
+	}
+	for i, n := range node.Or {
+		collectCoverage(n, fmt.Sprintf("%s.or[%d]", path, i), coverage, order)
+	}
+}
+
+func sameStringSet(s1, s2 []string) bool {
+	a := make([]string, 0, len(s1))
+	a = append(a, s1...)
+	b := make([]string, 0, len(s2))
+	b = append(b, s2...)
+	sort.Strings(a)
+	sort.Strings(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package tree
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunHarness(t *testing.T) {
+	featureTree := mustBuildTree(t, "h", and(numberInfo("x", "gt", "1"), stringInfo("s", "eq", "a")))
+	report, err := RunHarness(featureTree, []*HarnessCase{
+		{Name: "match", Message: map[string]any{"x": 2, "s": "a"}, ExpectSuccess: true},
+		{Name: "miss x", Message: map[string]any{"x": 0, "s": "a"}, ExpectMissKeys: []string{"x"}},
+		// 期待结果错误的用例
+		{Name: "wrong expect", Message: map[string]any{"x": 0, "s": "a"}, ExpectSuccess: true},
+		{Name: "wrong miss keys", Message: map[string]any{"x": 0, "s": "a"}, ExpectMissKeys: []string{"s"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 4 || report.Passed != 2 || report.Failed != 2 || report.AllPassed() {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	for _, c := range report.Cases {
+		wantPass := !strings.HasPrefix(c.Name, "wrong")
+		if c.Pass != wantPass {
+			t.Fatalf("case %s: expect pass %v but got %v", c.Name, wantPass, c.Pass)
+		}
+		if !c.Pass && c.Reason == "" {
+			t.Fatalf("case %s: expect failure reason", c.Name)
+		}
+	}
+	// x不满足时and短路 s只覆盖了true
+	if report.LeafCoverage != 1 {
+		t.Fatalf("expect all leaves evaluated but got %v", report.LeafCoverage)
+	}
+	uncovered := report.UncoveredNodes()
+	if len(uncovered) != 1 || uncovered[0].Path != "root.and[1]" {
+		t.Fatalf("unexpected uncovered nodes %v", uncovered)
+	}
+}
+
+func TestRunHarnessFiles(t *testing.T) {
+	dir := t.TempDir()
+	treePath := filepath.Join(dir, "tree.json")
+	casePath := filepath.Join(dir, "cases.json")
+	if err := os.WriteFile(treePath, []byte(`{"featureType":"message","featureKey":"x","dataType":"number","operator":"eq","value":"1"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(casePath, []byte(`[{"name":"bad","message":{"x":2},"expectSuccess":true}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := RunHarnessFiles("f", treePath, casePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.AllPassed() || report.Cases[0].Pass {
+		t.Fatal("expect failing case reported")
+	}
+}
@@ -0,0 +1,125 @@
+package tree
+
+import (
+	"context"
+	"errors"
+	"github.com/LeeZXin/zsf-utils/collections/hashmap"
+	"github.com/LeeZXin/zsf-utils/httputil"
+	"github.com/LeeZXin/zsf-utils/luautil"
+	"net/http"
+	"strings"
+)
+
+// HttpEndpoint 远程特征接口配置
+type HttpEndpoint struct {
+	// Url 请求地址
+	Url string `json:"url"`
+	// Method GET或POST 默认POST 请求体为原始报文
+	Method string `json:"method"`
+	// Header 请求头
+	Header map[string]string `json:"header"`
+	// JsonPath 特征在返回json中的路径 如data.score 为空则返回整个结果
+	JsonPath string `json:"jsonPath"`
+}
+
+// HttpFetcher 通过http接口获取特征
+// 同一个请求地址的多个特征key只会请求一次
+type HttpFetcher struct {
+	featureType string
+	client      *http.Client
+	endpoints   *hashmap.ConcurrentHashMap[string, HttpEndpoint]
+}
+
+func NewHttpFetcher(featureType string, client *http.Client) (*HttpFetcher, error) {
+	if featureType == "" {
+		return nil, errors.New("empty featureType")
+	}
+	if client == nil {
+		client = httputil.NewHttpClient()
+	}
+	return &HttpFetcher{
+		featureType: featureType,
+		client:      client,
+		endpoints:   hashmap.NewConcurrentHashMap[string, HttpEndpoint](),
+	}, nil
+}
+
+// RegisterEndpoint 注册特征key对应的接口
+func (f *HttpFetcher) RegisterEndpoint(featureKey string, endpoint HttpEndpoint) {
+	f.endpoints.Put(featureKey, endpoint)
+}
+
+// RemoveEndpoint 移除特征key对应的接口
+func (f *HttpFetcher) RemoveEndpoint(featureKey string) {
+	f.endpoints.Remove(featureKey)
+}
+
+func (f *HttpFetcher) GetFeatureType() string {
+	return f.featureType
+}
+
+func (f *HttpFetcher) Execute(ctx *FeatureAnalyseContext) (any, error) {
+	node := ctx.GetCurrentNode()
+	if node == nil || !node.IsLeave() {
+		return nil, errors.New("wrong node")
+	}
+	featureKey := node.Leaf.KeyNameInfo.FeatureKey
+	ret, err := f.BatchExecute(ctx, []string{featureKey})
+	if err != nil {
+		return nil, err
+	}
+	return ret[featureKey], nil
+}
+
+func (f *HttpFetcher) BatchExecute(ctx *FeatureAnalyseContext, featureKeys []string) (map[string]any, error) {
+	// 按请求地址分组 相同地址只请求一次
+	groups := make(map[string][]string, len(featureKeys))
+	requestKeys := make([]string, 0, len(featureKeys))
+	for _, featureKey := range featureKeys {
+		endpoint, ok := f.endpoints.Get(featureKey)
+		if !ok {
+			return nil, errors.New("unknown http feature: " + featureKey)
+		}
+		requestKey := strings.ToUpper(endpoint.Method) + " " + endpoint.Url
+		if _, ok = groups[requestKey]; !ok {
+			requestKeys = append(requestKeys, requestKey)
+		}
+		groups[requestKey] = append(groups[requestKey], featureKey)
+	}
+	ret := make(map[string]any, len(featureKeys))
+	for _, requestKey := range requestKeys {
+		keys := groups[requestKey]
+		endpoint, _ := f.endpoints.Get(keys[0])
+		resp, err := f.doRequest(ctx, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			e, _ := f.endpoints.Get(key)
+			if e.JsonPath == "" {
+				ret[key] = map[string]any(resp)
+			} else {
+				ret[key], _ = resp.Get(e.JsonPath)
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (f *HttpFetcher) doRequest(ctx *FeatureAnalyseContext, endpoint HttpEndpoint) (luautil.Bindings, error) {
+	resp := luautil.NewBindings()
+	reqCtx := ctx.Ctx
+	if reqCtx == nil {
+		reqCtx = context.Background()
+	}
+	var err error
+	if strings.ToUpper(endpoint.Method) == http.MethodGet {
+		err = httputil.Get(reqCtx, f.client, endpoint.Url, endpoint.Header, &resp)
+	} else {
+		err = httputil.Post(reqCtx, f.client, endpoint.Url, endpoint.Header, ctx.OriginMessage, &resp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
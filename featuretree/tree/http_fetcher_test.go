@@ -0,0 +1,171 @@
+package tree
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestServer(calls *int32, delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+		var req map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{
+				"score": 80,
+				"level": "vip",
+				"uid":   req["uid"],
+			},
+		})
+	}))
+}
+
+func TestHttpFetcher(t *testing.T) {
+	var calls int32
+	server := newTestServer(&calls, 0)
+	defer server.Close()
+	fetcher, err := NewHttpFetcher("testHttp", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher.RegisterEndpoint("score", HttpEndpoint{Url: server.URL, JsonPath: "data.score"})
+	fetcher.RegisterEndpoint("level", HttpEndpoint{Url: server.URL, JsonPath: "data.level"})
+	RegisterFetcher(fetcher)
+	defer RemoveFetcher("testHttp")
+	featureTree, err := BuildFeatureTree("test", &PlainInfo{
+		And: []*PlainInfo{
+			{FeatureType: "testHttp", FeatureKey: "score", DataType: "number", Operator: "gt", Value: "60"},
+			{FeatureType: "testHttp", FeatureKey: "level", DataType: "string", Operator: "eq", Value: "vip"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := BuildFeatureAnalyseContext(featureTree, map[string]any{"uid": "1"}, context.Background())
+	result := InitTreeAnalyser(ctx).Analyse()
+	if !result.IsSuccess() {
+		t.Fatal(result.GetMissResultDetailDesc())
+	}
+	// 同一地址的两个特征只请求一次
+	if calls != 1 {
+		t.Fatalf("expect 1 call, got %d", calls)
+	}
+}
+
+func TestCachedFetcher(t *testing.T) {
+	var calls int32
+	server := newTestServer(&calls, 0)
+	defer server.Close()
+	httpFetcher, _ := NewHttpFetcher("testCachedHttp", nil)
+	httpFetcher.RegisterEndpoint("uid", HttpEndpoint{Url: server.URL, JsonPath: "data.uid"})
+	if _, err := NewCachedFetcher(httpFetcher, time.Minute, 100); err == nil {
+		t.Fatal("expect error without keyFields")
+	}
+	fetcher, err := NewCachedFetcher(httpFetcher, time.Minute, 100, "uid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterFetcher(fetcher)
+	defer RemoveFetcher("testCachedHttp")
+	featureTree, err := BuildFeatureTree("test", &PlainInfo{
+		FeatureType: "testCachedHttp", FeatureKey: "uid", DataType: "string", Operator: "eq", Value: "1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, uid := range []string{"1", "1", "2"} {
+		ctx := BuildFeatureAnalyseContext(featureTree, map[string]any{"uid": uid}, context.Background())
+		result := InitTreeAnalyser(ctx).Analyse()
+		if result.IsSuccess() != (uid == "1") {
+			t.Fatalf("unexpected result for uid %s: %s", uid, result.GetMissResultDetailDesc())
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("expect 2 calls, got %d", calls)
+	}
+}
+
+func TestTimeoutFetcher(t *testing.T) {
+	var calls int32
+	server := newTestServer(&calls, 200*time.Millisecond)
+	defer server.Close()
+	httpFetcher, _ := NewHttpFetcher("testTimeoutHttp", nil)
+	httpFetcher.RegisterEndpoint("score", HttpEndpoint{Url: server.URL, JsonPath: "data.score"})
+	fetcher, err := NewTimeoutFetcherWithFallback(httpFetcher, 20*time.Millisecond, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterFetcher(fetcher)
+	defer RemoveFetcher("testTimeoutHttp")
+	featureTree, err := BuildFeatureTree("test", &PlainInfo{
+		FeatureType: "testTimeoutHttp", FeatureKey: "score", DataType: "number", Operator: "eq", Value: "100",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := BuildFeatureAnalyseContext(featureTree, nil, context.Background())
+	result := InitTreeAnalyser(ctx).Analyse()
+	if !result.IsSuccess() {
+		t.Fatal(result.GetMissResultDetailDesc())
+	}
+}
+
+// funcFetcher 测试用fetcher
+type funcFetcher struct {
+	featureType string
+	fn          func(*FeatureAnalyseContext) (any, error)
+}
+
+func (f *funcFetcher) GetFeatureType() string {
+	return f.featureType
+}
+
+func (f *funcFetcher) Execute(ctx *FeatureAnalyseContext) (any, error) {
+	return f.fn(ctx)
+}
+
+func TestTimeoutFetcherIgnoringCtx(t *testing.T) {
+	slow := &funcFetcher{
+		featureType: "slow",
+		fn: func(*FeatureAnalyseContext) (any, error) {
+			time.Sleep(200 * time.Millisecond)
+			return 1, nil
+		},
+	}
+	fetcher, err := NewTimeoutFetcherWithFallback(slow, 20*time.Millisecond, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	ret, err := fetcher.Execute(BuildFeatureAnalyseContext(nil, nil, context.Background()))
+	if err != nil || ret != 100 {
+		t.Fatalf("expect fallback but got %v %v", ret, err)
+	}
+	// 不响应ctx的fetcher也在超时后立即返回
+	if cost := time.Since(start); cost > 100*time.Millisecond {
+		t.Fatalf("expect return on deadline but cost %v", cost)
+	}
+	// 超时前完成的结果不使用降级值
+	fast := &funcFetcher{
+		featureType: "fast",
+		fn: func(*FeatureAnalyseContext) (any, error) {
+			time.Sleep(10 * time.Millisecond)
+			return 1, nil
+		},
+	}
+	fetcher, err = NewTimeoutFetcherWithFallback(fast, time.Second, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret, err = fetcher.Execute(BuildFeatureAnalyseContext(nil, nil, nil)); err != nil || ret != 1 {
+		t.Fatalf("expect 1 but got %v %v", ret, err)
+	}
+}
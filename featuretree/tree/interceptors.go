@@ -0,0 +1,313 @@
+package tree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zsf-utils/collections/hashmap"
+	"github.com/LeeZXin/zsf-utils/luautil"
+	"github.com/LeeZXin/zsf-utils/randutil"
+	"github.com/LeeZXin/zsf-utils/sentinelutil"
+	sentinel "github.com/alibaba/sentinel-golang/api"
+	"github.com/alibaba/sentinel-golang/core/base"
+	"github.com/alibaba/sentinel-golang/core/circuitbreaker"
+	"github.com/alibaba/sentinel-golang/core/flow"
+	"github.com/spf13/cast"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	BlockedError = errors.New("feature tree analyse blocked")
+)
+
+// TreeMetrics 单棵特征树的执行统计
+type TreeMetrics struct {
+	Total         int64
+	Success       int64
+	Fail          int64
+	Err           int64
+	Timeout       int64
+	Cancel        int64
+	TotalDuration time.Duration
+	MaxDuration   time.Duration
+}
+
+// AvgDuration 平均耗时
+func (m TreeMetrics) AvgDuration() time.Duration {
+	if m.Total == 0 {
+		return 0
+	}
+	return m.TotalDuration / time.Duration(m.Total)
+}
+
+// MetricsRecorder 按树id聚合耗时和结果
+type MetricsRecorder struct {
+	mu      sync.Mutex
+	metrics map[string]*TreeMetrics
+}
+
+func NewMetricsRecorder() *MetricsRecorder {
+	return &MetricsRecorder{
+		metrics: make(map[string]*TreeMetrics, 8),
+	}
+}
+
+// Interceptor 记录耗时和结果的拦截器
+func (r *MetricsRecorder) Interceptor() Interceptor {
+	return func(ctx *FeatureAnalyseContext, invoker Invoker) AnalyseResult {
+		beginTime := time.Now()
+		result := invoker(ctx)
+		r.record(getTreeId(ctx), result, time.Since(beginTime))
+		return result
+	}
+}
+
+func (r *MetricsRecorder) record(treeId string, result AnalyseResult, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.metrics[treeId]
+	if !ok {
+		m = &TreeMetrics{}
+		r.metrics[treeId] = m
+	}
+	m.Total++
+	m.TotalDuration += duration
+	if duration > m.MaxDuration {
+		m.MaxDuration = duration
+	}
+	if r, ok := result.(*ErrMetricsResult); ok {
+		// 拦截器中超时和取消表现为ErrMetricsResult 按错误类型区分
+		switch {
+		case errors.Is(r.Err, context.DeadlineExceeded):
+			m.Timeout++
+		case errors.Is(r.Err, context.Canceled):
+			m.Cancel++
+		default:
+			m.Err++
+		}
+	} else if result.IsSuccess() {
+		m.Success++
+	} else {
+		m.Fail++
+	}
+}
+
+// Stats 统计快照
+func (r *MetricsRecorder) Stats() map[string]TreeMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ret := make(map[string]TreeMetrics, len(r.metrics))
+	for k, v := range r.metrics {
+		ret[k] = *v
+	}
+	return ret
+}
+
+// Reset 清空统计
+func (r *MetricsRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = make(map[string]*TreeMetrics, 8)
+}
+
+type cachedResult struct {
+	result   AnalyseResult
+	expireAt time.Time
+}
+
+// NewResultCacheInterceptor 结果缓存拦截器
+// 缓存key为树id加报文指定字段的hash 只缓存成功和失败的结果 命中时返回结果的拷贝
+// fields不能为空 避免不同报文共用结果
+func NewResultCacheInterceptor(ttl time.Duration, maxSize int, fields ...string) (Interceptor, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("empty fields")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("wrong ttl")
+	}
+	if maxSize <= 0 {
+		return nil, errors.New("maxSize should greater than 0")
+	}
+	cache := hashmap.NewConcurrentLinkedHashMapWithLimitSize[string, cachedResult](true, maxSize)
+	return func(ctx *FeatureAnalyseContext, invoker Invoker) AnalyseResult {
+		key := resultCacheKey(ctx, fields)
+		cached, ok := cache.Get(key)
+		if ok {
+			if time.Now().Before(cached.expireAt) {
+				return copyAnalyseResult(cached.result)
+			}
+			cache.Remove(key)
+		}
+		result := invoker(ctx)
+		if _, ok := result.(*ErrMetricsResult); !ok {
+			cache.Put(key, cachedResult{
+				result:   copyAnalyseResult(result),
+				expireAt: time.Now().Add(ttl),
+			})
+		}
+		return result
+	}, nil
+}
+
+// copyAnalyseResult 拷贝成功和失败的结果 其他类型原样返回
+func copyAnalyseResult(result AnalyseResult) AnalyseResult {
+	switch r := result.(type) {
+	case *SuccessMetricsResult:
+		return &SuccessMetricsResult{
+			AnalyseMetrics: copyAnalyseMetrics(r.AnalyseMetrics),
+		}
+	case *FailMetricsResult:
+		var details []*AnalyseDetail
+		if r.AnalyseDetails != nil {
+			details = make([]*AnalyseDetail, 0, len(r.AnalyseDetails))
+			for _, detail := range r.AnalyseDetails {
+				if detail != nil {
+					d := *detail
+					detail = &d
+				}
+				details = append(details, detail)
+			}
+		}
+		return &FailMetricsResult{
+			AnalyseMetrics: copyAnalyseMetrics(r.AnalyseMetrics),
+			AnalyseDetails: details,
+		}
+	}
+	return result
+}
+
+func copyAnalyseMetrics(metrics *AnalyseMetrics) *AnalyseMetrics {
+	if metrics == nil {
+		return nil
+	}
+	ret := &AnalyseMetrics{
+		Duration: metrics.Duration,
+	}
+	if metrics.LeafAnalyseMetrics != nil {
+		ret.LeafAnalyseMetrics = make([]*SingleFeatureAnalyseMetrics, 0, len(metrics.LeafAnalyseMetrics))
+		for _, m := range metrics.LeafAnalyseMetrics {
+			if m != nil {
+				c := *m
+				m = &c
+			}
+			ret.LeafAnalyseMetrics = append(ret.LeafAnalyseMetrics, m)
+		}
+	}
+	return ret
+}
+
+func resultCacheKey(ctx *FeatureAnalyseContext, fields []string) string {
+	message := luautil.Bindings(ctx.OriginMessage)
+	h := fnv.New64a()
+	for _, field := range fields {
+		val, _ := message.Get(field)
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+		h.Write([]byte(cast.ToString(val)))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%s#%x", getTreeId(ctx), h.Sum64())
+}
+
+// SentinelRuleOpts 单棵树的sentinel规则配置
+type SentinelRuleOpts struct {
+	// Qps 每秒最大请求数 为0不限流
+	Qps float64
+	// ErrorRatio 统计周期内错误比例超过时熔断 为0不熔断
+	ErrorRatio float64
+	// MinRequestAmount 触发熔断的最小请求数
+	MinRequestAmount uint64
+	// StatIntervalMs 熔断统计周期 为0使用1000
+	StatIntervalMs uint32
+	// RetryTimeoutMs 熔断后快速失败的时间 为0使用1000
+	RetryTimeoutMs uint32
+}
+
+// SentinelInterceptor sentinel限流熔断拦截器 资源名为resourcePrefix加树id
+// sentinel由sentinelutil初始化 规则通过sentinelutil构建
+type SentinelInterceptor struct {
+	resourcePrefix string
+}
+
+func NewSentinelInterceptor(resourcePrefix string) *SentinelInterceptor {
+	return &SentinelInterceptor{
+		resourcePrefix: resourcePrefix,
+	}
+}
+
+// LoadTreeRules 加载树的限流和熔断规则 只替换该树资源的规则
+func (s *SentinelInterceptor) LoadTreeRules(treeId string, opts SentinelRuleOpts) error {
+	resource := s.resourcePrefix + treeId
+	flowRules := make([]*flow.Rule, 0, 1)
+	if opts.Qps > 0 {
+		flowRules = append(flowRules, sentinelutil.QpsRule(resource, opts.Qps))
+	}
+	if _, err := flow.LoadRulesOfResource(resource, flowRules); err != nil {
+		return err
+	}
+	breakerRules := make([]*circuitbreaker.Rule, 0, 1)
+	if opts.ErrorRatio > 0 {
+		statIntervalMs, retryTimeoutMs := opts.StatIntervalMs, opts.RetryTimeoutMs
+		if statIntervalMs == 0 {
+			statIntervalMs = 1000
+		}
+		if retryTimeoutMs == 0 {
+			retryTimeoutMs = 1000
+		}
+		breakerRules = append(breakerRules, sentinelutil.ErrorRatioRule(resource, retryTimeoutMs, opts.MinRequestAmount, statIntervalMs, opts.ErrorRatio))
+	}
+	_, err := circuitbreaker.LoadRulesOfResource(resource, breakerRules)
+	return err
+}
+
+// Interceptor 被限流或熔断时返回BlockedError 解析出错时计入熔断的错误统计
+func (s *SentinelInterceptor) Interceptor() Interceptor {
+	return func(ctx *FeatureAnalyseContext, invoker Invoker) AnalyseResult {
+		entry, blockErr := sentinel.Entry(s.resourcePrefix+getTreeId(ctx), sentinel.WithTrafficType(base.Inbound))
+		if blockErr != nil {
+			return &ErrMetricsResult{
+				AnalyseMetrics: &AnalyseMetrics{
+					LeafAnalyseMetrics: []*SingleFeatureAnalyseMetrics{},
+				},
+				Err: fmt.Errorf("%w: %s", BlockedError, blockErr.Error()),
+			}
+		}
+		defer entry.Exit()
+		result := invoker(ctx)
+		// 拦截器中超时和取消同样表现为ErrMetricsResult
+		if r, ok := result.(*ErrMetricsResult); ok {
+			sentinel.TraceError(entry, r.Err)
+		}
+		return result
+	}
+}
+
+// NewSampleLogInterceptor 按比例采样打印失败结果的解释信息
+// 只打印树id和解释信息 不打印报文 printer为nil时使用标准库log
+func NewSampleLogInterceptor(sampleRate float64, printer func(string)) Interceptor {
+	if printer == nil {
+		printer = func(s string) {
+			log.Println(s)
+		}
+	}
+	return func(ctx *FeatureAnalyseContext, invoker Invoker) AnalyseResult {
+		result := invoker(ctx)
+		if !result.IsSuccess() && sampleRate > 0 && randutil.Float64() < sampleRate {
+			printer(fmt.Sprintf("feature tree: %s analyse failed: %s",
+				getTreeId(ctx),
+				result.GetMissResultDetailDesc(),
+			))
+		}
+		return result
+	}
+}
+
+func getTreeId(ctx *FeatureAnalyseContext) string {
+	if ctx.FeatureTree == nil {
+		return ""
+	}
+	return ctx.FeatureTree.Id
+}
@@ -0,0 +1,139 @@
+package tree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func analyseWith(t *testing.T, info *PlainInfo, message map[string]any, ctx context.Context, interceptors ...Interceptor) AnalyseResult {
+	featureTree := mustBuildTree(t, "t", info)
+	return InitTreeAnalyser(BuildFeatureAnalyseContext(featureTree, message, ctx)).AnalyseWithInterceptors(interceptors)
+}
+
+// countingInterceptor 统计实际执行解析的次数
+func countingInterceptor(calls *int32) Interceptor {
+	return func(ctx *FeatureAnalyseContext, invoker Invoker) AnalyseResult {
+		atomic.AddInt32(calls, 1)
+		return invoker(ctx)
+	}
+}
+
+func TestMetricsRecorder(t *testing.T) {
+	RegisterFetcher(&funcFetcher{
+		featureType: "metricsErr",
+		fn: func(*FeatureAnalyseContext) (any, error) {
+			return nil, errors.New("fetch failed")
+		},
+	})
+	defer RemoveFetcher("metricsErr")
+	RegisterFetcher(&funcFetcher{
+		featureType: "metricsWait",
+		fn: func(ctx *FeatureAnalyseContext) (any, error) {
+			<-ctx.Ctx.Done()
+			return nil, ctx.Ctx.Err()
+		},
+	})
+	defer RemoveFetcher("metricsWait")
+	recorder := NewMetricsRecorder()
+	interceptor := recorder.Interceptor()
+	info := numberInfo("x", "eq", "1")
+	analyseWith(t, info, map[string]any{"x": 1}, context.Background(), interceptor)
+	analyseWith(t, info, map[string]any{"x": 2}, context.Background(), interceptor)
+	analyseWith(t, &PlainInfo{FeatureType: "metricsErr", FeatureKey: "y", DataType: "number", Operator: "eq", Value: "1"},
+		nil, context.Background(), interceptor)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	analyseWith(t, info, map[string]any{"x": 1}, cancelled, interceptor)
+	timeoutCtx, timeoutCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer timeoutCancel()
+	result := analyseWith(t, &PlainInfo{FeatureType: "metricsWait", FeatureKey: "y", DataType: "number", Operator: "eq", Value: "1"},
+		nil, timeoutCtx, interceptor)
+	if _, ok := result.(*TimeoutMetricsResult); !ok {
+		t.Fatalf("expect timeout result but got %T", result)
+	}
+	// 超时后拦截器在解析协程中记录
+	deadline := time.Now().Add(time.Second)
+	for recorder.Stats()["t"].Total < 5 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	stats := recorder.Stats()["t"]
+	if stats.Total != 5 || stats.Success != 1 || stats.Fail != 1 || stats.Err != 1 || stats.Cancel != 1 || stats.Timeout != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestResultCacheInterceptor(t *testing.T) {
+	if _, err := NewResultCacheInterceptor(time.Minute, 10); err == nil {
+		t.Fatal("expect empty fields error")
+	}
+	cache, err := NewResultCacheInterceptor(50*time.Millisecond, 10, "uid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int32
+	counting := countingInterceptor(&calls)
+	info := numberInfo("x", "eq", "1")
+	first := analyseWith(t, info, map[string]any{"uid": "1", "x": 1}, context.Background(), cache, counting)
+	second := analyseWith(t, info, map[string]any{"uid": "1", "x": 1}, context.Background(), cache, counting)
+	if calls != 1 || !second.IsSuccess() {
+		t.Fatalf("expect cache hit but got %d calls", calls)
+	}
+	// 命中时返回拷贝 修改不影响缓存
+	hit := second.(*SuccessMetricsResult)
+	if hit == first || hit.AnalyseMetrics == first.(*SuccessMetricsResult).AnalyseMetrics {
+		t.Fatal("expect copied result")
+	}
+	hit.AnalyseMetrics.LeafAnalyseMetrics = nil
+	third := analyseWith(t, info, map[string]any{"uid": "1", "x": 1}, context.Background(), cache, counting)
+	if len(third.(*SuccessMetricsResult).AnalyseMetrics.LeafAnalyseMetrics) == 0 {
+		t.Fatal("cached result modified")
+	}
+	// 不同报文字段不共用结果
+	analyseWith(t, info, map[string]any{"uid": "2", "x": 1}, context.Background(), cache, counting)
+	if calls != 2 {
+		t.Fatalf("expect cache miss but got %d calls", calls)
+	}
+	time.Sleep(80 * time.Millisecond)
+	analyseWith(t, info, map[string]any{"uid": "1", "x": 1}, context.Background(), cache, counting)
+	if calls != 3 {
+		t.Fatalf("expect expired but got %d calls", calls)
+	}
+}
+
+func TestSampleLogInterceptor(t *testing.T) {
+	info := numberInfo("x", "eq", "1")
+	var printed []string
+	printer := func(s string) {
+		printed = append(printed, s)
+	}
+	analyseWith(t, info, map[string]any{"x": 1}, context.Background(), NewSampleLogInterceptor(1, printer))
+	analyseWith(t, info, map[string]any{"x": 2}, context.Background(), NewSampleLogInterceptor(0, printer))
+	if len(printed) != 0 {
+		t.Fatalf("expect nothing printed but got %v", printed)
+	}
+	analyseWith(t, info, map[string]any{"x": 2}, context.Background(), NewSampleLogInterceptor(1, printer))
+	if len(printed) != 1 {
+		t.Fatalf("expect failure printed but got %v", printed)
+	}
+}
+
+func TestSentinelInterceptor(t *testing.T) {
+	// 资源名唯一 避免重复执行时共用统计窗口
+	interceptor := NewSentinelInterceptor(fmt.Sprintf("testSentinel%d#", time.Now().UnixNano()))
+	if err := interceptor.LoadTreeRules("t", SentinelRuleOpts{Qps: 1}); err != nil {
+		t.Fatal(err)
+	}
+	info := numberInfo("x", "eq", "1")
+	if result := analyseWith(t, info, map[string]any{"x": 1}, context.Background(), interceptor.Interceptor()); !result.IsSuccess() {
+		t.Fatal("expect first request passed")
+	}
+	result := analyseWith(t, info, map[string]any{"x": 1}, context.Background(), interceptor.Interceptor())
+	r, ok := result.(*ErrMetricsResult)
+	if !ok || !errors.Is(r.Err, BlockedError) {
+		t.Fatalf("expect blocked but got %v", result)
+	}
+}
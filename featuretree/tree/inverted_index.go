@@ -1,8 +1,8 @@
 package tree
 
 import (
-	"encoding/json"
 	"errors"
+	"fmt"
 	"sort"
 	"strings"
 )
@@ -26,16 +26,28 @@ type IndexFeatureTree struct {
 	Target      string
 }
 
+var (
+	// MaxDNFConjunctions 析取范式展开后合取式数量的默认上限
+	MaxDNFConjunctions = 1024
+
+	DNFOutOfLimitError = errors.New("dnf conjunctions out of limit")
+)
+
 // BuildInvertedIndexes 构建倒排索引
 func BuildInvertedIndexes(trees []*FeatureTree) ([]*InvertedIndex, error) {
+	return BuildInvertedIndexesWithLimit(trees, MaxDNFConjunctions)
+}
+
+// BuildInvertedIndexesWithLimit 构建倒排索引 限制单棵树展开后的合取式数量 limit小于等于0不限制
+func BuildInvertedIndexesWithLimit(trees []*FeatureTree, limit int) ([]*InvertedIndex, error) {
 	if trees == nil {
 		return []*InvertedIndex{}, nil
 	}
 	ft := make([]*IndexFeatureTree, 0, len(trees))
 	for _, featureTree := range trees {
-		dnf, err := parseDNFExpression(featureTree.Node)
+		dnf, err := parseDNFExpression(featureTree.Node, limit, true)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("tree %s: %w", featureTree.Id, err)
 		}
 		for _, leaves := range dnf {
 			ft = append(ft, buildIndexFeatureTree(leaves, featureTree.Id))
@@ -60,22 +72,19 @@ func doCreateIndex(trees []*IndexFeatureTree) []*InvertedIndex {
 			Indexes:     tm[t.Key],
 		})
 	}
+	// 输出顺序稳定
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Key < ret[j].Key
+	})
 	return ret
 }
 
 func buildIndexFeatureTree(leaves []*Leaf, target string) *IndexFeatureTree {
-	keyArr := make([]string, 0, len(leaves))
-	for _, leaf := range leaves {
-		m, _ := json.Marshal(leaf)
-		keyArr = append(keyArr, string(m))
-	}
-	sort.SliceStable(keyArr, func(i, j int) bool {
-		return strings.Compare(keyArr[i], keyArr[j]) > 0
-	})
+	leaves = normaliseConjunction(leaves)
 	return &IndexFeatureTree{
 		FeatureTree: buildAndFeatureTree(leaves),
 		IndexCount:  len(leaves),
-		Key:         strings.Join(keyArr, "#"),
+		Key:         conjunctionKey(leaves),
 		Target:      target,
 	}
 }
@@ -95,7 +104,8 @@ func buildAndFeatureTree(leaves []*Leaf) *FeatureTree {
 }
 
 // parseDNFExpression 析取范式转化
-func parseDNFExpression(node *Node) ([][]*Leaf, error) {
+// limit限制合取式数量 normalise为true时每一步都去重并吸收冗余合取式
+func parseDNFExpression(node *Node, limit int, normalise bool) ([][]*Leaf, error) {
 	if node == nil {
 		return nil, errors.New("nil node")
 	}
@@ -109,37 +119,49 @@ func parseDNFExpression(node *Node) ([][]*Leaf, error) {
 	)
 	if !checkEmpty(node.And) {
 		for _, n := range node.And {
-			dnf, err := parseDNFExpression(n)
+			dnf, err := parseDNFExpression(n, limit, normalise)
 			if err != nil {
 				return nil, err
 			}
 			if lls == nil {
 				lls = dnf
 			} else {
-				lls, err = crossJoin(lls, dnf)
+				lls, err = crossJoin(lls, dnf, limit)
 				if err != nil {
 					return nil, err
 				}
 			}
+			if normalise {
+				lls = normaliseDNF(lls)
+			}
 		}
 	} else if !checkEmpty(node.Or) {
 		lls = make([][]*Leaf, 0)
 		for _, n := range node.Or {
-			dnf, err := parseDNFExpression(n)
+			dnf, err := parseDNFExpression(n, limit, normalise)
 			if err != nil {
 				return nil, err
 			}
 			lls = append(lls, dnf...)
+			if normalise {
+				lls = normaliseDNF(lls)
+			}
+			if limit > 0 && len(lls) > limit {
+				return nil, fmt.Errorf("%w: %d > %d", DNFOutOfLimitError, len(lls), limit)
+			}
 		}
 	}
 	return lls, nil
 }
 
-// crossJoin 笛卡尔积
-func crossJoin(v [][]*Leaf, v1 [][]*Leaf) ([][]*Leaf, error) {
+// crossJoin 笛卡尔积 展开前校验数量 避免内存爆炸
+func crossJoin(v [][]*Leaf, v1 [][]*Leaf, limit int) ([][]*Leaf, error) {
 	if checkEmpty(v) || checkEmpty(v1) {
 		return nil, errors.New("empty leaf list")
 	}
+	if limit > 0 && len(v)*len(v1) > limit {
+		return nil, fmt.Errorf("%w: %d > %d", DNFOutOfLimitError, len(v)*len(v1), limit)
+	}
 	ret := make([][]*Leaf, 0, len(v)*len(v1))
 	for i := range v {
 		for i1 := range v1 {
@@ -152,6 +174,98 @@ func crossJoin(v [][]*Leaf, v1 [][]*Leaf) ([][]*Leaf, error) {
 	return ret, nil
 }
 
+// normaliseDNF 合取式内叶子去重排序 去掉重复合取式 并吸收冗余合取式 a or (a and b) = a
+func normaliseDNF(lls [][]*Leaf) [][]*Leaf {
+	type conjunction struct {
+		leaves       []*Leaf
+		fingerprints map[string]struct{}
+	}
+	conjunctions := make([]conjunction, 0, len(lls))
+	seen := make(map[string]struct{}, len(lls))
+	for _, leaves := range lls {
+		leaves = normaliseConjunction(leaves)
+		fingerprints := make(map[string]struct{}, len(leaves))
+		keyArr := make([]string, 0, len(leaves))
+		for _, leaf := range leaves {
+			fingerprint := leaf.Fingerprint()
+			fingerprints[fingerprint] = struct{}{}
+			keyArr = append(keyArr, fingerprint)
+		}
+		key := strings.Join(keyArr, "#")
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		conjunctions = append(conjunctions, conjunction{
+			leaves:       leaves,
+			fingerprints: fingerprints,
+		})
+	}
+	// 叶子少的在前 便于吸收
+	sort.SliceStable(conjunctions, func(i, j int) bool {
+		return len(conjunctions[i].leaves) < len(conjunctions[j].leaves)
+	})
+	kept := make([]conjunction, 0, len(conjunctions))
+	for _, c := range conjunctions {
+		absorbed := false
+		for _, k := range kept {
+			if len(k.leaves) >= len(c.leaves) {
+				// 数量相同且不重复则不可能是子集
+				break
+			}
+			subset := true
+			for fingerprint := range k.fingerprints {
+				if _, ok := c.fingerprints[fingerprint]; !ok {
+					subset = false
+					break
+				}
+			}
+			if subset {
+				absorbed = true
+				break
+			}
+		}
+		if !absorbed {
+			kept = append(kept, c)
+		}
+	}
+	ret := make([][]*Leaf, 0, len(kept))
+	for _, c := range kept {
+		ret = append(ret, c.leaves)
+	}
+	return ret
+}
+
+// normaliseConjunction 合取式内叶子按指纹去重排序
+func normaliseConjunction(leaves []*Leaf) []*Leaf {
+	fingerprints := make(map[*Leaf]string, len(leaves))
+	seen := make(map[string]struct{}, len(leaves))
+	ret := make([]*Leaf, 0, len(leaves))
+	for _, leaf := range leaves {
+		fingerprint := leaf.Fingerprint()
+		if _, ok := seen[fingerprint]; ok {
+			continue
+		}
+		seen[fingerprint] = struct{}{}
+		fingerprints[leaf] = fingerprint
+		ret = append(ret, leaf)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return fingerprints[ret[i]] < fingerprints[ret[j]]
+	})
+	return ret
+}
+
+// conjunctionKey 合取式标识 由叶子指纹组成
+func conjunctionKey(leaves []*Leaf) string {
+	keyArr := make([]string, 0, len(leaves))
+	for _, leaf := range leaves {
+		keyArr = append(keyArr, leaf.Fingerprint())
+	}
+	sort.Strings(keyArr)
+	return strings.Join(keyArr, "#")
+}
+
 func checkEmpty[T any](v []T) bool {
 	return v == nil || len(v) == 0
 }
@@ -0,0 +1,84 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestLeafFingerprint(t *testing.T) {
+	a := numberInfo("x", "eq", "1")
+	b := numberInfo("x", "eq", "1")
+	// 名称不参与指纹
+	b.FeatureName = "another name"
+	leaves := buildLeaves(a, b, numberInfo("x", "eq", "2"), stringInfo("x", "eq", "1"))
+	if leaves[0].Fingerprint() != leaves[1].Fingerprint() {
+		t.Fatal("expect equivalent leaves share fingerprint")
+	}
+	for _, other := range leaves[2:] {
+		if leaves[0].Fingerprint() == other.Fingerprint() {
+			t.Fatalf("expect different fingerprint for %s", leafIdentity(other))
+		}
+	}
+}
+
+func TestNormaliseDNF(t *testing.T) {
+	x1, s := numberInfo("x", "eq", "1"), stringInfo("s", "eq", "a")
+	tests := []struct {
+		name   string
+		info   *PlainInfo
+		expect int
+	}{
+		{"duplicate conjunctions", or(x1, numberInfo("x", "eq", "1")), 1},
+		{"absorbed conjunction", or(x1, and(numberInfo("x", "eq", "1"), s)), 1},
+		{"duplicate leaves in conjunction", and(x1, numberInfo("x", "eq", "1"), s), 1},
+		{"independent conjunctions", or(x1, s), 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dnf, err := parseDNFExpression(mustBuildTree(t, "n", test.info).Node, 0, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(dnf) != test.expect {
+				t.Fatalf("expect %d conjunctions but got %d", test.expect, len(dnf))
+			}
+		})
+	}
+	// 等价的合取式共用索引
+	indexes, err := BuildInvertedIndexes([]*FeatureTree{
+		mustBuildTree(t, "t1", and(x1, s)),
+		mustBuildTree(t, "t2", and(stringInfo("s", "eq", "a"), numberInfo("x", "eq", "1"))),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes) != 1 || len(indexes[0].Indexes) != 2 || indexes[0].IndexCount != 2 {
+		t.Fatalf("expect one shared index but got %v", indexes)
+	}
+}
+
+func TestDNFOutOfLimit(t *testing.T) {
+	// 每个or有两个分支 展开后为2^n个合取式
+	orGroups := func(n int) *PlainInfo {
+		groups := make([]*PlainInfo, 0, n)
+		for i := 0; i < n; i++ {
+			key := fmt.Sprintf("k%d", i)
+			groups = append(groups, or(numberInfo(key, "eq", "1"), numberInfo(key, "eq", "2")))
+		}
+		return and(groups...)
+	}
+	if _, err := BuildInvertedIndexes([]*FeatureTree{mustBuildTree(t, "big", orGroups(11))}); !errors.Is(err, DNFOutOfLimitError) {
+		t.Fatalf("expect DNFOutOfLimitError but got %v", err)
+	}
+	if _, err := BuildInvertedIndexesWithLimit([]*FeatureTree{mustBuildTree(t, "small", orGroups(3))}, 4); !errors.Is(err, DNFOutOfLimitError) {
+		t.Fatalf("expect DNFOutOfLimitError but got %v", err)
+	}
+	indexes, err := BuildInvertedIndexesWithLimit([]*FeatureTree{mustBuildTree(t, "small", orGroups(3))}, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes) != 8 {
+		t.Fatalf("expect 8 indexes but got %d", len(indexes))
+	}
+}
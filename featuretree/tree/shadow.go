@@ -0,0 +1,246 @@
+package tree
+
+import (
+	"context"
+	"github.com/LeeZXin/zsf-utils/executor"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ShadowRecord 单次影子对比记录
+type ShadowRecord struct {
+	// ActiveTreeId 生效树id
+	ActiveTreeId string
+	// ShadowTreeId 候选树id
+	ShadowTreeId string
+	// OriginMessage 原始报文
+	OriginMessage map[string]any
+	// ActiveResult 生效树结果
+	ActiveResult AnalyseResult
+	// ShadowResult 候选树结果
+	ShadowResult AnalyseResult
+	// Agree 结果是否一致
+	Agree bool
+	// Time 对比时间
+	Time time.Time
+}
+
+// ActiveDesc 生效树解释结果
+func (r *ShadowRecord) ActiveDesc() string {
+	return r.ActiveResult.GetMissResultDetailDesc()
+}
+
+// ShadowDesc 候选树解释结果
+func (r *ShadowRecord) ShadowDesc() string {
+	return r.ShadowResult.GetMissResultDetailDesc()
+}
+
+// ShadowSink 影子对比结果输出
+type ShadowSink interface {
+	// Record 每次对比都会调用 无论结果是否一致
+	Record(*ShadowRecord)
+}
+
+// ShadowSinkFunc 函数式sink
+type ShadowSinkFunc func(*ShadowRecord)
+
+func (f ShadowSinkFunc) Record(record *ShadowRecord) {
+	f(record)
+}
+
+// DefaultShadowTimeout 异步执行候选树的默认超时时间
+const DefaultShadowTimeout = 3 * time.Second
+
+// ShadowAnalyserOpts 影子解析配置
+type ShadowAnalyserOpts struct {
+	// Executor 为nil则同步执行候选树
+	Executor *executor.Executor
+	Sinks    []ShadowSink
+	// Timeout 异步执行候选树的超时时间 超时后释放线程池 为0使用DefaultShadowTimeout
+	Timeout time.Duration
+}
+
+// ShadowAnalyser 影子解析
+// 候选树复用生效树已获取的特征 只返回生效树结果
+type ShadowAnalyser struct {
+	// executor 为nil则同步执行候选树
+	executor *executor.Executor
+	sinks    []ShadowSink
+	timeout  time.Duration
+	// dropped 线程池饱和时丢弃的次数
+	dropped atomic.Int64
+}
+
+func NewShadowAnalyser(shadowExecutor *executor.Executor, sinks ...ShadowSink) *ShadowAnalyser {
+	return NewShadowAnalyserWithOpts(ShadowAnalyserOpts{
+		Executor: shadowExecutor,
+		Sinks:    sinks,
+	})
+}
+
+func NewShadowAnalyserWithOpts(opts ShadowAnalyserOpts) *ShadowAnalyser {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultShadowTimeout
+	}
+	return &ShadowAnalyser{
+		executor: opts.Executor,
+		sinks:    opts.Sinks,
+		timeout:  timeout,
+	}
+}
+
+// Analyse 解析生效树和候选树
+func (s *ShadowAnalyser) Analyse(ctx *FeatureAnalyseContext, shadowTrees ...*FeatureTree) AnalyseResult {
+	return s.AnalyseWithInterceptors(ctx, nil, shadowTrees...)
+}
+
+// AnalyseWithInterceptors 解析生效树和候选树 拦截器只作用于生效树
+func (s *ShadowAnalyser) AnalyseWithInterceptors(ctx *FeatureAnalyseContext, interceptors []Interceptor, shadowTrees ...*FeatureTree) AnalyseResult {
+	activeResult := InitTreeAnalyser(ctx).AnalyseWithInterceptors(interceptors)
+	if len(shadowTrees) == 0 {
+		return activeResult
+	}
+	// 超时或取消时生效树可能仍在执行 不做对比
+	switch activeResult.(type) {
+	case *TimeoutMetricsResult, *CancelMetricsResult:
+		return activeResult
+	}
+	// 拷贝特征缓存 避免异步执行时并发读写
+	featureCache := make(map[string]any, len(ctx.featureCache))
+	for k, v := range ctx.featureCache {
+		featureCache[k] = v
+	}
+	shadowFn := func(shadowCtx context.Context) {
+		for _, shadowTree := range shadowTrees {
+			if shadowTree == nil {
+				continue
+			}
+			s.analyseShadow(ctx, activeResult, shadowTree, featureCache, shadowCtx)
+		}
+	}
+	if s.executor == nil {
+		shadowFn(ctx.Ctx)
+	} else {
+		// 异步执行时请求ctx可能已结束 使用独立的超时ctx 避免卡住的fetcher一直占用线程池
+		err := s.executor.Execute(func() {
+			shadowCtx, cancel := context.WithTimeout(context.Background(), s.timeout)
+			defer cancel()
+			shadowFn(shadowCtx)
+		})
+		// 线程池饱和时丢弃 避免在请求链路上执行候选树
+		if err != nil {
+			s.dropped.Add(1)
+		}
+	}
+	return activeResult
+}
+
+// Dropped 线程池饱和时丢弃的影子解析次数
+func (s *ShadowAnalyser) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+func (s *ShadowAnalyser) analyseShadow(ctx *FeatureAnalyseContext, activeResult AnalyseResult, shadowTree *FeatureTree, featureCache map[string]any, shadowCtx context.Context) {
+	shadowAnalyseCtx := BuildFeatureAnalyseContext(shadowTree, ctx.OriginMessage, shadowCtx)
+	for k, v := range featureCache {
+		shadowAnalyseCtx.featureCache[k] = v
+	}
+	shadowResult := InitTreeAnalyser(shadowAnalyseCtx).Analyse()
+	record := &ShadowRecord{
+		ActiveTreeId:  getTreeId(ctx),
+		ShadowTreeId:  shadowTree.Id,
+		OriginMessage: ctx.OriginMessage,
+		ActiveResult:  activeResult,
+		ShadowResult:  shadowResult,
+		Agree:         activeResult.IsSuccess() == shadowResult.IsSuccess(),
+		Time:          time.Now(),
+	}
+	for _, sink := range s.sinks {
+		sink.Record(record)
+	}
+}
+
+// ShadowStats 影子对比统计
+type ShadowStats struct {
+	Total    int64
+	Disagree int64
+}
+
+// DisagreeRate 不一致率
+func (s ShadowStats) DisagreeRate() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Disagree) / float64(s.Total)
+}
+
+// ShadowStatsSink 按候选树id聚合不一致率 保留最近的不一致记录
+type ShadowStatsSink struct {
+	mu        sync.Mutex
+	stats     map[string]*ShadowStats
+	diffs     []*ShadowRecord
+	diffLimit int
+}
+
+func NewShadowStatsSink(diffLimit int) *ShadowStatsSink {
+	if diffLimit < 0 {
+		diffLimit = 0
+	}
+	return &ShadowStatsSink{
+		stats:     make(map[string]*ShadowStats, 8),
+		diffs:     make([]*ShadowRecord, 0, diffLimit),
+		diffLimit: diffLimit,
+	}
+}
+
+func (s *ShadowStatsSink) Record(record *ShadowRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats, ok := s.stats[record.ShadowTreeId]
+	if !ok {
+		stats = &ShadowStats{}
+		s.stats[record.ShadowTreeId] = stats
+	}
+	stats.Total++
+	if record.Agree {
+		return
+	}
+	stats.Disagree++
+	if s.diffLimit == 0 {
+		return
+	}
+	if len(s.diffs) >= s.diffLimit {
+		s.diffs = s.diffs[1:]
+	}
+	s.diffs = append(s.diffs, record)
+}
+
+// Stats 各候选树统计快照
+func (s *ShadowStatsSink) Stats() map[string]ShadowStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make(map[string]ShadowStats, len(s.stats))
+	for k, v := range s.stats {
+		ret[k] = *v
+	}
+	return ret
+}
+
+// Diffs 最近的不一致记录
+func (s *ShadowStatsSink) Diffs() []*ShadowRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]*ShadowRecord, len(s.diffs))
+	copy(ret, s.diffs)
+	return ret
+}
+
+// Reset 清空统计
+func (s *ShadowStatsSink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = make(map[string]*ShadowStats, 8)
+	s.diffs = make([]*ShadowRecord, 0, s.diffLimit)
+}
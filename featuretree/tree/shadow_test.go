@@ -0,0 +1,112 @@
+package tree
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/LeeZXin/zsf-utils/executor"
+)
+
+// shadowTrees 生效树x=1 候选树x>0与之一致 候选树x=2与之不一致
+func shadowTrees(t *testing.T) (active, agree, disagree *FeatureTree) {
+	return mustBuildTree(t, "active", numberInfo("x", "eq", "1")),
+		mustBuildTree(t, "agree", numberInfo("x", "gt", "0")),
+		mustBuildTree(t, "disagree", numberInfo("x", "eq", "2"))
+}
+
+func TestShadowAnalyserSync(t *testing.T) {
+	active, agree, disagree := shadowTrees(t)
+	sink := NewShadowStatsSink(10)
+	analyser := NewShadowAnalyser(nil, sink)
+	ctx := BuildFeatureAnalyseContext(active, map[string]any{"x": 1}, context.Background())
+	if result := analyser.Analyse(ctx, agree, disagree); !result.IsSuccess() {
+		t.Fatal("expect active result success")
+	}
+	stats := sink.Stats()
+	if stats["agree"] != (ShadowStats{Total: 1}) {
+		t.Fatalf("unexpected agree stats %v", stats["agree"])
+	}
+	if stats["disagree"] != (ShadowStats{Total: 1, Disagree: 1}) {
+		t.Fatalf("unexpected disagree stats %v", stats["disagree"])
+	}
+	diffs := sink.Diffs()
+	if len(diffs) != 1 || diffs[0].ActiveTreeId != "active" || diffs[0].ShadowTreeId != "disagree" || diffs[0].Agree {
+		t.Fatalf("unexpected diffs %v", diffs)
+	}
+}
+
+func TestShadowAnalyserAsync(t *testing.T) {
+	active, agree, _ := shadowTrees(t)
+	shadowExecutor, err := executor.NewExecutor(1, 0, 0, executor.AbortStrategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shadowExecutor.Shutdown()
+	records := make(chan *ShadowRecord, 1)
+	analyser := NewShadowAnalyser(shadowExecutor, ShadowSinkFunc(func(record *ShadowRecord) {
+		records <- record
+	}))
+	ctx := BuildFeatureAnalyseContext(active, map[string]any{"x": 1}, context.Background())
+	analyser.Analyse(ctx, agree)
+	select {
+	case record := <-records:
+		if !record.Agree || record.ShadowTreeId != "agree" {
+			t.Fatalf("unexpected record %v", record)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("shadow record not received")
+	}
+	// 唯一的协程被占用且没有队列时丢弃
+	block := make(chan struct{})
+	defer close(block)
+	if err = shadowExecutor.Execute(func() { <-block }); err != nil {
+		t.Fatal(err)
+	}
+	analyser.Analyse(BuildFeatureAnalyseContext(active, map[string]any{"x": 1}, context.Background()), agree)
+	if analyser.Dropped() != 1 {
+		t.Fatalf("expect 1 dropped but got %d", analyser.Dropped())
+	}
+}
+
+func TestShadowAnalyserTimeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	RegisterFetcher(&funcFetcher{
+		featureType: "shadowHang",
+		fn: func(*FeatureAnalyseContext) (any, error) {
+			<-block
+			return 1, nil
+		},
+	})
+	defer RemoveFetcher("shadowHang")
+	active, _, _ := shadowTrees(t)
+	hang := mustBuildTree(t, "hang", &PlainInfo{FeatureType: "shadowHang", FeatureKey: "y", DataType: "number", Operator: "eq", Value: "1"})
+	shadowExecutor, err := executor.NewExecutor(1, 0, 0, executor.AbortStrategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shadowExecutor.Shutdown()
+	records := make(chan *ShadowRecord, 1)
+	analyser := NewShadowAnalyserWithOpts(ShadowAnalyserOpts{
+		Executor: shadowExecutor,
+		Sinks: []ShadowSink{ShadowSinkFunc(func(record *ShadowRecord) {
+			records <- record
+		})},
+		Timeout: 50 * time.Millisecond,
+	})
+	analyser.Analyse(BuildFeatureAnalyseContext(active, map[string]any{"x": 1}, context.Background()), hang)
+	select {
+	case record := <-records:
+		if _, ok := record.ShadowResult.(*TimeoutMetricsResult); !ok {
+			t.Fatalf("expect timeout result but got %T", record.ShadowResult)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("shadow run not timed out")
+	}
+	// 超时后协程被释放
+	time.Sleep(10 * time.Millisecond)
+	if err = shadowExecutor.Execute(func() {}); err != nil {
+		t.Fatal("worker still occupied: ", err)
+	}
+}
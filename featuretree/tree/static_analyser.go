@@ -0,0 +1,595 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"regexp"
+	"strings"
+)
+
+// IssueType 静态分析问题类型
+type IssueType string
+
+const (
+	// UnsatisfiableIssue 合取式中的条件互相矛盾 永远不成立
+	UnsatisfiableIssue IssueType = "unsatisfiable"
+	// NeverMatchIssue 整棵树永远不成立
+	NeverMatchIssue IssueType = "neverMatch"
+	// UnreachableBranchIssue or节点下的分支永远不成立
+	UnreachableBranchIssue IssueType = "unreachableBranch"
+	// SubsumedIssue 合取式被另一个更宽松的合取式包含 是多余的
+	SubsumedIssue IssueType = "subsumed"
+	// DuplicateLeafIssue 重复的叶子节点
+	DuplicateLeafIssue IssueType = "duplicateLeaf"
+	// TreeOverlapIssue 两棵树可能同时命中同一报文
+	TreeOverlapIssue IssueType = "treeOverlap"
+	// TreeConflictIssue 一棵树命中时另一棵树必然命中 按顺序执行时后者被遮蔽
+	TreeConflictIssue IssueType = "treeConflict"
+)
+
+// TreeIssue 静态分析问题
+type TreeIssue struct {
+	Type IssueType `json:"type"`
+	// TreeIds 涉及的树id
+	TreeIds []string `json:"treeIds"`
+	// Leaves 涉及的叶子节点
+	Leaves  []*Leaf `json:"leaves"`
+	Message string  `json:"message"`
+}
+
+// StaticAnalyse 静态分析单棵树 检查矛盾、冗余和不可达分支
+func StaticAnalyse(tree *FeatureTree) ([]*TreeIssue, error) {
+	if tree == nil {
+		return nil, errors.New("nil tree")
+	}
+	dnf, err := parseDNFExpression(tree.Node, MaxDNFConjunctions, false)
+	if err != nil {
+		return nil, err
+	}
+	issues := make([]*TreeIssue, 0)
+	satisfiable := make([]bool, len(dnf))
+	allUnsat := true
+	for i, leaves := range dnf {
+		satisfiable[i] = isSatisfiable(leaves)
+		if satisfiable[i] {
+			allUnsat = false
+			continue
+		}
+		issues = append(issues, &TreeIssue{
+			Type:    UnsatisfiableIssue,
+			TreeIds: []string{tree.Id},
+			Leaves:  leaves,
+			Message: "conjunction can never match: " + describeLeaves(leaves),
+		})
+	}
+	if allUnsat {
+		issues = append(issues, &TreeIssue{
+			Type:    NeverMatchIssue,
+			TreeIds: []string{tree.Id},
+			Message: "tree can never match",
+		})
+	}
+	// 只对可满足的合取式做包含检查
+	for i := range dnf {
+		if !satisfiable[i] {
+			continue
+		}
+		for j := range dnf {
+			if i == j || !satisfiable[j] {
+				continue
+			}
+			if isSubset(dnf[j], dnf[i]) {
+				// 相同合取式只报告一次
+				if isSubset(dnf[i], dnf[j]) && j > i {
+					continue
+				}
+				issues = append(issues, &TreeIssue{
+					Type:    SubsumedIssue,
+					TreeIds: []string{tree.Id},
+					Leaves:  dnf[i],
+					Message: fmt.Sprintf("conjunction %s is subsumed by %s", describeLeaves(dnf[i]), describeLeaves(dnf[j])),
+				})
+				break
+			}
+		}
+		if dup := duplicateLeaves(dnf[i]); len(dup) > 0 {
+			issues = append(issues, &TreeIssue{
+				Type:    DuplicateLeafIssue,
+				TreeIds: []string{tree.Id},
+				Leaves:  dup,
+				Message: "duplicate leaves in conjunction: " + describeLeaves(dup),
+			})
+		}
+	}
+	branchIssues, err := analyseBranches(tree.Id, tree.Node)
+	if err != nil {
+		return nil, err
+	}
+	return append(issues, branchIssues...), nil
+}
+
+// StaticAnalyseTrees 静态分析多棵树 包含单棵树的问题和树之间的重叠、冲突
+func StaticAnalyseTrees(trees []*FeatureTree) ([]*TreeIssue, error) {
+	issues := make([]*TreeIssue, 0)
+	dnfs := make([][][]*Leaf, len(trees))
+	for i, tree := range trees {
+		treeIssues, err := StaticAnalyse(tree)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, treeIssues...)
+		dnf, _ := parseDNFExpression(tree.Node, MaxDNFConjunctions, false)
+		// 去掉不可满足的合取式
+		valid := make([][]*Leaf, 0, len(dnf))
+		for _, leaves := range dnf {
+			if isSatisfiable(leaves) {
+				valid = append(valid, leaves)
+			}
+		}
+		dnfs[i] = valid
+	}
+	for i := range trees {
+		for j := i + 1; j < len(trees); j++ {
+			ids := []string{trees[i].Id, trees[j].Id}
+			if covers(dnfs[i], dnfs[j]) {
+				issues = append(issues, &TreeIssue{
+					Type:    TreeConflictIssue,
+					TreeIds: ids,
+					Message: fmt.Sprintf("tree %s always matches when tree %s matches", trees[i].Id, trees[j].Id),
+				})
+			} else if covers(dnfs[j], dnfs[i]) {
+				issues = append(issues, &TreeIssue{
+					Type:    TreeConflictIssue,
+					TreeIds: []string{trees[j].Id, trees[i].Id},
+					Message: fmt.Sprintf("tree %s always matches when tree %s matches", trees[j].Id, trees[i].Id),
+				})
+			} else if leaves, ok := overlaps(dnfs[i], dnfs[j]); ok {
+				issues = append(issues, &TreeIssue{
+					Type:    TreeOverlapIssue,
+					TreeIds: ids,
+					Leaves:  leaves,
+					Message: fmt.Sprintf("tree %s and tree %s may both match: %s", trees[i].Id, trees[j].Id, describeLeaves(leaves)),
+				})
+			}
+		}
+	}
+	return issues, nil
+}
+
+// analyseBranches 检查or节点下的重复叶子和不可达分支
+func analyseBranches(treeId string, node *Node) ([]*TreeIssue, error) {
+	issues := make([]*TreeIssue, 0)
+	if node == nil || node.IsLeave() {
+		return issues, nil
+	}
+	if !checkEmpty(node.And) {
+		for _, n := range node.And {
+			sub, err := analyseBranches(treeId, n)
+			if err != nil {
+				return nil, err
+			}
+			issues = append(issues, sub...)
+		}
+		return issues, nil
+	}
+	leaves := make([]*Leaf, 0, len(node.Or))
+	for _, n := range node.Or {
+		if n.IsLeave() {
+			leaves = append(leaves, n.Leaf)
+		}
+		dnf, err := parseDNFExpression(n, MaxDNFConjunctions, false)
+		if err != nil {
+			return nil, err
+		}
+		unreachable := true
+		for _, conjunction := range dnf {
+			if isSatisfiable(conjunction) {
+				unreachable = false
+				break
+			}
+		}
+		if unreachable {
+			issues = append(issues, &TreeIssue{
+				Type:    UnreachableBranchIssue,
+				TreeIds: []string{treeId},
+				Leaves:  collectLeaves(n, nil),
+				Message: "or branch can never match: " + describeLeaves(collectLeaves(n, nil)),
+			})
+		}
+		sub, err := analyseBranches(treeId, n)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, sub...)
+	}
+	if dup := duplicateLeaves(leaves); len(dup) > 0 {
+		issues = append(issues, &TreeIssue{
+			Type:    DuplicateLeafIssue,
+			TreeIds: []string{treeId},
+			Leaves:  dup,
+			Message: "duplicate leaves in or branches: " + describeLeaves(dup),
+		})
+	}
+	return issues, nil
+}
+
+// covers dnf中任意合取式成立时 target必然成立
+func covers(target, dnf [][]*Leaf) bool {
+	if len(dnf) == 0 || len(target) == 0 {
+		return false
+	}
+	for _, conjunction := range dnf {
+		covered := false
+		for _, t := range target {
+			if isSubset(t, conjunction) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// overlaps 两个析取范式是否可能同时成立
+func overlaps(dnf1, dnf2 [][]*Leaf) ([]*Leaf, bool) {
+	for _, c1 := range dnf1 {
+		for _, c2 := range dnf2 {
+			merged := make([]*Leaf, 0, len(c1)+len(c2))
+			merged = append(merged, c1...)
+			merged = append(merged, c2...)
+			if isSatisfiable(merged) {
+				return merged, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func collectLeaves(node *Node, leaves []*Leaf) []*Leaf {
+	if node == nil {
+		return leaves
+	}
+	if node.IsLeave() {
+		return append(leaves, node.Leaf)
+	}
+	for _, n := range node.And {
+		leaves = collectLeaves(n, leaves)
+	}
+	for _, n := range node.Or {
+		leaves = collectLeaves(n, leaves)
+	}
+	return leaves
+}
+
+// isSubset sub中的叶子是否都在leaves中
+func isSubset(sub, leaves []*Leaf) bool {
+	set := make(map[string]struct{}, len(leaves))
+	for _, leaf := range leaves {
+		set[leafIdentity(leaf)] = struct{}{}
+	}
+	for _, leaf := range sub {
+		if _, ok := set[leafIdentity(leaf)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func duplicateLeaves(leaves []*Leaf) []*Leaf {
+	seen := make(map[string]int, len(leaves))
+	ret := make([]*Leaf, 0)
+	for _, leaf := range leaves {
+		id := leafIdentity(leaf)
+		seen[id]++
+		if seen[id] == 2 {
+			ret = append(ret, leaf)
+		}
+	}
+	return ret
+}
+
+func describeLeaves(leaves []*Leaf) string {
+	descs := make([]string, 0, len(leaves))
+	for _, leaf := range leaves {
+		descs = append(descs, describeLeaf(leaf))
+	}
+	return strings.Join(descs, " and ")
+}
+
+func describeLeaf(leaf *Leaf) string {
+	var (
+		featureKey string
+		operator   string
+		value      string
+	)
+	if leaf.KeyNameInfo != nil {
+		featureKey = leaf.KeyNameInfo.FeatureKey
+	}
+	if leaf.Operator != nil {
+		operator = leaf.Operator.Operator
+	}
+	if leaf.StringValue != nil {
+		value = leaf.StringValue.Value
+	}
+	return fmt.Sprintf("%s %s %s", featureKey, operator, value)
+}
+
+type constraintKey struct {
+	featureType string
+	featureKey  string
+	dataType    string
+}
+
+// isSatisfiable 合取式是否可能成立 无法判断的条件视为可成立
+func isSatisfiable(leaves []*Leaf) bool {
+	numbers := make(map[constraintKey]*numberConstraint)
+	stringsMap := make(map[constraintKey]*stringConstraint)
+	for _, leaf := range leaves {
+		if leaf.KeyNameInfo == nil || leaf.Operator == nil || leaf.StringValue == nil {
+			continue
+		}
+		key := constraintKey{
+			featureType: leaf.FeatureType,
+			featureKey:  leaf.KeyNameInfo.FeatureKey,
+			dataType:    leaf.DataType,
+		}
+		targets := leaf.Operator.ValueSplitter.SplitValue(leaf.StringValue.Value)
+		switch leaf.DataType {
+		case "number":
+			c, ok := numbers[key]
+			if !ok {
+				c = &numberConstraint{}
+				numbers[key] = c
+			}
+			c.add(leaf.Operator.Operator, targets)
+		case "string":
+			c, ok := stringsMap[key]
+			if !ok {
+				c = &stringConstraint{}
+				stringsMap[key] = c
+			}
+			c.add(leaf.Operator.Operator, targets)
+		}
+	}
+	for _, c := range numbers {
+		if !c.satisfiable() {
+			return false
+		}
+	}
+	for _, c := range stringsMap {
+		if !c.satisfiable() {
+			return false
+		}
+	}
+	return true
+}
+
+// numberConstraint 同一特征的数字约束 区间加离散值
+type numberConstraint struct {
+	lower          *decimal.Decimal
+	lowerInclusive bool
+	upper          *decimal.Decimal
+	upperInclusive bool
+	// values eq和in的交集 nil表示不限制
+	values   []decimal.Decimal
+	excludes []decimal.Decimal
+	// never 条件本身永远不成立 如期待值不是数字
+	never bool
+}
+
+func (c *numberConstraint) add(operator string, targets []string) {
+	values := make([]decimal.Decimal, 0, len(targets))
+	for _, target := range targets {
+		v, err := decimal.NewFromString(target)
+		if err != nil {
+			// 与NumberFeatureHandler一致 期待值不是数字永远返回false
+			c.never = true
+			return
+		}
+		values = append(values, v)
+	}
+	if len(values) == 0 {
+		c.never = true
+		return
+	}
+	switch operator {
+	case Eq.Operator:
+		c.restrict(values[:1])
+	case In.Operator:
+		c.restrict(values)
+	case Neq.Operator:
+		c.excludes = append(c.excludes, values[0])
+	case Gt.Operator:
+		c.addLower(values[0], false)
+	case Gte.Operator:
+		c.addLower(values[0], true)
+	case Lt.Operator:
+		c.addUpper(values[0], false)
+	case Lte.Operator:
+		c.addUpper(values[0], true)
+	case Between.Operator:
+		if len(values) < 2 {
+			c.never = true
+			return
+		}
+		c.addLower(values[0], true)
+		c.addUpper(values[1], true)
+	}
+}
+
+func (c *numberConstraint) restrict(values []decimal.Decimal) {
+	if c.values == nil {
+		c.values = values
+		return
+	}
+	ret := make([]decimal.Decimal, 0, len(c.values))
+	for _, v := range c.values {
+		for _, t := range values {
+			if v.Equal(t) {
+				ret = append(ret, v)
+				break
+			}
+		}
+	}
+	c.values = ret
+}
+
+func (c *numberConstraint) addLower(v decimal.Decimal, inclusive bool) {
+	if c.lower == nil || v.GreaterThan(*c.lower) || (v.Equal(*c.lower) && !inclusive) {
+		c.lower = &v
+		c.lowerInclusive = inclusive
+	}
+}
+
+func (c *numberConstraint) addUpper(v decimal.Decimal, inclusive bool) {
+	if c.upper == nil || v.LessThan(*c.upper) || (v.Equal(*c.upper) && !inclusive) {
+		c.upper = &v
+		c.upperInclusive = inclusive
+	}
+}
+
+func (c *numberConstraint) inRange(v decimal.Decimal) bool {
+	if c.lower != nil {
+		if v.LessThan(*c.lower) || (v.Equal(*c.lower) && !c.lowerInclusive) {
+			return false
+		}
+	}
+	if c.upper != nil {
+		if v.GreaterThan(*c.upper) || (v.Equal(*c.upper) && !c.upperInclusive) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *numberConstraint) excluded(v decimal.Decimal) bool {
+	for _, e := range c.excludes {
+		if e.Equal(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *numberConstraint) satisfiable() bool {
+	if c.never {
+		return false
+	}
+	if c.lower != nil && c.upper != nil {
+		if c.lower.GreaterThan(*c.upper) {
+			return false
+		}
+		if c.lower.Equal(*c.upper) {
+			if !c.lowerInclusive || !c.upperInclusive {
+				return false
+			}
+			if c.values == nil {
+				return !c.excluded(*c.lower)
+			}
+		}
+	}
+	if c.values != nil {
+		for _, v := range c.values {
+			if c.inRange(v) && !c.excluded(v) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// stringConstraint 同一特征的字符串约束
+type stringConstraint struct {
+	// values eq、in和blank的交集 nil表示不限制
+	values   []string
+	excludes []string
+	regs     []*regexp.Regexp
+	never    bool
+}
+
+func (c *stringConstraint) add(operator string, targets []string) {
+	switch operator {
+	case Eq.Operator:
+		if len(targets) == 0 {
+			c.never = true
+			return
+		}
+		c.restrict(targets[:1])
+	case In.Operator:
+		c.restrict(targets)
+	case Neq.Operator:
+		if len(targets) == 0 {
+			c.never = true
+			return
+		}
+		c.excludes = append(c.excludes, targets[0])
+	case Blank.Operator:
+		c.restrict([]string{""})
+	case NotBlank.Operator:
+		c.excludes = append(c.excludes, "")
+	case RegMatch.Operator:
+		if len(targets) == 0 {
+			c.never = true
+			return
+		}
+		reg, err := regexp.Compile(targets[0])
+		if err != nil {
+			// 与StringFeatureHandler一致 正则错误永远返回false
+			c.never = true
+			return
+		}
+		c.regs = append(c.regs, reg)
+	}
+}
+
+func (c *stringConstraint) restrict(values []string) {
+	if c.values == nil {
+		c.values = values
+		return
+	}
+	ret := make([]string, 0, len(c.values))
+	for _, v := range c.values {
+		for _, t := range values {
+			if v == t {
+				ret = append(ret, v)
+				break
+			}
+		}
+	}
+	c.values = ret
+}
+
+func (c *stringConstraint) satisfiable() bool {
+	if c.never {
+		return false
+	}
+	if c.values == nil {
+		// 不限制取值时无法穷举 视为可成立
+		return true
+	}
+	for _, v := range c.values {
+		if c.accept(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *stringConstraint) accept(v string) bool {
+	for _, e := range c.excludes {
+		if e == v {
+			return false
+		}
+	}
+	for _, reg := range c.regs {
+		if !reg.MatchString(v) {
+			return false
+		}
+	}
+	return true
+}
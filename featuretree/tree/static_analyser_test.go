@@ -0,0 +1,243 @@
+package tree
+
+import (
+	"testing"
+)
+
+func numberInfo(key, operator, value string) *PlainInfo {
+	return &PlainInfo{FeatureType: "message", FeatureKey: key, DataType: "number", Operator: operator, Value: value}
+}
+
+func stringInfo(key, operator, value string) *PlainInfo {
+	return &PlainInfo{FeatureType: "message", FeatureKey: key, DataType: "string", Operator: operator, Value: value}
+}
+
+func and(infos ...*PlainInfo) *PlainInfo {
+	return &PlainInfo{And: infos}
+}
+
+func or(infos ...*PlainInfo) *PlainInfo {
+	return &PlainInfo{Or: infos}
+}
+
+func buildLeaves(infos ...*PlainInfo) []*Leaf {
+	ret := make([]*Leaf, 0, len(infos))
+	for _, info := range infos {
+		ret = append(ret, buildTreeNode(info).Leaf)
+	}
+	return ret
+}
+
+func mustBuildTree(t *testing.T, id string, info *PlainInfo) *FeatureTree {
+	tree, err := BuildFeatureTree(id, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func issueTypes(issues []*TreeIssue) map[IssueType]int {
+	ret := make(map[IssueType]int, len(issues))
+	for _, issue := range issues {
+		ret[issue.Type]++
+	}
+	return ret
+}
+
+func TestIsSatisfiable(t *testing.T) {
+	tests := []struct {
+		name   string
+		leaves []*PlainInfo
+		expect bool
+	}{
+		{"gt and lt disjoint", []*PlainInfo{numberInfo("x", "gt", "10"), numberInfo("x", "lt", "5")}, false},
+		{"gte and lte same point", []*PlainInfo{numberInfo("x", "gte", "5"), numberInfo("x", "lte", "5")}, true},
+		{"gt and lte same point", []*PlainInfo{numberInfo("x", "gt", "5"), numberInfo("x", "lte", "5")}, false},
+		{"same point excluded", []*PlainInfo{numberInfo("x", "gte", "5"), numberInfo("x", "lte", "5"), numberInfo("x", "neq", "5")}, false},
+		{"between and eq outside", []*PlainInfo{numberInfo("x", "between", "1,10"), numberInfo("x", "eq", "11")}, false},
+		{"between and eq inside", []*PlainInfo{numberInfo("x", "between", "1,10"), numberInfo("x", "eq", "10")}, true},
+		{"in with neq and gt", []*PlainInfo{numberInfo("x", "in", "1,2,3"), numberInfo("x", "neq", "2"), numberInfo("x", "gt", "1")}, true},
+		{"in all excluded", []*PlainInfo{numberInfo("x", "in", "1,2"), numberInfo("x", "neq", "2"), numberInfo("x", "gt", "1")}, false},
+		{"eq decimal equal", []*PlainInfo{numberInfo("x", "eq", "1.0"), numberInfo("x", "in", "1,2")}, true},
+		{"not a number", []*PlainInfo{numberInfo("x", "eq", "abc")}, false},
+		{"different keys", []*PlainInfo{numberInfo("x", "gt", "10"), numberInfo("y", "lt", "5")}, true},
+		{"string eq different", []*PlainInfo{stringInfo("s", "eq", "a"), stringInfo("s", "eq", "b")}, false},
+		{"string in with neq", []*PlainInfo{stringInfo("s", "in", "a,b"), stringInfo("s", "neq", "a")}, true},
+		{"string in all excluded", []*PlainInfo{stringInfo("s", "in", "a,b"), stringInfo("s", "neq", "a"), stringInfo("s", "neq", "b")}, false},
+		{"blank and notBlank", []*PlainInfo{stringInfo("s", "blank", ""), stringInfo("s", "notBlank", "")}, false},
+		{"regMatch and eq match", []*PlainInfo{stringInfo("s", "regMatch", "^a"), stringInfo("s", "eq", "abc")}, true},
+		{"regMatch and eq mismatch", []*PlainInfo{stringInfo("s", "regMatch", "^a"), stringInfo("s", "eq", "b")}, false},
+		{"invalid regexp", []*PlainInfo{stringInfo("s", "regMatch", "(")}, false},
+		{"unrestricted string", []*PlainInfo{stringInfo("s", "neq", "a"), stringInfo("s", "regMatch", "^b")}, true},
+		{"same key different data type", []*PlainInfo{numberInfo("x", "eq", "1"), stringInfo("x", "eq", "2")}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isSatisfiable(buildLeaves(test.leaves...)); got != test.expect {
+				t.Fatalf("expect %v but got %v", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestStaticAnalyse(t *testing.T) {
+	tests := []struct {
+		name   string
+		info   *PlainInfo
+		expect map[IssueType]int
+	}{
+		{
+			name:   "clean",
+			info:   or(numberInfo("x", "eq", "1"), numberInfo("x", "eq", "2")),
+			expect: map[IssueType]int{},
+		},
+		{
+			name:   "never match",
+			info:   and(numberInfo("x", "gt", "10"), numberInfo("x", "lt", "5")),
+			expect: map[IssueType]int{UnsatisfiableIssue: 1, NeverMatchIssue: 1},
+		},
+		{
+			name: "unreachable branch",
+			info: or(
+				numberInfo("x", "eq", "1"),
+				and(numberInfo("x", "gt", "10"), numberInfo("x", "lt", "5")),
+			),
+			expect: map[IssueType]int{UnsatisfiableIssue: 1, UnreachableBranchIssue: 1},
+		},
+		{
+			name: "subsumed conjunction",
+			info: or(
+				numberInfo("x", "eq", "1"),
+				and(numberInfo("x", "eq", "1"), stringInfo("s", "eq", "a")),
+			),
+			expect: map[IssueType]int{SubsumedIssue: 1},
+		},
+		{
+			name: "and distributes over or",
+			info: and(
+				or(numberInfo("x", "eq", "1"), numberInfo("x", "eq", "2")),
+				numberInfo("x", "eq", "1"),
+			),
+			// 展开为x=1且x=1、x=2且x=1 后者不可满足 前者叶子重复
+			expect: map[IssueType]int{UnsatisfiableIssue: 1, DuplicateLeafIssue: 1},
+		},
+		{
+			name:   "duplicate or leaves",
+			info:   or(stringInfo("s", "eq", "a"), stringInfo("s", "eq", "a")),
+			expect: map[IssueType]int{SubsumedIssue: 1, DuplicateLeafIssue: 1},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			issues, err := StaticAnalyse(mustBuildTree(t, "t", test.info))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := issueTypes(issues)
+			if len(got) != len(test.expect) {
+				t.Fatalf("expect %v but got %v", test.expect, got)
+			}
+			for k, v := range test.expect {
+				if got[k] != v {
+					t.Fatalf("expect %v but got %v", test.expect, got)
+				}
+			}
+		})
+	}
+}
+
+func TestStaticAnalyseTrees(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   *PlainInfo
+		expect IssueType
+		// ids 冲突时先命中的树在前
+		ids []string
+	}{
+		{
+			name:   "disjoint",
+			a:      numberInfo("x", "eq", "1"),
+			b:      numberInfo("x", "eq", "2"),
+			expect: "",
+		},
+		{
+			name:   "b narrower than a",
+			a:      numberInfo("x", "gt", "1"),
+			b:      and(numberInfo("x", "gt", "1"), stringInfo("s", "eq", "a")),
+			expect: TreeConflictIssue,
+			ids:    []string{"a", "b"},
+		},
+		{
+			name:   "a narrower than b",
+			a:      and(numberInfo("x", "gt", "1"), stringInfo("s", "eq", "a")),
+			b:      numberInfo("x", "gt", "1"),
+			expect: TreeConflictIssue,
+			ids:    []string{"b", "a"},
+		},
+		{
+			name: "or covers every conjunction",
+			a:    or(numberInfo("x", "eq", "1"), numberInfo("x", "eq", "2")),
+			b: or(
+				and(numberInfo("x", "eq", "1"), stringInfo("s", "eq", "a")),
+				numberInfo("x", "eq", "2"),
+			),
+			expect: TreeConflictIssue,
+			ids:    []string{"a", "b"},
+		},
+		{
+			name: "or covers part of conjunctions",
+			a:    numberInfo("x", "eq", "1"),
+			b: or(
+				and(numberInfo("x", "eq", "1"), stringInfo("s", "eq", "a")),
+				numberInfo("x", "eq", "2"),
+			),
+			expect: TreeOverlapIssue,
+			ids:    []string{"a", "b"},
+		},
+		{
+			name:   "different features overlap",
+			a:      numberInfo("x", "gt", "1"),
+			b:      stringInfo("s", "eq", "a"),
+			expect: TreeOverlapIssue,
+			ids:    []string{"a", "b"},
+		},
+		{
+			name:   "ranges disjoint",
+			a:      numberInfo("x", "lt", "5"),
+			b:      numberInfo("x", "gte", "5"),
+			expect: "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			issues, err := StaticAnalyseTrees([]*FeatureTree{
+				mustBuildTree(t, "a", test.a),
+				mustBuildTree(t, "b", test.b),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var found *TreeIssue
+			for _, issue := range issues {
+				if issue.Type == TreeConflictIssue || issue.Type == TreeOverlapIssue {
+					if found != nil {
+						t.Fatalf("expect one tree issue but got more")
+					}
+					found = issue
+				}
+			}
+			if test.expect == "" {
+				if found != nil {
+					t.Fatalf("expect no tree issue but got %s", found.Message)
+				}
+				return
+			}
+			if found == nil || found.Type != test.expect {
+				t.Fatalf("expect %s but got %v", test.expect, found)
+			}
+			if found.TreeIds[0] != test.ids[0] || found.TreeIds[1] != test.ids[1] {
+				t.Fatalf("expect ids %v but got %v", test.ids, found.TreeIds)
+			}
+		})
+	}
+}
@@ -2,9 +2,12 @@ package tree
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/LeeZXin/zsf-utils/luautil"
+	"hash/fnv"
+	"strings"
 )
 
 // PlainInfo 规则树配置类
@@ -88,6 +91,32 @@ func (t Leaf) Verify() error {
 	return nil
 }
 
+// Fingerprint 叶子节点指纹 条件相同的叶子指纹相同 可用作索引key
+func (t *Leaf) Fingerprint() string {
+	h := fnv.New128a()
+	h.Write([]byte(leafIdentity(t)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// leafIdentity 叶子节点标识 按固定字段顺序拼接 不依赖json序列化
+func leafIdentity(leaf *Leaf) string {
+	var (
+		featureKey string
+		operator   string
+		value      string
+	)
+	if leaf.KeyNameInfo != nil {
+		featureKey = leaf.KeyNameInfo.FeatureKey
+	}
+	if leaf.Operator != nil {
+		operator = leaf.Operator.Operator
+	}
+	if leaf.StringValue != nil {
+		value = leaf.StringValue.Value
+	}
+	return strings.Join([]string{leaf.FeatureType, featureKey, leaf.DataType, operator, value}, "\x00")
+}
+
 // BuildFeatureTree 构建特征树
 func BuildFeatureTree(id string, info *PlainInfo) (*FeatureTree, error) {
 	node := buildTreeNode(info)
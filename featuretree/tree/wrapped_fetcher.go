@@ -0,0 +1,263 @@
+package tree
+
+import (
+	"context"
+	"errors"
+	"github.com/LeeZXin/zsf-utils/collections/hashmap"
+	"github.com/LeeZXin/zsf-utils/luautil"
+	"github.com/LeeZXin/zsf-utils/threadutil"
+	"github.com/spf13/cast"
+	"strings"
+	"time"
+)
+
+// TimeoutFetcher 带超时和降级值的fetcher包装
+// 被包装的fetcher在新的goroutine中执行 超时后立即返回 不等待未响应ctx的fetcher
+type TimeoutFetcher struct {
+	fetcher     FeatureFetcher
+	timeout     time.Duration
+	fallback    any
+	hasFallback bool
+}
+
+func NewTimeoutFetcher(fetcher FeatureFetcher, timeout time.Duration) (*TimeoutFetcher, error) {
+	if fetcher == nil {
+		return nil, errors.New("nil fetcher")
+	}
+	return &TimeoutFetcher{
+		fetcher: fetcher,
+		timeout: timeout,
+	}, nil
+}
+
+// NewTimeoutFetcherWithFallback 获取失败或超时返回降级值
+// 超时前返回的结果正常使用 只有真正超时或fetcher返回错误时才使用降级值
+func NewTimeoutFetcherWithFallback(fetcher FeatureFetcher, timeout time.Duration, fallback any) (*TimeoutFetcher, error) {
+	ret, err := NewTimeoutFetcher(fetcher, timeout)
+	if err != nil {
+		return nil, err
+	}
+	ret.fallback = fallback
+	ret.hasFallback = true
+	return ret, nil
+}
+
+func (f *TimeoutFetcher) GetFeatureType() string {
+	return f.fetcher.GetFeatureType()
+}
+
+func (f *TimeoutFetcher) Execute(ctx *FeatureAnalyseContext) (any, error) {
+	ret, err := withTimeout(ctx, f.timeout, f.fetcher.Execute)
+	if err != nil {
+		if f.hasFallback {
+			return f.fallback, nil
+		}
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (f *TimeoutFetcher) BatchExecute(ctx *FeatureAnalyseContext, featureKeys []string) (map[string]any, error) {
+	ret, err := withTimeout(ctx, f.timeout, func(ctx *FeatureAnalyseContext) (map[string]any, error) {
+		return batchExecute(f.fetcher, ctx, featureKeys)
+	})
+	if err != nil {
+		if f.hasFallback {
+			// 不支持批量时只获取了当前节点的特征
+			if _, ok := f.fetcher.(BatchFeatureFetcher); !ok {
+				node := ctx.GetCurrentNode()
+				if node != nil && node.IsLeave() {
+					featureKeys = []string{node.Leaf.KeyNameInfo.FeatureKey}
+				}
+			}
+			ret = make(map[string]any, len(featureKeys))
+			for _, key := range featureKeys {
+				ret[key] = f.fallback
+			}
+			return ret, nil
+		}
+		return nil, err
+	}
+	return ret, nil
+}
+
+type timeoutResult[T any] struct {
+	value T
+	err   error
+}
+
+// withTimeout 复制上下文后在新的goroutine中使用带超时的子context执行 不修改原上下文
+// 超时前完成时返回fn的结果 超时后fn在后台继续执行 结果被丢弃
+func withTimeout[T any](ctx *FeatureAnalyseContext, timeout time.Duration, fn func(*FeatureAnalyseContext) (T, error)) (T, error) {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+	parent := ctx.Ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	timeoutCtx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	sub := *ctx
+	sub.Ctx = timeoutCtx
+	// 超时后原上下文的缓存可能被继续写入 后台执行的fn只读取副本
+	sub.featureCache = make(map[string]any, len(ctx.featureCache))
+	for k, v := range ctx.featureCache {
+		sub.featureCache[k] = v
+	}
+	done := make(chan timeoutResult[T], 1)
+	go func() {
+		var ret timeoutResult[T]
+		if err := threadutil.RunSafe(func() {
+			ret.value, ret.err = fn(&sub)
+		}); err != nil {
+			ret.err = err
+		}
+		done <- ret
+	}()
+	select {
+	case ret := <-done:
+		return ret.value, ret.err
+	case <-timeoutCtx.Done():
+		var zero T
+		return zero, timeoutCtx.Err()
+	}
+}
+
+type cachedFeature struct {
+	value    any
+	expireAt time.Time
+}
+
+// CachedFetcher 带过期时间的特征缓存 可在多次解析间共享
+type CachedFetcher struct {
+	fetcher FeatureFetcher
+	ttl     time.Duration
+	// keyFields 参与缓存key计算的报文字段 不能为空 避免不同报文共用特征值
+	keyFields []string
+	cache     *hashmap.ConcurrentLinkedHashMap[string, cachedFeature]
+}
+
+// NewCachedFetcher keyFields为报文中区分特征值的字段 如用户id
+func NewCachedFetcher(fetcher FeatureFetcher, ttl time.Duration, maxSize int, keyFields ...string) (*CachedFetcher, error) {
+	if fetcher == nil {
+		return nil, errors.New("nil fetcher")
+	}
+	if len(keyFields) == 0 {
+		return nil, errors.New("empty keyFields")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("wrong ttl")
+	}
+	if maxSize <= 0 {
+		return nil, errors.New("maxSize should greater than 0")
+	}
+	return &CachedFetcher{
+		fetcher:   fetcher,
+		ttl:       ttl,
+		keyFields: keyFields,
+		cache:     hashmap.NewConcurrentLinkedHashMapWithLimitSize[string, cachedFeature](true, maxSize),
+	}, nil
+}
+
+func (f *CachedFetcher) GetFeatureType() string {
+	return f.fetcher.GetFeatureType()
+}
+
+func (f *CachedFetcher) Execute(ctx *FeatureAnalyseContext) (any, error) {
+	node := ctx.GetCurrentNode()
+	if node == nil || !node.IsLeave() {
+		return nil, errors.New("wrong node")
+	}
+	cacheKey := f.cacheKey(node.Leaf.KeyNameInfo.FeatureKey, ctx)
+	val, ok := f.getCache(cacheKey)
+	if ok {
+		return val, nil
+	}
+	ret, err := f.fetcher.Execute(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f.putCache(cacheKey, ret)
+	return ret, nil
+}
+
+func (f *CachedFetcher) BatchExecute(ctx *FeatureAnalyseContext, featureKeys []string) (map[string]any, error) {
+	ret := make(map[string]any, len(featureKeys))
+	missKeys := make([]string, 0, len(featureKeys))
+	for _, key := range featureKeys {
+		val, ok := f.getCache(f.cacheKey(key, ctx))
+		if ok {
+			ret[key] = val
+		} else {
+			missKeys = append(missKeys, key)
+		}
+	}
+	if len(missKeys) == 0 {
+		return ret, nil
+	}
+	fetched, err := batchExecute(f.fetcher, ctx, missKeys)
+	if err != nil {
+		return nil, err
+	}
+	for key, val := range fetched {
+		f.putCache(f.cacheKey(key, ctx), val)
+		ret[key] = val
+	}
+	return ret, nil
+}
+
+// Clear 清空缓存
+func (f *CachedFetcher) Clear() {
+	f.cache.Clear()
+}
+
+func (f *CachedFetcher) getCache(cacheKey string) (any, bool) {
+	feature, ok := f.cache.Get(cacheKey)
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(feature.expireAt) {
+		f.cache.Remove(cacheKey)
+		return nil, false
+	}
+	return feature.value, true
+}
+
+func (f *CachedFetcher) putCache(cacheKey string, val any) {
+	f.cache.Put(cacheKey, cachedFeature{
+		value:    val,
+		expireAt: time.Now().Add(f.ttl),
+	})
+}
+
+func (f *CachedFetcher) cacheKey(featureKey string, ctx *FeatureAnalyseContext) string {
+	message := luautil.Bindings(ctx.OriginMessage)
+	builder := strings.Builder{}
+	builder.WriteString(featureKey)
+	for _, field := range f.keyFields {
+		val, _ := message.Get(field)
+		builder.WriteString("#")
+		builder.WriteString(cast.ToString(val))
+	}
+	return builder.String()
+}
+
+// batchExecute 被包装的fetcher不支持批量时 只获取当前节点的特征
+func batchExecute(fetcher FeatureFetcher, ctx *FeatureAnalyseContext, featureKeys []string) (map[string]any, error) {
+	batchFetcher, ok := fetcher.(BatchFeatureFetcher)
+	if ok {
+		return batchFetcher.BatchExecute(ctx, featureKeys)
+	}
+	node := ctx.GetCurrentNode()
+	if node == nil || !node.IsLeave() {
+		return nil, errors.New("wrong node")
+	}
+	ret, err := fetcher.Execute(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		node.Leaf.KeyNameInfo.FeatureKey: ret,
+	}, nil
+}
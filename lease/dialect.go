@@ -0,0 +1,63 @@
+package lease
+
+import (
+	"errors"
+	"strings"
+	"xorm.io/xorm/schemas"
+)
+
+const (
+	// postgresUniqueViolation postgres唯一键冲突的SQLSTATE
+	postgresUniqueViolation = "23505"
+	// mssqlUniqueConstraint mssql违反唯一约束的错误码
+	mssqlUniqueConstraint = 2627
+	// mssqlUniqueIndex mssql违反唯一索引的错误码
+	mssqlUniqueIndex = 2601
+)
+
+// uniqueViolationMessages 各数据库唯一键冲突的错误信息
+var uniqueViolationMessages = map[schemas.DBType][]string{
+	schemas.MYSQL:    {"Error 1062"},
+	schemas.POSTGRES: {"SQLSTATE 23505", "duplicate key value violates unique constraint"},
+	schemas.SQLITE:   {"UNIQUE constraint failed"},
+	schemas.MSSQL:    {"Violation of UNIQUE KEY constraint", "Violation of PRIMARY KEY constraint", "Cannot insert duplicate key"},
+}
+
+// IsUniqueViolation 判断是否为唯一键冲突错误
+// 优先通过驱动错误的SQLState或错误码判断 不依赖具体驱动 否则按数据库类型匹配错误信息
+// dbType未知时匹配所有数据库的错误信息
+func IsUniqueViolation(dbType schemas.DBType, err error) bool {
+	if err == nil {
+		return false
+	}
+	// lib/pq、pgx
+	var stateErr interface{ SQLState() string }
+	if errors.As(err, &stateErr) {
+		return stateErr.SQLState() == postgresUniqueViolation
+	}
+	// go-mssqldb
+	var numberErr interface{ SQLErrorNumber() int32 }
+	if errors.As(err, &numberErr) {
+		number := numberErr.SQLErrorNumber()
+		return number == mssqlUniqueConstraint || number == mssqlUniqueIndex
+	}
+	msg := err.Error()
+	if messages, ok := uniqueViolationMessages[dbType]; ok {
+		return containsAny(msg, messages)
+	}
+	for _, messages := range uniqueViolationMessages {
+		if containsAny(msg, messages) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+//go:build unix
+
+package lease
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// fileRecord 文件中的租约记录 Owner为空表示租约已释放
+type fileRecord struct {
+	Id      int64     `json:"id"`
+	Owner   string    `json:"owner"`
+	Renewed time.Time `json:"renewed"`
+}
+
+type fileLease struct {
+	Key             string
+	Owner           string
+	Path            string
+	ExpiredDuration time.Duration
+}
+
+type fileReleaser struct {
+	Id          int64
+	Owner       string
+	Path        string
+	releaseOnce sync.Once
+}
+
+func (r *fileReleaser) Release() (err error) {
+	r.releaseOnce.Do(func() {
+		err = withFileLock(r.Path, func(md *fileRecord) (bool, error) {
+			if md.Id != r.Id || md.Owner != r.Owner {
+				return false, nil
+			}
+			// 保留id 避免释放后id重复
+			md.Owner = ""
+			return true, nil
+		})
+	})
+	return
+}
+
+type fileRenewer struct {
+	Id    int64
+	Owner string
+	Path  string
+}
+
+func (r *fileRenewer) Renew(context.Context) (bool, error) {
+	success := false
+	err := withFileLock(r.Path, func(md *fileRecord) (bool, error) {
+		if md.Id != r.Id || md.Owner != r.Owner {
+			return false, nil
+		}
+		md.Renewed = time.Now()
+		success = true
+		return true, nil
+	})
+	return success, err
+}
+
+// NewFileLease 基于文件锁的租约 用于单机多进程的协调
+// 租约记录在dir下以key命名的文件中 读写时通过flock互斥 进程退出后租约在过期后可被抢占
+func NewFileLease(key, owner, dir string, expiredDuration time.Duration) (Leaser, error) {
+	if key == "" {
+		return nil, errors.New("empty key")
+	}
+	if strings.ContainsAny(key, `/\`) {
+		return nil, errors.New("key should not contain path separator")
+	}
+	if owner == "" {
+		return nil, errors.New("empty owner")
+	}
+	if dir == "" {
+		return nil, errors.New("empty dir")
+	}
+	if expiredDuration <= 0 {
+		return nil, errors.New("wrong duration")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &fileLease{
+		Key:             key,
+		Owner:           owner,
+		Path:            filepath.Join(dir, key+".lease"),
+		ExpiredDuration: expiredDuration,
+	}, nil
+}
+
+func (l *fileLease) TryGrant() (Releaser, Renewer, bool, error) {
+	var (
+		md      fileRecord
+		success bool
+	)
+	err := withFileLock(l.Path, func(record *fileRecord) (bool, error) {
+		now := time.Now()
+		// 不存在或锁过期
+		if record.Owner == "" || record.Renewed.Before(now.Add(-l.ExpiredDuration)) {
+			record.Id++
+			record.Owner = l.Owner
+			record.Renewed = now
+			md, success = *record, true
+			return true, nil
+		}
+		md, success = *record, record.Owner == l.Owner
+		return false, nil
+	})
+	if err != nil || !success {
+		return nil, nil, false, err
+	}
+	return &fileReleaser{
+		Id:    md.Id,
+		Owner: l.Owner,
+		Path:  l.Path,
+	}, &fileRenewer{
+		Id:    md.Id,
+		Owner: l.Owner,
+		Path:  l.Path,
+	}, true, nil
+}
+
+// withFileLock 持有文件排他锁读取记录 fn返回true时写回记录
+// 文件不会被删除 避免不同进程锁住不同的inode
+func withFileLock(path string, fn func(*fileRecord) (bool, error)) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	var md fileRecord
+	// 写入中途进程退出可能导致内容不完整 视为租约已释放
+	if len(content) > 0 && json.Unmarshal(content, &md) != nil {
+		md = fileRecord{}
+	}
+	write, err := fn(&md)
+	if err != nil || !write {
+		return err
+	}
+	content, err = json.Marshal(md)
+	if err != nil {
+		return err
+	}
+	if err = file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err = file.WriteAt(content, 0); err != nil {
+		return err
+	}
+	return file.Sync()
+}
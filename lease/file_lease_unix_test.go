@@ -0,0 +1,17 @@
+//go:build unix
+
+package lease
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFileLease(t *testing.T) {
+	runLeaserSuite(t, func(t *testing.T) leaserFactory {
+		dir := t.TempDir()
+		return func(owner string, d time.Duration) (Leaser, error) {
+			return NewFileLease(testLeaseKey, owner, dir, d)
+		}
+	}, suiteOpts{})
+}
@@ -3,7 +3,6 @@ package lease
 import (
 	"context"
 	"errors"
-	"strings"
 	"sync"
 	"time"
 	"xorm.io/xorm"
@@ -23,7 +22,7 @@ type Renewer interface {
 
 type DbModel struct {
 	Id       int64     `json:"id" xorm:"pk autoincr"`
-	LeaseKey string    `json:"leaseKey"`
+	LeaseKey string    `json:"leaseKey" xorm:"varchar(255) notnull unique"`
 	Owner    string    `json:"owner"`
 	Renewed  time.Time `json:"renewed"`
 	Created  time.Time `json:"created" xorm:"created"`
@@ -79,6 +78,17 @@ func (r *dbRenewer) Renew(context.Context) (bool, error) {
 	return rows == 1, err
 }
 
+// CreateDbLeaseTable 创建租约表 lease_key带唯一索引 表已存在时同步缺失的列和索引
+func CreateDbLeaseTable(engine *xorm.Engine, tableName string) error {
+	if engine == nil {
+		return errors.New("nil Engine")
+	}
+	if tableName == "" {
+		return errors.New("empty table name")
+	}
+	return engine.Table(tableName).Sync2(new(DbModel))
+}
+
 func NewDbLease(key, owner, tableName string, engine *xorm.Engine, expiredDuration time.Duration) (Leaser, error) {
 	if key == "" {
 		return nil, errors.New("empty key")
@@ -148,8 +158,8 @@ func (l *dbLease) tryGrant(session *xorm.Session) (DbModel, bool, error) {
 		// 不存在则插入
 		_, err = session.Table(l.TableName).Insert(&md)
 		if err != nil {
-			// 唯一键冲突
-			if strings.Contains(err.Error(), "Error 1062") {
+			// 唯一键冲突 其他节点已抢先插入
+			if IsUniqueViolation(l.Engine.Dialect().URI().DBType, err) {
 				return md, false, nil
 			}
 			return md, false, err
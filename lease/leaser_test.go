@@ -0,0 +1,175 @@
+package lease
+
+import (
+	"context"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"xorm.io/xorm"
+)
+
+const testLeaseKey = "test"
+
+// leaserFactory 构建同一个key不同owner的Leaser
+type leaserFactory func(owner string, expiredDuration time.Duration) (Leaser, error)
+
+// suiteOpts 一致性测试配置
+type suiteOpts struct {
+	// skipConcurrent 跳过并发抢占测试
+	skipConcurrent string
+	// coarseClock 存储的时间只精确到秒 如部分数据库
+	coarseClock bool
+}
+
+// runLeaserSuite Leaser一致性测试 newFactory每个子测试调用一次 返回互相隔离的存储
+func runLeaserSuite(t *testing.T, newFactory func(t *testing.T) leaserFactory, opts suiteOpts) {
+	mustLeaser := func(t *testing.T, factory leaserFactory, owner string, d time.Duration) Leaser {
+		l, err := factory(owner, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+	mustGrant := func(t *testing.T, l Leaser, expected bool) (Releaser, Renewer) {
+		releaser, renewer, b, err := l.TryGrant()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b != expected {
+			t.Fatalf("expect grant %v but got %v", expected, b)
+		}
+		return releaser, renewer
+	}
+	mustRenew := func(t *testing.T, renewer Renewer, expected bool) {
+		b, err := renewer.Renew(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b != expected {
+			t.Fatalf("expect renew %v but got %v", expected, b)
+		}
+	}
+	t.Run("exclusive", func(t *testing.T) {
+		factory := newFactory(t)
+		a := mustLeaser(t, factory, "a", time.Minute)
+		b := mustLeaser(t, factory, "b", time.Minute)
+		mustGrant(t, a, true)
+		mustGrant(t, b, false)
+		// 持有者重复获取成功
+		mustGrant(t, a, true)
+		mustGrant(t, mustLeaser(t, factory, "a", time.Minute), true)
+	})
+	t.Run("release", func(t *testing.T) {
+		factory := newFactory(t)
+		a := mustLeaser(t, factory, "a", time.Minute)
+		b := mustLeaser(t, factory, "b", time.Minute)
+		releaser, renewer := mustGrant(t, a, true)
+		if err := releaser.Release(); err != nil {
+			t.Fatal(err)
+		}
+		if err := releaser.Release(); err != nil {
+			t.Fatal(err)
+		}
+		mustRenew(t, renewer, false)
+		mustGrant(t, b, true)
+		mustGrant(t, a, false)
+	})
+	t.Run("renew", func(t *testing.T) {
+		factory := newFactory(t)
+		a := mustLeaser(t, factory, "a", time.Minute)
+		b := mustLeaser(t, factory, "b", time.Minute)
+		_, renewer := mustGrant(t, a, true)
+		mustRenew(t, renewer, true)
+		mustGrant(t, b, false)
+	})
+	t.Run("expire", func(t *testing.T) {
+		factory := newFactory(t)
+		a := mustLeaser(t, factory, "a", time.Second)
+		b := mustLeaser(t, factory, "b", time.Second)
+		releaser, renewer := mustGrant(t, a, true)
+		time.Sleep(1500 * time.Millisecond)
+		mustGrant(t, b, true)
+		// 过期被抢占后原持有者无法续期和释放
+		mustRenew(t, renewer, false)
+		if err := releaser.Release(); err != nil {
+			t.Fatal(err)
+		}
+		if opts.coarseClock {
+			// 时间只精确到秒 使用较长的过期时间判断b仍持有租约
+			mustGrant(t, mustLeaser(t, factory, "a", time.Minute), false)
+		} else {
+			mustGrant(t, a, false)
+		}
+	})
+	t.Run("concurrent", func(t *testing.T) {
+		if opts.skipConcurrent != "" {
+			t.Skip(opts.skipConcurrent)
+		}
+		factory := newFactory(t)
+		const contenders = 16
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			granted []string
+		)
+		for i := 0; i < contenders; i++ {
+			l := mustLeaser(t, factory, fmt.Sprintf("owner-%d", i), time.Minute)
+			wg.Add(1)
+			go func(owner string) {
+				defer wg.Done()
+				_, _, b, err := l.TryGrant()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if b {
+					mu.Lock()
+					granted = append(granted, owner)
+					mu.Unlock()
+				}
+			}(fmt.Sprintf("owner-%d", i))
+		}
+		wg.Wait()
+		if len(granted) != 1 {
+			t.Fatalf("expect exactly one owner but got %v", granted)
+		}
+	})
+}
+
+func TestMemLease(t *testing.T) {
+	runLeaserSuite(t, func(t *testing.T) leaserFactory {
+		store := NewMemLeaseStore()
+		return func(owner string, d time.Duration) (Leaser, error) {
+			return NewMemLease(testLeaseKey, owner, store, d)
+		}
+	}, suiteOpts{})
+}
+
+func TestDbLease(t *testing.T) {
+	runLeaserSuite(t, func(t *testing.T) leaserFactory {
+		engine, err := xorm.NewEngine("sqlite3", filepath.Join(t.TempDir(), "lease.db")+"?_busy_timeout=5000")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			engine.Close()
+		})
+		// 只有sqlite驱动不可用时跳过 如CGO_ENABLED=0编译
+		if err = engine.Ping(); err != nil {
+			if strings.Contains(err.Error(), "requires cgo") {
+				t.Skip("sqlite unavailable: ", err)
+			}
+			t.Fatal(err)
+		}
+		if err = CreateDbLeaseTable(engine, "lease"); err != nil {
+			t.Fatal(err)
+		}
+		return func(owner string, d time.Duration) (Leaser, error) {
+			return NewDbLease(testLeaseKey, owner, "lease", engine, d)
+		}
+	}, suiteOpts{coarseClock: true})
+}
@@ -0,0 +1,127 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// memRecord 内存中的租约记录
+type memRecord struct {
+	id      int64
+	owner   string
+	renewed time.Time
+}
+
+// MemLeaseStore 进程内的租约存储 同一个store上相同key的租约互斥
+type MemLeaseStore struct {
+	mu      sync.Mutex
+	records map[string]memRecord
+	// lastId 自增id 区分同一个owner的不同租约
+	lastId int64
+}
+
+func NewMemLeaseStore() *MemLeaseStore {
+	return &MemLeaseStore{
+		records: make(map[string]memRecord),
+	}
+}
+
+type memLease struct {
+	Key             string
+	Owner           string
+	Store           *MemLeaseStore
+	ExpiredDuration time.Duration
+}
+
+type memReleaser struct {
+	Key         string
+	Id          int64
+	Owner       string
+	Store       *MemLeaseStore
+	releaseOnce sync.Once
+}
+
+func (r *memReleaser) Release() error {
+	r.releaseOnce.Do(func() {
+		r.Store.mu.Lock()
+		defer r.Store.mu.Unlock()
+		md, ok := r.Store.records[r.Key]
+		if ok && md.id == r.Id && md.owner == r.Owner {
+			delete(r.Store.records, r.Key)
+		}
+	})
+	return nil
+}
+
+type memRenewer struct {
+	Key   string
+	Id    int64
+	Owner string
+	Store *MemLeaseStore
+}
+
+func (r *memRenewer) Renew(context.Context) (bool, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+	md, ok := r.Store.records[r.Key]
+	if !ok || md.id != r.Id || md.owner != r.Owner {
+		return false, nil
+	}
+	md.renewed = time.Now()
+	r.Store.records[r.Key] = md
+	return true, nil
+}
+
+// NewMemLease 进程内租约 用于测试和单进程内多协程的协调
+func NewMemLease(key, owner string, store *MemLeaseStore, expiredDuration time.Duration) (Leaser, error) {
+	if key == "" {
+		return nil, errors.New("empty key")
+	}
+	if owner == "" {
+		return nil, errors.New("empty owner")
+	}
+	if store == nil {
+		return nil, errors.New("nil store")
+	}
+	if expiredDuration <= 0 {
+		return nil, errors.New("wrong duration")
+	}
+	return &memLease{
+		Key:             key,
+		Owner:           owner,
+		Store:           store,
+		ExpiredDuration: expiredDuration,
+	}, nil
+}
+
+func (l *memLease) TryGrant() (Releaser, Renewer, bool, error) {
+	l.Store.mu.Lock()
+	defer l.Store.mu.Unlock()
+	now := time.Now()
+	md, ok := l.Store.records[l.Key]
+	// 不存在或锁过期
+	if !ok || md.renewed.Before(now.Add(-l.ExpiredDuration)) {
+		l.Store.lastId++
+		md = memRecord{
+			id:      l.Store.lastId,
+			owner:   l.Owner,
+			renewed: now,
+		}
+		l.Store.records[l.Key] = md
+	} else if md.owner != l.Owner {
+		return nil, nil, false, nil
+	}
+	return &memReleaser{
+		Key:   l.Key,
+		Id:    md.id,
+		Owner: l.Owner,
+		Store: l.Store,
+	}, &memRenewer{
+		Key:   l.Key,
+		Id:    md.id,
+		Owner: l.Owner,
+		Store: l.Store,
+	}, true, nil
+}
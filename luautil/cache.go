@@ -0,0 +1,221 @@
+package luautil
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"github.com/LeeZXin/zsf-utils/collections/hashmap"
+	lua "github.com/yuin/gopher-lua"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultProtoCacheSize 全局编译缓存默认大小
+	DefaultProtoCacheSize = 1024
+)
+
+// scriptHash 脚本内容hash
+type scriptHash [sha256.Size]byte
+
+// CacheStats 缓存统计
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+	// Size 当前缓存数量
+	Size int
+}
+
+// ProtoCache 编译结果缓存 key为脚本内容hash 超过大小时淘汰最久未使用的
+// 编译失败不缓存
+type ProtoCache struct {
+	cache  *hashmap.ConcurrentLinkedHashMap[scriptHash, *lua.FunctionProto]
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func NewProtoCache(maxSize int) (*ProtoCache, error) {
+	if maxSize <= 0 {
+		return nil, errors.New("maxSize should greater than 0")
+	}
+	return &ProtoCache{
+		cache: hashmap.NewConcurrentLinkedHashMapWithLimitSize[scriptHash, *lua.FunctionProto](true, maxSize),
+	}, nil
+}
+
+// Compile 编译脚本 相同内容只编译一次
+// 并发编译相同内容时可能重复编译 不会阻塞其他脚本的编译
+func (c *ProtoCache) Compile(script string) (*lua.FunctionProto, error) {
+	key := sha256.Sum256([]byte(script))
+	if proto, ok := c.cache.Get(key); ok {
+		c.hits.Add(1)
+		return proto, nil
+	}
+	c.misses.Add(1)
+	proto, err := CompileLua(script)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.Put(key, proto)
+	return proto, nil
+}
+
+func (c *ProtoCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Size:   c.cache.Size(),
+	}
+}
+
+func (c *ProtoCache) Clear() {
+	c.cache.Clear()
+}
+
+var defaultProtoCache, _ = NewProtoCache(DefaultProtoCacheSize)
+
+// GetDefaultProtoCache 全局编译缓存 CachedScript使用
+func GetDefaultProtoCache() *ProtoCache {
+	return defaultProtoCache
+}
+
+// CompileLuaCached 通过全局编译缓存编译lua脚本
+func CompileLuaCached(script string) (*lua.FunctionProto, error) {
+	return defaultProtoCache.Compile(script)
+}
+
+type resultEntry struct {
+	value    any
+	expireAt time.Time
+}
+
+// ResultCacheOpts 结果缓存配置
+type ResultCacheOpts struct {
+	MaxSize int
+	// TTL 结果有效期 为0不过期
+	TTL time.Duration
+}
+
+// ResultCache 纯脚本的结果缓存 key为脚本内容和bindings指纹
+// 只应用于结果只由params决定的脚本 执行失败不缓存
+type ResultCache struct {
+	cache  *hashmap.ConcurrentLinkedHashMap[scriptHash, resultEntry]
+	ttl    time.Duration
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func NewResultCache(opts ResultCacheOpts) (*ResultCache, error) {
+	if opts.MaxSize <= 0 {
+		return nil, errors.New("maxSize should greater than 0")
+	}
+	if opts.TTL < 0 {
+		return nil, errors.New("ttl should not be negative")
+	}
+	return &ResultCache{
+		cache: hashmap.NewConcurrentLinkedHashMapWithLimitSize[scriptHash, resultEntry](true, opts.MaxSize),
+		ttl:   opts.TTL,
+	}, nil
+}
+
+// fingerprint 脚本和bindings的指纹 bindings无法json序列化时返回false
+func fingerprint(script string, bindings Bindings) (scriptHash, bool) {
+	// json序列化map时key有序
+	data, err := json.Marshal(bindings)
+	if err != nil {
+		return scriptHash{}, false
+	}
+	h := sha256.New()
+	sh := sha256.Sum256([]byte(script))
+	h.Write(sh[:])
+	h.Write(data)
+	var ret scriptHash
+	copy(ret[:], h.Sum(nil))
+	return ret, true
+}
+
+func (c *ResultCache) get(key scriptHash) (any, bool) {
+	entry, ok := c.cache.Get(key)
+	if ok && !entry.expireAt.IsZero() && time.Now().After(entry.expireAt) {
+		c.cache.Remove(key)
+		ok = false
+	}
+	if ok {
+		c.hits.Add(1)
+		return entry.value, true
+	}
+	c.misses.Add(1)
+	return nil, false
+}
+
+func (c *ResultCache) put(key scriptHash, value any) {
+	entry := resultEntry{value: value}
+	if c.ttl > 0 {
+		entry.expireAt = time.Now().Add(c.ttl)
+	}
+	c.cache.Put(key, entry)
+}
+
+func (c *ResultCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Size:   c.cache.Size(),
+	}
+}
+
+func (c *ResultCache) Clear() {
+	c.cache.Clear()
+}
+
+// ExecutePure 执行纯脚本 返回第一个返回值的go对象
+// 脚本通过全局编译缓存编译 配置了ResultCache时结果按脚本内容和bindings缓存
+// 缓存中保存的是结果的副本 每次返回新的副本 调用方可以修改
+func (e *ScriptExecutor) ExecutePure(ctx context.Context, script string, bindings Bindings) (any, error) {
+	var (
+		key       scriptHash
+		cacheable bool
+	)
+	if e.resultCache != nil {
+		key, cacheable = fingerprint(script, bindings)
+		if cacheable {
+			if ret, ok := e.resultCache.get(key); ok {
+				return copyGoValue(ret), nil
+			}
+		}
+	}
+	proto, err := CompileLuaCached(script)
+	if err != nil {
+		return nil, err
+	}
+	res, err := e.ExecuteCtx(ctx, proto, bindings)
+	if err != nil {
+		return nil, err
+	}
+	ret := ToGoValue(res)
+	if cacheable {
+		e.resultCache.put(key, copyGoValue(ret))
+	}
+	return ret, nil
+}
+
+// copyGoValue 深拷贝ToGoValue返回的map和切片
+func copyGoValue(v any) any {
+	switch x := v.(type) {
+	case map[string]any:
+		ret := make(map[string]any, len(x))
+		for k, item := range x {
+			ret[k] = copyGoValue(item)
+		}
+		return ret
+	case []any:
+		ret := make([]any, len(x))
+		for i, item := range x {
+			ret[i] = copyGoValue(item)
+		}
+		return ret
+	default:
+		return v
+	}
+}
@@ -0,0 +1,90 @@
+package luautil
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProtoCache(t *testing.T) {
+	cache, err := NewProtoCache(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, script := range []string{"return 1", "return 2", "return 1", "return 3", "return 1", "return 2"} {
+		if _, err = cache.Compile(script); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// return 2在return 3加入时被淘汰
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 4 || stats.Size != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	// 编译失败不缓存
+	for i := 0; i < 2; i++ {
+		if _, err = cache.Compile("return +"); err == nil {
+			t.Fatal("expect compile error")
+		}
+	}
+	if stats := cache.Stats(); stats.Misses != 6 || stats.Size != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestExecutePureCache(t *testing.T) {
+	resultCache, err := NewResultCache(ResultCacheOpts{MaxSize: 2, TTL: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor, err := NewScriptExecutorWithOpts(ScriptExecutorOpts{
+		LStatePoolOpts: LStatePoolOpts{MaxSize: 1},
+		ResultCache:    resultCache,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer executor.Close()
+	script := "return {values = {params.x}}"
+	execute := func(x int) map[string]any {
+		ret, err := executor.ExecutePure(context.Background(), script, Bindings{"x": x})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ret.(map[string]any)
+	}
+	expect := map[string]any{"values": []any{float64(1)}}
+	first := execute(1)
+	// 修改返回值不影响缓存
+	first["values"].([]any)[0] = "changed"
+	first["extra"] = true
+	if second := execute(1); !reflect.DeepEqual(second, expect) {
+		t.Fatalf("expect %v but got %v", expect, second)
+	}
+	if stats := resultCache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	// 超过MaxSize淘汰最久未使用的x=2
+	execute(2)
+	execute(1)
+	execute(3)
+	execute(1)
+	execute(2)
+	if stats := resultCache.Stats(); stats.Hits != 3 || stats.Misses != 4 || stats.Size != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	time.Sleep(80 * time.Millisecond)
+	execute(2)
+	if stats := resultCache.Stats(); stats.Misses != 5 {
+		t.Fatalf("expect expired but got %+v", stats)
+	}
+	// 执行失败不缓存
+	for i := 0; i < 2; i++ {
+		if _, err = executor.ExecutePure(context.Background(), "error('x')", nil); err == nil {
+			t.Fatal("expect error")
+		}
+	}
+	if stats := resultCache.Stats(); stats.Misses != 7 {
+		t.Fatalf("expect failure not cached but got %+v", stats)
+	}
+}
@@ -0,0 +1,131 @@
+package luautil
+
+import (
+	"context"
+	"fmt"
+	lua "github.com/yuin/gopher-lua"
+	"strings"
+)
+
+// DryRunResult 试运行结果
+type DryRunResult struct {
+	// Result 脚本第一个返回值
+	Result any
+	// Read 脚本读取的params路径 按首次读取的顺序 读取了子路径的对象不再单独列出
+	Read []string
+	// Diagnostics 脚本检查结果
+	Diagnostics []Diagnostic
+}
+
+// readTracker 通过元表记录params的读取路径
+type readTracker struct {
+	paths   []string
+	seen    map[string]bool
+	proxies map[string]*lua.LTable
+}
+
+func newReadTracker() *readTracker {
+	return &readTracker{
+		seen:    make(map[string]bool),
+		proxies: make(map[string]*lua.LTable),
+	}
+}
+
+func (t *readTracker) record(path string) {
+	if !t.seen[path] {
+		t.seen[path] = true
+		t.paths = append(t.paths, path)
+	}
+}
+
+// proxy 构建空table 通过__index返回data中的数据并记录路径 同一路径返回同一个table
+func (t *readTracker) proxy(L *lua.LState, prefix string, data map[string]any) *lua.LTable {
+	if ret, ok := t.proxies[prefix]; ok {
+		return ret
+	}
+	ret := L.NewTable()
+	mt := L.NewTable()
+	mt.RawSetString("__index", L.NewFunction(func(L *lua.LState) int {
+		key := L.Get(2).String()
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		t.record(path)
+		switch v := data[key].(type) {
+		case map[string]any:
+			L.Push(t.proxy(L, path, v))
+		default:
+			L.Push(FromGoValue(v, L))
+		}
+		return 1
+	}))
+	L.SetMetatable(ret, mt)
+	t.proxies[prefix] = ret
+	return ret
+}
+
+// result 读取路径 去掉作为其他路径前缀的对象路径
+func (t *readTracker) result() []string {
+	ret := make([]string, 0, len(t.paths))
+	for _, path := range t.paths {
+		prefix := path + "."
+		covered := false
+		for _, other := range t.paths {
+			if strings.HasPrefix(other, prefix) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			ret = append(ret, path)
+		}
+	}
+	return ret
+}
+
+// DryRun 使用样例数据试运行脚本 返回结果和读取的params路径
+// 使用独立的LState和环境table执行 不影响池中的LState
+// params中的对象通过元表代理 对其使用pairs、next或rawget时获取不到数据
+func (e *ScriptExecutor) DryRun(ctx context.Context, script string, bindings Bindings) (*DryRunResult, error) {
+	ret := &DryRunResult{
+		Diagnostics: e.Lint(script),
+	}
+	proto, err := CompileLua(script)
+	if err != nil {
+		return ret, err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+	L := e.pool.createLState()
+	defer L.Close()
+	if ctx.Done() != nil {
+		L.SetContext(ctx)
+	}
+	if bindings == nil {
+		bindings = NewBindings()
+	}
+	// 统一转换为map[string]any和[]any
+	data, _ := ToGoValue(bindings.ToLTable(L)).(map[string]any)
+	tracker := newReadTracker()
+	args, err, _ := safeExecute(func() ([]lua.LValue, error) {
+		return executeWithParams(L, proto, tracker.proxy(L, "", data), true)
+	})
+	ret.Read = tracker.result()
+	if err != nil {
+		if limitErr := limitError(ctx, e.timeout, err); limitErr != nil {
+			err = limitErr
+		}
+		return ret, fmt.Errorf("dry run failed: %w", err)
+	}
+	if len(args) > 0 {
+		ret.Result = ToGoValue(args[0])
+	}
+	return ret, nil
+}
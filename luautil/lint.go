@@ -0,0 +1,392 @@
+package luautil
+
+import (
+	"errors"
+	"fmt"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/ast"
+	"github.com/yuin/gopher-lua/parse"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic 脚本检查结果 Line和Column从1开始 为0表示未知
+type Diagnostic struct {
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d %s: %s", d.Line, d.Column, d.Severity, d.Message)
+}
+
+// LintOpts 脚本检查配置
+type LintOpts struct {
+	// Globals 除params和已开放的库之外允许使用的全局变量 如注册的go函数
+	Globals []string
+	// Libs 开放的库 为nil使用DefaultLibs
+	Libs []string
+	// AllowUnsafeBaseFuncs 是否允许dofile、loadfile、load、loadstring
+	AllowUnsafeBaseFuncs bool
+	// Modules 可通过require加载的模块
+	Modules *ModuleRegistry
+}
+
+var (
+	libGlobalsOnce sync.Once
+	// libGlobals 每个库定义的全局变量
+	libGlobals map[string][]string
+)
+
+// getLibGlobals 通过只打开单个库的LState获取库定义的全局变量
+func getLibGlobals() map[string][]string {
+	libGlobalsOnce.Do(func() {
+		libGlobals = make(map[string][]string, len(libOpeners))
+		for name := range libOpeners {
+			L, _ := newSandboxState(SandboxOpts{
+				Libs:                 []string{name},
+				AllowUnsafeBaseFuncs: true,
+			})
+			names := make([]string, 0)
+			L.G.Global.ForEach(func(key, _ lua.LValue) {
+				names = append(names, key.String())
+			})
+			L.Close()
+			libGlobals[name] = names
+		}
+	})
+	return libGlobals
+}
+
+// DiagnosticOf 将CompileLua的错误转换为Diagnostic 在EOF处的错误Line为0
+func DiagnosticOf(err error) (Diagnostic, bool) {
+	var (
+		parseErr   *parse.Error
+		compileErr *lua.CompileError
+	)
+	switch {
+	case errors.As(err, &parseErr):
+		ret := Diagnostic{
+			Line:     parseErr.Pos.Line,
+			Column:   parseErr.Pos.Column,
+			Severity: SeverityError,
+			Message:  parseErr.Message,
+		}
+		if ret.Line == parse.EOF {
+			ret.Line, ret.Column = 0, 0
+			ret.Message += " at EOF"
+		} else if parseErr.Token != "" {
+			ret.Message = fmt.Sprintf("%s near '%s'", ret.Message, parseErr.Token)
+		}
+		return ret, true
+	case errors.As(err, &compileErr):
+		return Diagnostic{
+			Line:     compileErr.Line,
+			Severity: SeverityError,
+			Message:  compileErr.Message,
+		}, true
+	}
+	return Diagnostic{}, false
+}
+
+// compileDiagnostic 编译错误转换为Diagnostic 在EOF处的错误定位到最后一行
+func compileDiagnostic(err error, script string) Diagnostic {
+	d, ok := DiagnosticOf(err)
+	if !ok {
+		return Diagnostic{Severity: SeverityError, Message: err.Error()}
+	}
+	if d.Line == 0 {
+		d.Line = strings.Count(script, "\n") + 1
+	}
+	return d
+}
+
+// Lint 检查脚本 返回语法错误 以及未定义的全局变量、未开放的库和未注册的模块
+// 语法错误时只返回该错误
+func Lint(script string, opts LintOpts) []Diagnostic {
+	chunk, err := parse.Parse(strings.NewReader(script), "<script>")
+	if err == nil {
+		_, err = lua.Compile(chunk, "<script>")
+	}
+	if err != nil {
+		return []Diagnostic{compileDiagnostic(err, script)}
+	}
+	l := newLinter(opts)
+	l.block(chunk, nil)
+	return l.result()
+}
+
+type globalRef struct {
+	name string
+	line int
+}
+
+type linter struct {
+	// allowed 允许读取的全局变量
+	allowed map[string]bool
+	// denied 未开放库或不安全函数的全局变量 值为提示信息
+	denied  map[string]string
+	modules *ModuleRegistry
+	scopes  []map[string]bool
+	// assigned 脚本中赋值过的全局变量
+	assigned map[string]bool
+	reads    []globalRef
+	diags    []Diagnostic
+}
+
+func newLinter(opts LintOpts) *linter {
+	libs := opts.Libs
+	if libs == nil {
+		libs = DefaultLibs
+	}
+	l := &linter{
+		allowed:  map[string]bool{"params": true},
+		denied:   make(map[string]string),
+		modules:  opts.Modules,
+		assigned: make(map[string]bool),
+	}
+	all := getLibGlobals()
+	for name, globals := range all {
+		for _, g := range globals {
+			l.denied[g] = fmt.Sprintf("library '%s' is not allowed", name)
+		}
+	}
+	for _, lib := range libs {
+		for _, g := range all[lib] {
+			delete(l.denied, g)
+			l.allowed[g] = true
+		}
+	}
+	if !opts.AllowUnsafeBaseFuncs {
+		for _, fn := range unsafeBaseFuncs {
+			if l.allowed[fn] {
+				delete(l.allowed, fn)
+				l.denied[fn] = fmt.Sprintf("'%s' is not allowed", fn)
+			}
+		}
+	}
+	if opts.Modules != nil {
+		l.allowed["require"] = true
+		delete(l.denied, "require")
+	}
+	for _, g := range opts.Globals {
+		l.allowed[g] = true
+		delete(l.denied, g)
+	}
+	return l
+}
+
+func (l *linter) warn(line int, format string, args ...any) {
+	l.diags = append(l.diags, Diagnostic{
+		Line:     line,
+		Severity: SeverityWarning,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) result() []Diagnostic {
+	reported := make(map[string]bool)
+	for _, ref := range l.reads {
+		if l.assigned[ref.name] || l.allowed[ref.name] {
+			continue
+		}
+		// 每个变量只报告第一次
+		if reported[ref.name] {
+			continue
+		}
+		reported[ref.name] = true
+		if msg, ok := l.denied[ref.name]; ok {
+			l.warn(ref.line, "%s", msg)
+		} else {
+			l.warn(ref.line, "undefined global '%s'", ref.name)
+		}
+	}
+	sort.SliceStable(l.diags, func(i, j int) bool {
+		return l.diags[i].Line < l.diags[j].Line
+	})
+	return l.diags
+}
+
+func (l *linter) declare(names ...string) {
+	scope := l.scopes[len(l.scopes)-1]
+	for _, name := range names {
+		scope[name] = true
+	}
+}
+
+func (l *linter) isLocal(name string) bool {
+	for i := len(l.scopes) - 1; i >= 0; i-- {
+		if l.scopes[i][name] {
+			return true
+		}
+	}
+	return false
+}
+
+// block 在新作用域中检查语句 locals为作用域内预先定义的变量
+func (l *linter) block(stmts []ast.Stmt, locals []string) {
+	l.scopes = append(l.scopes, make(map[string]bool))
+	l.declare(locals...)
+	l.stmts(stmts)
+	l.scopes = l.scopes[:len(l.scopes)-1]
+}
+
+func (l *linter) stmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		l.stmt(stmt)
+	}
+}
+
+func (l *linter) stmt(stmt ast.Stmt) {
+	switch s := stmt.(type) {
+	case *ast.AssignStmt:
+		l.exprs(s.Rhs)
+		for _, lhs := range s.Lhs {
+			l.assign(lhs)
+		}
+	case *ast.LocalAssignStmt:
+		// local function f() 函数体内可以引用f
+		if len(s.Exprs) == 1 {
+			if _, ok := s.Exprs[0].(*ast.FunctionExpr); ok {
+				l.declare(s.Names...)
+			}
+		}
+		l.exprs(s.Exprs)
+		l.declare(s.Names...)
+	case *ast.FuncCallStmt:
+		l.expr(s.Expr)
+	case *ast.DoBlockStmt:
+		l.block(s.Stmts, nil)
+	case *ast.WhileStmt:
+		l.expr(s.Condition)
+		l.block(s.Stmts, nil)
+	case *ast.RepeatStmt:
+		// until条件可以引用循环体内的local
+		l.scopes = append(l.scopes, make(map[string]bool))
+		l.stmts(s.Stmts)
+		l.expr(s.Condition)
+		l.scopes = l.scopes[:len(l.scopes)-1]
+	case *ast.IfStmt:
+		l.expr(s.Condition)
+		l.block(s.Then, nil)
+		l.block(s.Else, nil)
+	case *ast.NumberForStmt:
+		l.expr(s.Init)
+		l.expr(s.Limit)
+		if s.Step != nil {
+			l.expr(s.Step)
+		}
+		l.block(s.Stmts, []string{s.Name})
+	case *ast.GenericForStmt:
+		l.exprs(s.Exprs)
+		l.block(s.Stmts, s.Names)
+	case *ast.FuncDefStmt:
+		if s.Name.Func != nil {
+			l.assign(s.Name.Func)
+		}
+		var self []string
+		if s.Name.Receiver != nil {
+			l.expr(s.Name.Receiver)
+			self = []string{"self"}
+		}
+		l.function(s.Func, self...)
+	case *ast.ReturnStmt:
+		l.exprs(s.Exprs)
+	}
+}
+
+// assign 赋值目标 未定义为local的变量视为全局变量
+func (l *linter) assign(expr ast.Expr) {
+	switch e := expr.(type) {
+	case *ast.IdentExpr:
+		if !l.isLocal(e.Value) {
+			l.assigned[e.Value] = true
+		}
+	default:
+		l.expr(expr)
+	}
+}
+
+func (l *linter) function(fn *ast.FunctionExpr, extra ...string) {
+	locals := append(extra, fn.ParList.Names...)
+	l.block(fn.Stmts, locals)
+}
+
+func (l *linter) exprs(exprs []ast.Expr) {
+	for _, expr := range exprs {
+		l.expr(expr)
+	}
+}
+
+func (l *linter) expr(expr ast.Expr) {
+	switch e := expr.(type) {
+	case *ast.IdentExpr:
+		if !l.isLocal(e.Value) {
+			l.reads = append(l.reads, globalRef{name: e.Value, line: e.Line()})
+		}
+	case *ast.AttrGetExpr:
+		l.expr(e.Object)
+		l.expr(e.Key)
+	case *ast.TableExpr:
+		for _, field := range e.Fields {
+			if field.Key != nil {
+				l.expr(field.Key)
+			}
+			l.expr(field.Value)
+		}
+	case *ast.FuncCallExpr:
+		if e.Func != nil {
+			l.expr(e.Func)
+		}
+		if e.Receiver != nil {
+			l.expr(e.Receiver)
+		}
+		l.exprs(e.Args)
+		l.checkRequire(e)
+	case *ast.LogicalOpExpr:
+		l.expr(e.Lhs)
+		l.expr(e.Rhs)
+	case *ast.RelationalOpExpr:
+		l.expr(e.Lhs)
+		l.expr(e.Rhs)
+	case *ast.StringConcatOpExpr:
+		l.expr(e.Lhs)
+		l.expr(e.Rhs)
+	case *ast.ArithmeticOpExpr:
+		l.expr(e.Lhs)
+		l.expr(e.Rhs)
+	case *ast.UnaryMinusOpExpr:
+		l.expr(e.Expr)
+	case *ast.UnaryNotOpExpr:
+		l.expr(e.Expr)
+	case *ast.UnaryLenOpExpr:
+		l.expr(e.Expr)
+	case *ast.FunctionExpr:
+		l.function(e)
+	}
+}
+
+// checkRequire require的模块未注册时告警
+func (l *linter) checkRequire(call *ast.FuncCallExpr) {
+	ident, ok := call.Func.(*ast.IdentExpr)
+	if !ok || ident.Value != "require" || l.isLocal("require") || l.modules == nil || len(call.Args) != 1 {
+		return
+	}
+	name, ok := call.Args[0].(*ast.StringExpr)
+	if !ok {
+		return
+	}
+	if _, ok = l.modules.Get(name.Value); !ok {
+		l.warn(call.Line(), "module '%s' is not registered", name.Value)
+	}
+}
@@ -0,0 +1,107 @@
+package luautil
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	modules := NewStdModuleRegistry()
+	tests := []struct {
+		name   string
+		script string
+		opts   LintOpts
+		expect []string
+	}{
+		{
+			name:   "undefined global",
+			script: "local a = 1\nreturn a + b",
+			expect: []string{"2:0 warning: undefined global 'b'"},
+		},
+		{
+			name:   "registered global",
+			script: "return fn(params.x)",
+			opts:   LintOpts{Globals: []string{"fn"}},
+		},
+		{
+			name:   "denied lib",
+			script: "return os.time()",
+			expect: []string{"1:0 warning: library 'os' is not allowed"},
+		},
+		{
+			name:   "unsafe base func",
+			script: "return load('return 1')",
+			expect: []string{"1:0 warning: 'load' is not allowed"},
+		},
+		{
+			name:   "unregistered module",
+			script: "local json = require('json')\nlocal x = require('missing')",
+			opts:   LintOpts{Modules: modules},
+			expect: []string{"2:0 warning: module 'missing' is not registered"},
+		},
+		{
+			name:   "local shadowing",
+			script: "local os = {}\nlocal function f(string) return string end\nreturn os, f",
+		},
+		{
+			name:   "local out of scope",
+			script: "do local a = 1 end\nreturn a",
+			expect: []string{"2:0 warning: undefined global 'a'"},
+		},
+		{
+			name:   "repeat until scope",
+			script: "repeat local done = true until done\nreturn done",
+			expect: []string{"2:0 warning: undefined global 'done'"},
+		},
+		{
+			name:   "assigned global",
+			script: "total = 1\nreturn total",
+		},
+		{
+			name:   "parse error",
+			script: "local a = 1\nif a then\nreturn a",
+			expect: []string{"3:0 error: syntax error at EOF"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := make([]string, 0)
+			for _, d := range Lint(test.script, test.opts) {
+				got = append(got, d.String())
+			}
+			if len(got) != len(test.expect) || (len(got) > 0 && !reflect.DeepEqual(got, test.expect)) {
+				t.Fatalf("expect %v but got %v", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	executor := newSandboxExecutor(t, SandboxOpts{})
+	ret, err := executor.DryRun(context.Background(), `
+		local user = params.user
+		if user.age > 18 then
+			return user.name .. params.a.b
+		end
+		return params.a
+	`, Bindings{
+		"user": map[string]any{"age": 20, "name": "x", "tags": []any{"t"}},
+		"a":    map[string]any{"b": "y"},
+		"c":    1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.Result != "xy" {
+		t.Fatalf("unexpected result %v", ret.Result)
+	}
+	// 读取了子路径的user和a不单独列出
+	if expect := []string{"user.age", "user.name", "a.b"}; !reflect.DeepEqual(ret.Read, expect) {
+		t.Fatalf("expect read %v but got %v", expect, ret.Read)
+	}
+	ret, err = executor.DryRun(context.Background(), "return params.x +", nil)
+	if err == nil || len(ret.Diagnostics) != 1 || ret.Diagnostics[0].Line != 1 {
+		t.Fatalf("expect compile error but got %v %v", ret, err)
+	}
+}
@@ -0,0 +1,382 @@
+package luautil
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	InvalidPathError = errors.New("invalid path")
+
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+	// structFieldsCache 结构体字段信息缓存 reflect.Type -> []structField
+	structFieldsCache sync.Map
+)
+
+// structField 结构体字段映射信息
+type structField struct {
+	// name 映射后的名称 优先使用lua tag 其次json tag 都没有使用字段名
+	name string
+	// goName 字段名
+	goName string
+	index  int
+	typ    reflect.Type
+	// inline 无tag的匿名结构体 字段展开到上一层
+	inline bool
+}
+
+// structFields 获取结构体可映射的字段
+func structFields(t reflect.Type) []structField {
+	if v, ok := structFieldsCache.Load(t); ok {
+		return v.([]structField)
+	}
+	ret := make([]structField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		tag, ok := f.Tag.Lookup("lua")
+		if !ok {
+			tag = f.Tag.Get("json")
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if name == "" && f.Anonymous {
+			if ft.Kind() == reflect.Struct {
+				ret = append(ret, structField{goName: f.Name, index: i, typ: f.Type, inline: true})
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		ret = append(ret, structField{name: name, goName: f.Name, index: i, typ: f.Type})
+	}
+	structFieldsCache.Store(t, ret)
+	return ret
+}
+
+// toPlainValue 将结构体转换为map[string]any 切片转换为[]any
+// 实现encoding.TextMarshaler的结构体转换为字符串 如time.Time
+func toPlainValue(r reflect.Value) any {
+	for r.Kind() == reflect.Pointer || r.Kind() == reflect.Interface {
+		if r.IsNil() {
+			return nil
+		}
+		r = r.Elem()
+	}
+	switch r.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Struct:
+		if r.Type().Implements(textMarshalerType) {
+			text, err := r.Interface().(encoding.TextMarshaler).MarshalText()
+			if err == nil {
+				return string(text)
+			}
+		}
+		ret := make(map[string]any, r.NumField())
+		putStructFields(r, ret)
+		return ret
+	case reflect.Map:
+		ret := make(map[string]any, r.Len())
+		iter := r.MapRange()
+		for iter.Next() {
+			ret[fmt.Sprint(iter.Key().Interface())] = toPlainValue(iter.Value())
+		}
+		return ret
+	case reflect.Slice, reflect.Array:
+		if r.Kind() == reflect.Slice && r.IsNil() {
+			return nil
+		}
+		ret := make([]any, r.Len())
+		for i := 0; i < r.Len(); i++ {
+			ret[i] = toPlainValue(r.Index(i))
+		}
+		return ret
+	default:
+		return r.Interface()
+	}
+}
+
+func putStructFields(r reflect.Value, ret map[string]any) {
+	for _, f := range structFields(r.Type()) {
+		fv := r.Field(f.index)
+		if f.inline {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			putStructFields(fv, ret)
+			continue
+		}
+		ret[f.name] = toPlainValue(fv)
+	}
+}
+
+// NewBindingsFromStruct 通过结构体或map构建Bindings 字段名优先使用lua tag 其次json tag
+func NewBindingsFromStruct(v any) (Bindings, error) {
+	m, ok := toPlainValue(reflect.ValueOf(v)).(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("can not convert %T to bindings", v)
+	}
+	return m, nil
+}
+
+// Decode 将Bindings解析到结构体 out需为非nil指针 字段名规则同NewBindingsFromStruct
+// 数值、字符串、布尔值之间弱类型转换
+func Decode(bindings Bindings, out any) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("out should be a non-nil pointer")
+	}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		WeaklyTypedInput: true,
+		Result:           out,
+		// 已按tag将key转换为字段名 使用不存在的tag名按字段名匹配
+		TagName:    "luautil",
+		DecodeHook: textUnmarshalHook,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(renameKeys(map[string]any(bindings), rv.Type().Elem()))
+}
+
+// textUnmarshalHook 字符串转换为实现encoding.TextUnmarshaler的类型 如time.Time
+func textUnmarshalHook(from reflect.Type, to reflect.Type, data any) (any, error) {
+	if from.Kind() != reflect.String || !reflect.PointerTo(to).Implements(textUnmarshalerType) {
+		return data, nil
+	}
+	ret := reflect.New(to)
+	if err := ret.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(data.(string))); err != nil {
+		return nil, err
+	}
+	return ret.Elem().Interface(), nil
+}
+
+// renameKeys 按目标类型将tag名称的key转换为字段名
+func renameKeys(data any, t reflect.Type) any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if data == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(data)
+	switch t.Kind() {
+	case reflect.Struct:
+		if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+			return data
+		}
+		ret := make(map[string]any, rv.Len())
+		for _, f := range structFields(t) {
+			if f.inline {
+				if t.Field(f.index).IsExported() {
+					ret[f.goName] = renameKeys(data, f.typ)
+				}
+				continue
+			}
+			v := rv.MapIndex(reflect.ValueOf(f.name).Convert(rv.Type().Key()))
+			if v.IsValid() {
+				ret[f.goName] = renameKeys(v.Interface(), f.typ)
+			}
+		}
+		return ret
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return data
+		}
+		ret := make([]any, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			ret[i] = renameKeys(rv.Index(i).Interface(), t.Elem())
+		}
+		return ret
+	case reflect.Map:
+		if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+			return data
+		}
+		ret := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			ret[iter.Key().String()] = renameKeys(iter.Value().Interface(), t.Elem())
+		}
+		return ret
+	default:
+		return data
+	}
+}
+
+// pathToken 路径中的一段 key或数组下标
+type pathToken struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parsePath 解析路径 如items[0].price
+func parsePath(path string) ([]pathToken, error) {
+	ret := make([]pathToken, 0, 4)
+	for _, seg := range strings.Split(path, ".") {
+		key, rest := seg, ""
+		if i := strings.IndexByte(seg, '['); i >= 0 {
+			key, rest = seg[:i], seg[i:]
+		}
+		if key == "" && (rest == "" || len(ret) == 0) {
+			return nil, fmt.Errorf("%w: %s", InvalidPathError, path)
+		}
+		if key != "" {
+			ret = append(ret, pathToken{key: key})
+		}
+		for rest != "" {
+			end := strings.IndexByte(rest, ']')
+			if rest[0] != '[' || end < 0 {
+				return nil, fmt.Errorf("%w: %s", InvalidPathError, path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("%w: %s", InvalidPathError, path)
+			}
+			ret = append(ret, pathToken{index: index, isIndex: true})
+			rest = rest[end+1:]
+		}
+	}
+	return ret, nil
+}
+
+// getChild 获取map、结构体的字段或数组的元素
+func getChild(data any, token pathToken) (any, bool) {
+	r := reflect.ValueOf(data)
+	for r.Kind() == reflect.Pointer || r.Kind() == reflect.Interface {
+		if r.IsNil() {
+			return nil, false
+		}
+		r = r.Elem()
+	}
+	if token.isIndex {
+		if (r.Kind() == reflect.Slice || r.Kind() == reflect.Array) && token.index < r.Len() {
+			return r.Index(token.index).Interface(), true
+		}
+		return nil, false
+	}
+	switch r.Kind() {
+	case reflect.Map:
+		if r.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		v := r.MapIndex(reflect.ValueOf(token.key).Convert(r.Type().Key()))
+		if !v.IsValid() {
+			return nil, false
+		}
+		return v.Interface(), true
+	case reflect.Struct:
+		return getStructField(r, token.key)
+	}
+	return nil, false
+}
+
+func getStructField(r reflect.Value, name string) (any, bool) {
+	for _, f := range structFields(r.Type()) {
+		fv := r.Field(f.index)
+		if f.inline {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if v, ok := getStructField(fv, name); ok {
+				return v, true
+			}
+			continue
+		}
+		if f.name == name {
+			return fv.Interface(), true
+		}
+	}
+	return nil, false
+}
+
+// setChild 按路径设置值 返回设置后的data 数组追加元素时会返回新的切片
+func setChild(data any, tokens []pathToken, val any) (any, error) {
+	token := tokens[0]
+	newVal := val
+	if len(tokens) > 1 {
+		child, ok := getChild(data, token)
+		if !ok || child == nil {
+			child = newContainer(tokens[1])
+		}
+		var err error
+		newVal, err = setChild(child, tokens[1:], val)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r := reflect.ValueOf(data)
+	if token.isIndex {
+		if r.Kind() != reflect.Slice {
+			return nil, fmt.Errorf("can not set index on %T", data)
+		}
+		elem, err := assignableValue(newVal, r.Type().Elem())
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case token.index < r.Len():
+			r.Index(token.index).Set(elem)
+			return data, nil
+		case token.index == r.Len():
+			return reflect.Append(r, elem).Interface(), nil
+		default:
+			return nil, fmt.Errorf("index %d out of range [0:%d]", token.index, r.Len())
+		}
+	}
+	if r.Kind() != reflect.Map || r.Type().Key().Kind() != reflect.String || r.IsNil() {
+		return nil, fmt.Errorf("can not set key %s on %T", token.key, data)
+	}
+	elem, err := assignableValue(newVal, r.Type().Elem())
+	if err != nil {
+		return nil, err
+	}
+	r.SetMapIndex(reflect.ValueOf(token.key).Convert(r.Type().Key()), elem)
+	return data, nil
+}
+
+// newContainer 中间节点不存在时创建
+func newContainer(next pathToken) any {
+	if next.isIndex {
+		return make([]any, 0)
+	}
+	return make(map[string]any)
+}
+
+func assignableValue(v any, t reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		return reflect.Zero(t), nil
+	}
+	r := reflect.ValueOf(v)
+	if !r.Type().AssignableTo(t) {
+		return reflect.Value{}, fmt.Errorf("can not assign %T to %s", v, t)
+	}
+	return r, nil
+}
@@ -0,0 +1,149 @@
+package luautil
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mappingItem struct {
+	Name  string  `json:"name"`
+	Price float64 `lua:"price" json:"cost"`
+}
+
+type MappingBase struct {
+	Id int64 `json:"id"`
+}
+
+type mappingOrder struct {
+	MappingBase
+	Items   []mappingItem     `json:"items"`
+	Buyer   *mappingItem      `json:"buyer"`
+	Tags    map[string]string `json:"tags"`
+	Created time.Time         `json:"created"`
+	Ignored string            `json:"-"`
+}
+
+func TestBindingsGet(t *testing.T) {
+	bindings := Bindings{
+		"items": []any{map[string]any{"price": 1.5}},
+		"order": mappingOrder{Items: []mappingItem{{Name: "a", Price: 2}}},
+		"nil":   nil,
+		"typed": map[string]int{"x": 1},
+	}
+	tests := []struct {
+		path   string
+		expect any
+		ok     bool
+	}{
+		{"items[0].price", 1.5, true},
+		{"items[1].price", nil, false},
+		{"items.price", nil, false},
+		{"order.items[0].price", float64(2), true},
+		{"order.items[0].Name", nil, false},
+		{"order.id", int64(0), true},
+		{"nil.x", nil, false},
+		{"typed.x", 1, true},
+		{"items[x]", nil, false},
+		{"items[-1]", nil, false},
+		{".x", nil, false},
+	}
+	for _, test := range tests {
+		got, ok := bindings.Get(test.path)
+		if ok != test.ok || !reflect.DeepEqual(got, test.expect) {
+			t.Fatalf("get %s expect %v %v but got %v %v", test.path, test.expect, test.ok, got, ok)
+		}
+	}
+}
+
+func TestBindingsSetPath(t *testing.T) {
+	tests := []struct {
+		path string
+		val  any
+		// err 不为空时期待错误信息包含err
+		err string
+	}{
+		{path: "a.b.c", val: 1},
+		{path: "items[0].price", val: 2.5},
+		{path: "items[0].price", val: 3.5},
+		{path: "items[1]", val: map[string]any{"price": 1}},
+		{path: "items[3]", val: 1, err: "index 3 out of range [0:2]"},
+		{path: "a.b[0]", val: 1, err: "can not set index on"},
+		{path: "typed.x", val: "s", err: "can not assign string to int"},
+		{path: "a..b", val: 1, err: InvalidPathError.Error()},
+	}
+	bindings := Bindings{"typed": map[string]int{"x": 1}}
+	for _, test := range tests {
+		err := bindings.SetPath(test.path, test.val)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("set %s expect error %s but got %v", test.path, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("set %s: %v", test.path, err)
+		}
+		if got, _ := bindings.Get(test.path); !reflect.DeepEqual(got, test.val) {
+			t.Fatalf("set %s expect %v but got %v", test.path, test.val, got)
+		}
+	}
+	if _, err := parsePath("a[0"); !errors.Is(err, InvalidPathError) {
+		t.Fatalf("expect invalid path but got %v", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	order := mappingOrder{
+		MappingBase: MappingBase{Id: 1},
+		Items:       []mappingItem{{Name: "a", Price: 1.5}, {Name: "b", Price: 2}},
+		Buyer:       &mappingItem{Name: "u"},
+		Tags:        map[string]string{"k": "v"},
+		Created:     created,
+		Ignored:     "x",
+	}
+	bindings, err := NewBindingsFromStruct(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bindings["Ignored"]; ok {
+		t.Fatal("expect ignored field skipped")
+	}
+	if price, _ := bindings.Get("items[1].price"); price != float64(2) {
+		t.Fatalf("expect lua tag used but got %v", bindings)
+	}
+	var decoded mappingOrder
+	if err = bindings.Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	order.Ignored = ""
+	if !reflect.DeepEqual(decoded, order) {
+		t.Fatalf("expect %+v but got %+v", order, decoded)
+	}
+	// 弱类型转换
+	if err = (Bindings{"id": "2", "items": []any{map[string]any{"price": "3"}}}).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Id != 2 || decoded.Items[0].Price != 3 {
+		t.Fatalf("unexpected decoded %+v", decoded)
+	}
+	tests := []struct {
+		name     string
+		bindings Bindings
+		out      any
+	}{
+		{"non pointer", Bindings{}, mappingOrder{}},
+		{"nil pointer", Bindings{}, (*mappingOrder)(nil)},
+		{"type mismatch", Bindings{"items": "x"}, &mappingOrder{}},
+		{"bad number", Bindings{"id": "x"}, &mappingOrder{}},
+		{"bad time", Bindings{"created": "x"}, &mappingOrder{}},
+	}
+	for _, test := range tests {
+		if err = Decode(test.bindings, test.out); err == nil {
+			t.Fatalf("%s: expect error", test.name)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package luautil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cast"
+	lua "github.com/yuin/gopher-lua"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// loadedKey registry中已加载模块table的key 和gopher-lua的package库一致
+const loadedKey = "_LOADED"
+
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	lvalueType  = reflect.TypeOf((*lua.LValue)(nil)).Elem()
+)
+
+// Module go模块 lua中通过require(name)加载
+type Module struct {
+	Name  string
+	Funcs map[string]lua.LGFunction
+}
+
+// NewModule 构建模块 funcs的值可以是lua.LGFunction或任意go函数
+// go函数的参数和返回值通过ToGoValue和FromGoValue自动转换
+// 最后一个返回值为error且不为nil时 抛出lua错误
+// 第一个参数为context.Context时 传入LState绑定的context
+func NewModule(name string, funcs map[string]any) (*Module, error) {
+	if name == "" {
+		return nil, errors.New("empty module name")
+	}
+	ret := &Module{
+		Name:  name,
+		Funcs: make(map[string]lua.LGFunction, len(funcs)),
+	}
+	for fnName, fn := range funcs {
+		wrapped, err := WrapFunc(fn)
+		if err != nil {
+			return nil, fmt.Errorf("module %s func %s: %w", name, fnName, err)
+		}
+		ret.Funcs[fnName] = wrapped
+	}
+	return ret, nil
+}
+
+// MustNewModule 构建模块 出错panic
+func MustNewModule(name string, funcs map[string]any) *Module {
+	ret, err := NewModule(name, funcs)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// loader 模块加载函数 返回模块table
+func (m *Module) loader(L *lua.LState) int {
+	L.Push(L.SetFuncs(L.NewTable(), m.Funcs))
+	return 1
+}
+
+// ModuleRegistry 模块注册中心
+// LState创建时预加载已注册的模块 之后注册的模块只对新创建的LState生效
+type ModuleRegistry struct {
+	mu      sync.RWMutex
+	modules map[string]*Module
+}
+
+func NewModuleRegistry() *ModuleRegistry {
+	return &ModuleRegistry{
+		modules: make(map[string]*Module),
+	}
+}
+
+// Register 注册模块 名称重复返回错误
+func (r *ModuleRegistry) Register(modules ...*Module) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range modules {
+		if m == nil {
+			return errors.New("nil module")
+		}
+		if _, ok := r.modules[m.Name]; ok {
+			return errors.New("duplicated module: " + m.Name)
+		}
+	}
+	for _, m := range modules {
+		r.modules[m.Name] = m
+	}
+	return nil
+}
+
+// RegisterFuncs 通过go函数注册模块
+func (r *ModuleRegistry) RegisterFuncs(name string, funcs map[string]any) error {
+	m, err := NewModule(name, funcs)
+	if err != nil {
+		return err
+	}
+	return r.Register(m)
+}
+
+func (r *ModuleRegistry) Get(name string) (*Module, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.modules[name]
+	return m, ok
+}
+
+// Names 已注册的模块名称
+func (r *ModuleRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ret := make([]string, 0, len(r.modules))
+	for name := range r.modules {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (r *ModuleRegistry) snapshot() map[string]*Module {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ret := make(map[string]*Module, len(r.modules))
+	for name, m := range r.modules {
+		ret[name] = m
+	}
+	return ret
+}
+
+// preload 预加载模块到LState
+// 打开了package库时使用package.preload 否则注册只能加载模块的require函数
+func (r *ModuleRegistry) preload(L *lua.LState) {
+	modules := r.snapshot()
+	if len(modules) == 0 {
+		return
+	}
+	if pkg, ok := L.GetGlobal("package").(*lua.LTable); ok && pkg.RawGetString("preload") != lua.LNil {
+		for name, m := range modules {
+			L.PreloadModule(name, m.loader)
+		}
+		return
+	}
+	// 和package库一样缓存在registry的_LOADED中 便于池复用时统一恢复
+	loaded, ok := L.FindTable(L.G.Registry, loadedKey, 0).(*lua.LTable)
+	if !ok {
+		loaded = L.NewTable()
+		L.G.Registry.RawSetString(loadedKey, loaded)
+	}
+	L.SetGlobal("require", L.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		if v := loaded.RawGetString(name); v != lua.LNil {
+			L.Push(v)
+			return 1
+		}
+		m, ok := modules[name]
+		if !ok {
+			L.RaiseError("module %s not found", name)
+			return 0
+		}
+		L.Push(L.NewFunction(m.loader))
+		L.Call(0, 1)
+		ret := L.Get(-1)
+		loaded.RawSetString(name, ret)
+		return 1
+	}))
+}
+
+// WrapFunc 将go函数包装为lua函数
+func WrapFunc(fn any) (lua.LGFunction, error) {
+	switch f := fn.(type) {
+	case lua.LGFunction:
+		return f, nil
+	case func(*lua.LState) int:
+		return f, nil
+	}
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func || fv.IsNil() {
+		return nil, fmt.Errorf("%T is not a func", fn)
+	}
+	ft := fv.Type()
+	withCtx := ft.NumIn() > 0 && ft.In(0) == contextType
+	withErr := ft.NumOut() > 0 && ft.Out(ft.NumOut()-1) == errorType
+	return func(L *lua.LState) int {
+		in, err := toGoArgs(L, ft, withCtx)
+		if err != nil {
+			L.RaiseError("%s", err.Error())
+			return 0
+		}
+		var out []reflect.Value
+		if ft.IsVariadic() {
+			out = fv.CallSlice(in)
+		} else {
+			out = fv.Call(in)
+		}
+		if withErr {
+			if e := out[len(out)-1]; !e.IsNil() {
+				L.RaiseError("%s", e.Interface().(error).Error())
+				return 0
+			}
+			out = out[:len(out)-1]
+		}
+		for _, o := range out {
+			if o.Type() == lvalueType || o.Type().Implements(lvalueType) {
+				if o.IsNil() {
+					L.Push(lua.LNil)
+				} else {
+					L.Push(o.Interface().(lua.LValue))
+				}
+				continue
+			}
+			L.Push(FromGoValue(o.Interface(), L))
+		}
+		return len(out)
+	}, nil
+}
+
+// toGoArgs 将lua入参转换为go函数入参
+func toGoArgs(L *lua.LState, ft reflect.Type, withCtx bool) ([]reflect.Value, error) {
+	numIn := ft.NumIn()
+	in := make([]reflect.Value, 0, numIn)
+	if withCtx {
+		ctx := L.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		in = append(in, reflect.ValueOf(&ctx).Elem())
+	}
+	fixed := numIn
+	if ft.IsVariadic() {
+		fixed--
+	}
+	top := L.GetTop()
+	pos := 1
+	for i := len(in); i < fixed; i++ {
+		arg, err := toGoArg(L.Get(pos), ft.In(i))
+		if err != nil {
+			return nil, fmt.Errorf("bad argument #%d: %w", pos, err)
+		}
+		in = append(in, arg)
+		pos++
+	}
+	if ft.IsVariadic() {
+		elemType := ft.In(numIn - 1).Elem()
+		rest := reflect.MakeSlice(ft.In(numIn-1), 0, top-pos+1)
+		for ; pos <= top; pos++ {
+			arg, err := toGoArg(L.Get(pos), elemType)
+			if err != nil {
+				return nil, fmt.Errorf("bad argument #%d: %w", pos, err)
+			}
+			rest = reflect.Append(rest, arg)
+		}
+		in = append(in, rest)
+	}
+	return in, nil
+}
+
+// toGoArg 将LValue转换为指定类型
+func toGoArg(lv lua.LValue, t reflect.Type) (reflect.Value, error) {
+	if t == lvalueType {
+		return reflect.ValueOf(&lv).Elem(), nil
+	}
+	v := ToGoValue(lv)
+	if v == nil {
+		return reflect.Zero(t), nil
+	}
+	if reflect.TypeOf(v).AssignableTo(t) {
+		return reflect.ValueOf(v).Convert(t), nil
+	}
+	var (
+		ret any
+		err error
+	)
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		ret, err = cast.ToInt64E(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		ret, err = cast.ToUint64E(v)
+	case reflect.Float32, reflect.Float64:
+		ret, err = cast.ToFloat64E(v)
+	case reflect.String:
+		ret, err = cast.ToStringE(v)
+	case reflect.Bool:
+		ret, err = cast.ToBoolE(v)
+	default:
+		ptr := reflect.New(t)
+		decoder, derr := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			WeaklyTypedInput: true,
+			Result:           ptr.Interface(),
+			TagName:          "json",
+		})
+		if derr != nil {
+			return reflect.Value{}, derr
+		}
+		if err = decoder.Decode(v); err != nil {
+			return reflect.Value{}, err
+		}
+		return ptr.Elem(), nil
+	}
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(ret).Convert(t), nil
+}
@@ -0,0 +1,193 @@
+package luautil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	lua "github.com/yuin/gopher-lua"
+	"strings"
+	"time"
+)
+
+// lua标准库名称
+const (
+	BaseLib      = lua.BaseLibName
+	PackageLib   = lua.LoadLibName
+	TableLib     = lua.TabLibName
+	StringLib    = lua.StringLibName
+	MathLib      = lua.MathLibName
+	CoroutineLib = lua.CoroutineLibName
+	IoLib        = lua.IoLibName
+	OsLib        = lua.OsLibName
+	DebugLib     = lua.DebugLibName
+	ChannelLib   = lua.ChannelLibName
+)
+
+var (
+	// DefaultLibs 默认开放的库 不包含os、io、debug等
+	DefaultLibs = []string{BaseLib, TableLib, StringLib, MathLib, CoroutineLib}
+
+	// unsafeBaseFuncs base库中可加载任意代码或文件的函数 默认移除
+	unsafeBaseFuncs = []string{"dofile", "loadfile", "load", "loadstring"}
+
+	libOpeners = map[string]lua.LGFunction{
+		BaseLib:      lua.OpenBase,
+		PackageLib:   lua.OpenPackage,
+		TableLib:     lua.OpenTable,
+		StringLib:    lua.OpenString,
+		MathLib:      lua.OpenMath,
+		CoroutineLib: lua.OpenCoroutine,
+		IoLib:        lua.OpenIo,
+		OsLib:        lua.OpenOs,
+		DebugLib:     lua.OpenDebug,
+		ChannelLib:   lua.OpenChannel,
+	}
+)
+
+var (
+	// TimeoutLimitError 脚本执行超过时间限制
+	TimeoutLimitError = errors.New("lua time limit exceeded")
+	// CallStackLimitError 调用栈超过限制 通常是无限递归
+	CallStackLimitError = errors.New("lua call stack limit exceeded")
+	// RegistryLimitError 数据栈超过RegistryMaxSize限制 不代表堆内存超限
+	RegistryLimitError = errors.New("lua registry limit exceeded")
+)
+
+// SandboxOpts LState沙箱配置
+type SandboxOpts struct {
+	// Libs 开放的库 为nil使用DefaultLibs
+	Libs []string
+	// AllowUnsafeBaseFuncs 是否保留base库的dofile、loadfile、load、loadstring
+	AllowUnsafeBaseFuncs bool
+	// CallStackSize 调用栈大小 为0使用gopher-lua默认值
+	CallStackSize int
+	// RegistrySize 数据栈初始大小 为0使用gopher-lua默认值
+	RegistrySize int
+	// RegistryMaxSize 数据栈最大大小 为0不允许增长
+	// 只限制栈上的值数量 不限制堆内存 table、字符串等占用的内存不受限制
+	RegistryMaxSize int
+	// Timeout 单次执行超时时间 为0不限制
+	Timeout time.Duration
+}
+
+// newSandboxState 按配置创建LState 只打开白名单中的库
+func newSandboxState(opts SandboxOpts) (*lua.LState, error) {
+	L := lua.NewState(lua.Options{
+		CallStackSize:   opts.CallStackSize,
+		RegistrySize:    opts.RegistrySize,
+		RegistryMaxSize: opts.RegistryMaxSize,
+		SkipOpenLibs:    true,
+	})
+	libs := opts.Libs
+	if libs == nil {
+		libs = DefaultLibs
+	}
+	opened := make(map[string]bool, len(libs))
+	// package和base需要先打开
+	ordered := make([]string, 0, len(libs))
+	for _, name := range []string{PackageLib, BaseLib} {
+		for _, lib := range libs {
+			if lib == name {
+				ordered = append(ordered, name)
+			}
+		}
+	}
+	ordered = append(ordered, libs...)
+	for _, name := range ordered {
+		if opened[name] {
+			continue
+		}
+		opener, ok := libOpeners[name]
+		if !ok {
+			L.Close()
+			return nil, errors.New("unknown lua lib: " + name)
+		}
+		L.Push(L.NewFunction(opener))
+		L.Push(lua.LString(name))
+		L.Call(1, 0)
+		opened[name] = true
+	}
+	if opened[BaseLib] && !opts.AllowUnsafeBaseFuncs {
+		for _, fn := range unsafeBaseFuncs {
+			L.SetGlobal(fn, lua.LNil)
+		}
+	}
+	return L, nil
+}
+
+// validateLibs 校验库名称
+func validateLibs(libs []string) error {
+	for _, lib := range libs {
+		if _, ok := libOpeners[lib]; !ok {
+			return errors.New("unknown lua lib: " + lib)
+		}
+	}
+	return nil
+}
+
+// limitError 错误为超出限制时返回对应的错误类型 否则返回nil
+// gopher-lua的栈溢出没有单独的错误类型 只能通过ApiError的类型和错误值判断
+func limitError(ctx context.Context, timeout time.Duration, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctx != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && timeout > 0 {
+		return fmt.Errorf("%w: %v", TimeoutLimitError, timeout)
+	}
+	if errors.Is(err, CallStackLimitError) {
+		return err
+	}
+	var apiErr *lua.ApiError
+	if !errors.As(err, &apiErr) {
+		return nil
+	}
+	msg, ok := apiErr.Object.(lua.LString)
+	if !ok {
+		return nil
+	}
+	switch apiErr.Type {
+	case lua.ApiErrorRun:
+		// RaiseError会在错误值前加上位置信息
+		switch {
+		case isRaised(string(msg), stackOverflowMsg):
+			return fmt.Errorf("%w: %v", CallStackLimitError, err)
+		case isRaised(string(msg), registryOverflowMsg):
+			return fmt.Errorf("%w: %v", RegistryLimitError, err)
+		}
+	case lua.ApiErrorPanic:
+		// 保护调用中调用栈溢出的panic被转换为ApiErrorPanic
+		if string(msg) == callStackOverflowMsg {
+			return fmt.Errorf("%w: %v", CallStackLimitError, err)
+		}
+	}
+	return nil
+}
+
+// gopher-lua内部的溢出错误信息
+const (
+	stackOverflowMsg     = "stack overflow"
+	registryOverflowMsg  = "registry overflow"
+	callStackOverflowMsg = "lua callstack overflow"
+)
+
+// isRaised msg是否为RaiseError抛出的target 可能带有位置前缀
+func isRaised(msg, target string) bool {
+	return msg == target || strings.HasSuffix(msg, ": "+target)
+}
+
+// safeExecute 执行脚本 gopher-lua在部分栈溢出场景下会在保护调用之外panic 转换为错误
+func safeExecute(run func() ([]lua.LValue, error)) (args []lua.LValue, err error, panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			args = nil
+			if msg, ok := r.(string); ok && msg == callStackOverflowMsg {
+				err = fmt.Errorf("%w: %v", CallStackLimitError, msg)
+			} else {
+				err = fmt.Errorf("lua state panic: %v", r)
+			}
+			panicked = true
+		}
+	}()
+	args, err = run()
+	return
+}
@@ -0,0 +1,70 @@
+package luautil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func newSandboxExecutor(t *testing.T, sandbox SandboxOpts) *ScriptExecutor {
+	executor, err := NewScriptExecutorWithOpts(ScriptExecutorOpts{
+		LStatePoolOpts: LStatePoolOpts{MaxSize: 2, Sandbox: sandbox},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(executor.Close)
+	return executor
+}
+
+func executeScript(t *testing.T, executor *ScriptExecutor, script string) (lua.LValue, error) {
+	proto, err := executor.CompileLua(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return executor.Execute(proto, nil)
+}
+
+func TestSandboxTimeout(t *testing.T) {
+	executor := newSandboxExecutor(t, SandboxOpts{Timeout: 20 * time.Millisecond})
+	if _, err := executeScript(t, executor, "while true do end"); !errors.Is(err, TimeoutLimitError) {
+		t.Fatalf("expect timeout but got %v", err)
+	}
+	// 超时的LState不放回池中
+	if stats := executor.PoolStats(); stats.Idle != 0 || stats.Closed != 1 {
+		t.Fatalf("unexpected pool stats %+v", stats)
+	}
+	if ret, err := executeScript(t, executor, "return 1"); err != nil || ret != lua.LNumber(1) {
+		t.Fatalf("expect executed after timeout but got %v %v", ret, err)
+	}
+}
+
+func TestSandboxCallStackLimit(t *testing.T) {
+	executor := newSandboxExecutor(t, SandboxOpts{CallStackSize: 64})
+	if _, err := executeScript(t, executor, "local function f() return 1 + f() end return f()"); !errors.Is(err, CallStackLimitError) {
+		t.Fatalf("expect call stack limit but got %v", err)
+	}
+}
+
+func TestSandboxLibs(t *testing.T) {
+	executor := newSandboxExecutor(t, SandboxOpts{})
+	for _, name := range []string{"os", "io", "debug", "dofile", "loadfile", "load", "loadstring"} {
+		ret, err := executeScript(t, executor, "return "+name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ret != lua.LNil {
+			t.Fatalf("expect %s removed but got %v", name, ret)
+		}
+	}
+	executor = newSandboxExecutor(t, SandboxOpts{Libs: append([]string{OsLib}, DefaultLibs...), AllowUnsafeBaseFuncs: true})
+	ret, err := executeScript(t, executor, "return type(os.time) .. type(load)")
+	if err != nil || ret.String() != "functionfunction" {
+		t.Fatalf("expect os and load opened but got %v %v", ret, err)
+	}
+	if _, err = NewLStatePoolWithOpts(LStatePoolOpts{MaxSize: 1, Sandbox: SandboxOpts{Libs: []string{"unknown"}}}); err == nil {
+		t.Fatal("expect unknown lib error")
+	}
+}
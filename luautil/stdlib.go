@@ -0,0 +1,308 @@
+package luautil
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/LeeZXin/zsf-utils/strutil"
+	"github.com/shopspring/decimal"
+	"hash"
+	"hash/crc32"
+	"strings"
+	"time"
+)
+
+// 标准模块名称
+const (
+	JsonModuleName    = "json"
+	StringsModuleName = "strings"
+	RegexModuleName   = "regex"
+	HashModuleName    = "hash"
+	TimeModuleName    = "time"
+	DecimalModuleName = "decimal"
+)
+
+// DefaultTimeLayout time模块默认的时间格式
+const DefaultTimeLayout = "2006-01-02 15:04:05"
+
+// MaxRepLength strings.rep结果的最大字节数
+const MaxRepLength = 1 << 20
+
+// MaxDecimalPlaces decimal.div和decimal.round保留小数位数绝对值的上限
+const MaxDecimalPlaces = 64
+
+var (
+	// JsonModule json编解码
+	JsonModule = MustNewModule(JsonModuleName, map[string]any{
+		"encode": jsonEncode,
+		"decode": jsonDecode,
+	})
+
+	// StringsModule 字符串处理
+	StringsModule = MustNewModule(StringsModuleName, map[string]any{
+		"split":      strings.Split,
+		"join":       strings.Join,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": strings.TrimPrefix,
+		"trimSuffix": strings.TrimSuffix,
+		"hasPrefix":  strings.HasPrefix,
+		"hasSuffix":  strings.HasSuffix,
+		"contains":   strings.Contains,
+		"replace":    strings.ReplaceAll,
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"rep":        strRep,
+		"index":      strIndex,
+	})
+
+	// RegexModule 正则 使用go regexp语法
+	RegexModule = MustNewModule(RegexModuleName, map[string]any{
+		"match":    regexMatch,
+		"find":     regexFind,
+		"findAll":  regexFindAll,
+		"submatch": regexSubmatch,
+		"replace":  regexReplace,
+	})
+
+	// HashModule 摘要和编码 结果为十六进制字符串
+	HashModule = MustNewModule(HashModuleName, map[string]any{
+		"md5":          hashFunc(md5.New),
+		"sha1":         hashFunc(sha1.New),
+		"sha256":       hashFunc(sha256.New),
+		"sha512":       hashFunc(sha512.New),
+		"hmacSha256":   hmacSha256,
+		"crc32":        crc32.ChecksumIEEE,
+		"base64Encode": base64Encode,
+		"base64Decode": base64Decode,
+	})
+
+	// TimeModule 时间 时间戳单位为毫秒 layout使用go时间格式 为空使用DefaultTimeLayout
+	TimeModule = MustNewModule(TimeModuleName, map[string]any{
+		"now":    timeNow,
+		"format": timeFormat,
+		"parse":  timeParse,
+	})
+
+	// DecimalModule 十进制精确计算 入参和结果均为字符串
+	DecimalModule = MustNewModule(DecimalModuleName, map[string]any{
+		"add":   decimalOp(decimal.Decimal.Add),
+		"sub":   decimalOp(decimal.Decimal.Sub),
+		"mul":   decimalOp(decimal.Decimal.Mul),
+		"div":   decimalDiv,
+		"round": decimalRound,
+		"cmp":   decimalCmp,
+	})
+)
+
+var (
+	errDivisionByZero = errors.New("division by zero")
+	errNegativeCount  = errors.New("negative repeat count")
+	errRepTooLong     = errors.New("repeat result too long")
+	errPlacesOutRange = errors.New("decimal places out of range")
+)
+
+// StdModules 标准模块
+func StdModules() []*Module {
+	return []*Module{JsonModule, StringsModule, RegexModule, HashModule, TimeModule, DecimalModule}
+}
+
+// NewStdModuleRegistry 注册了所有标准模块的注册中心
+func NewStdModuleRegistry() *ModuleRegistry {
+	ret := NewModuleRegistry()
+	_ = ret.Register(StdModules()...)
+	return ret
+}
+
+func jsonEncode(v any) (string, error) {
+	ret, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(ret), nil
+}
+
+func jsonDecode(s string) (any, error) {
+	var ret any
+	if err := json.Unmarshal([]byte(s), &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// strRep 重复字符串 结果不超过MaxRepLength
+func strRep(s string, n int) (string, error) {
+	if n < 0 {
+		return "", errNegativeCount
+	}
+	if n > 0 && len(s) > MaxRepLength/n {
+		return "", errRepTooLong
+	}
+	return strings.Repeat(s, n), nil
+}
+
+// strIndex 子串首次出现的位置 和lua一样从1开始 不存在返回nil
+func strIndex(s, substr string) any {
+	i := strings.Index(s, substr)
+	if i < 0 {
+		return nil
+	}
+	return i + 1
+}
+
+func regexMatch(pattern, s string) (bool, error) {
+	re, err := strutil.CompileRegexp(pattern)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(s), nil
+}
+
+func regexFind(pattern, s string) (string, error) {
+	re, err := strutil.CompileRegexp(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.FindString(s), nil
+}
+
+func regexFindAll(pattern, s string) ([]string, error) {
+	re, err := strutil.CompileRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.FindAllString(s, -1), nil
+}
+
+func regexSubmatch(pattern, s string) ([]string, error) {
+	re, err := strutil.CompileRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.FindStringSubmatch(s), nil
+}
+
+func regexReplace(pattern, s, repl string) (string, error) {
+	re, err := strutil.CompileRegexp(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(s, repl), nil
+}
+
+func hashFunc(fn func() hash.Hash) func(string) string {
+	return func(s string) string {
+		h := fn()
+		h.Write([]byte(s))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+}
+
+func hmacSha256(key, s string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func base64Encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func base64Decode(s string) (string, error) {
+	ret, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	return string(ret), nil
+}
+
+func timeNow() int64 {
+	return time.Now().UnixMilli()
+}
+
+func timeFormat(ms int64, layout string) string {
+	if layout == "" {
+		layout = DefaultTimeLayout
+	}
+	return time.UnixMilli(ms).Format(layout)
+}
+
+func timeParse(value, layout string) (int64, error) {
+	if layout == "" {
+		layout = DefaultTimeLayout
+	}
+	t, err := time.ParseInLocation(layout, value, time.Local)
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixMilli(), nil
+}
+
+func decimalOp(fn func(decimal.Decimal, decimal.Decimal) decimal.Decimal) func(string, string) (string, error) {
+	return func(a, b string) (string, error) {
+		x, err := decimal.NewFromString(a)
+		if err != nil {
+			return "", err
+		}
+		y, err := decimal.NewFromString(b)
+		if err != nil {
+			return "", err
+		}
+		return fn(x, y).String(), nil
+	}
+}
+
+// decimalDiv 除法 places为保留的小数位数
+func decimalDiv(a, b string, places int32) (string, error) {
+	if err := checkPlaces(places); err != nil {
+		return "", err
+	}
+	x, err := decimal.NewFromString(a)
+	if err != nil {
+		return "", err
+	}
+	y, err := decimal.NewFromString(b)
+	if err != nil {
+		return "", err
+	}
+	if y.IsZero() {
+		return "", errDivisionByZero
+	}
+	return x.DivRound(y, places).String(), nil
+}
+
+func decimalRound(a string, places int32) (string, error) {
+	if err := checkPlaces(places); err != nil {
+		return "", err
+	}
+	x, err := decimal.NewFromString(a)
+	if err != nil {
+		return "", err
+	}
+	return x.Round(places).String(), nil
+}
+
+// checkPlaces 限制小数位数 过大的位数会构造超长结果
+func checkPlaces(places int32) error {
+	if places > MaxDecimalPlaces || places < -MaxDecimalPlaces {
+		return errPlacesOutRange
+	}
+	return nil
+}
+
+func decimalCmp(a, b string) (int, error) {
+	x, err := decimal.NewFromString(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := decimal.NewFromString(b)
+	if err != nil {
+		return 0, err
+	}
+	return x.Cmp(y), nil
+}
@@ -0,0 +1,119 @@
+package luautil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestStdModules(t *testing.T) {
+	executor, err := NewScriptExecutorWithOpts(ScriptExecutorOpts{
+		LStatePoolOpts: LStatePoolOpts{MaxSize: 1, Modules: NewStdModuleRegistry()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer executor.Close()
+	tests := []struct {
+		script string
+		expect lua.LValue
+		// err 不为空时期待错误信息包含err
+		err string
+	}{
+		{script: `return require("strings").rep("ab", 3)`, expect: lua.LString("ababab")},
+		{script: `return require("strings").rep("ab", 0)`, expect: lua.LString("")},
+		{script: fmt.Sprintf(`return #require("strings").rep("a", %d)`, MaxRepLength), expect: lua.LNumber(MaxRepLength)},
+		{script: fmt.Sprintf(`return require("strings").rep("ab", %d)`, MaxRepLength/2+1), err: errRepTooLong.Error()},
+		{script: `return require("strings").rep("ab", -1)`, err: errNegativeCount.Error()},
+		{script: `return require("strings").index("abc", "a")`, expect: lua.LNumber(1)},
+		{script: `return require("strings").index("abc", "c")`, expect: lua.LNumber(3)},
+		{script: `return require("strings").index("abc", "z")`, expect: lua.LNil},
+		{
+			script: `local json = require("json") return json.encode(json.decode('{"a":[1,"x",true],"b":{"c":1.5}}'))`,
+			expect: lua.LString(`{"a":[1,"x",true],"b":{"c":1.5}}`),
+		},
+		{script: `return require("json").decode("{")`, err: "unexpected end of JSON input"},
+		{script: `return require("decimal").div("1", "3", 2)`, expect: lua.LString("0.33")},
+		{script: `return require("decimal").div("1", "0", 2)`, err: errDivisionByZero.Error()},
+		{script: fmt.Sprintf(`return require("decimal").div("1", "3", %d)`, MaxDecimalPlaces+1), err: errPlacesOutRange.Error()},
+		{script: `return require("decimal").round("1.255", 2)`, expect: lua.LString("1.26")},
+		{script: fmt.Sprintf(`return require("decimal").round("1.5", %d)`, -MaxDecimalPlaces-1), err: errPlacesOutRange.Error()},
+	}
+	for _, test := range tests {
+		proto, err := executor.CompileLua(test.script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret, err := executor.Execute(proto, nil)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("%s: expect error %s but got %v", test.script, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.script, err)
+		}
+		if ret != test.expect {
+			t.Fatalf("%s: expect %v but got %v", test.script, test.expect, ret)
+		}
+	}
+}
+
+func TestWrapFunc(t *testing.T) {
+	type item struct {
+		Name  string  `json:"name"`
+		Price float64 `json:"price"`
+	}
+	funcs := map[string]any{
+		"total": func(items []item, discount float64) (float64, string) {
+			sum := 0.0
+			for _, i := range items {
+				sum += i.Price
+			}
+			return sum - discount, items[0].Name
+		},
+		"join": func(sep string, parts ...string) string {
+			return strings.Join(parts, sep)
+		},
+		"fail": func(msg string) (int, error) {
+			return 0, errors.New(msg)
+		},
+		"hasCtx": func(ctx context.Context) bool {
+			return ctx != nil
+		},
+	}
+	L := lua.NewState()
+	defer L.Close()
+	for name, fn := range funcs {
+		wrapped, err := WrapFunc(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		L.SetGlobal(name, L.NewFunction(wrapped))
+	}
+	if _, err := WrapFunc(1); err == nil {
+		t.Fatal("expect not a func error")
+	}
+	err := L.DoString(`
+		local sum, first = total({{name = "a", price = 1.5}, {name = "b", price = "2"}}, 0.5)
+		result = {sum = sum, first = first, joined = join("-", "x", 1, true), ctx = hasCtx()}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, ok := ToGoValue(L.GetGlobal("result")).(map[string]any)
+	if !ok || result["sum"] != float64(3) || result["first"] != "a" || result["joined"] != "x-1-true" || result["ctx"] != true {
+		t.Fatalf("unexpected result %v", result)
+	}
+	if err = L.DoString(`fail("boom")`); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expect error propagated but got %v", err)
+	}
+	if err = L.DoString(`total("x", 1)`); err == nil || !strings.Contains(err.Error(), "bad argument #1") {
+		t.Fatalf("expect bad argument but got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package luautil
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/spf13/cast"
@@ -9,6 +10,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -68,39 +70,47 @@ func (b Bindings) GetBool(key string) (bool, bool) {
 	return false, false
 }
 
+// Get 按路径获取 支持map、结构体和数组下标 如items[0].price
 func (b Bindings) Get(path string) (any, bool) {
-	sp := strings.Split(path, ".")
-	t := map[string]any(b)
+	if !strings.ContainsAny(path, ".[") {
+		ret, ok := b[path]
+		return ret, ok
+	}
+	tokens, err := parsePath(path)
+	if err != nil {
+		return nil, false
+	}
 	var (
-		data any = nil
-		has      = false
+		data any = map[string]any(b)
+		has  bool
 	)
-	for i, s := range sp {
-		data, has = t[s]
+	for _, token := range tokens {
+		data, has = getChild(data, token)
 		if !has {
 			return nil, false
 		}
-		if i < len(sp)-1 {
-			if b.isMapStringAny(data) {
-				t = data.(map[string]any)
-			} else {
-				return nil, false
-			}
-		}
 	}
 	return data, true
 }
 
-func (b Bindings) isMapStringAny(data any) bool {
-	t := reflect.TypeOf(data)
-	if t.Kind() != reflect.Map {
-		return false
+func (b Bindings) Set(key string, val any) {
+	b[key] = val
+}
+
+// SetPath 按路径设置 中间节点不存在时创建map[string]any或[]any
+// 数组下标只能修改已有元素或在末尾追加
+func (b Bindings) SetPath(path string, val any) error {
+	tokens, err := parsePath(path)
+	if err != nil {
+		return err
 	}
-	return t.Key().Kind() == reflect.String
+	_, err = setChild(map[string]any(b), tokens, val)
+	return err
 }
 
-func (b Bindings) Set(key string, val any) {
-	b[key] = val
+// Decode 解析到结构体
+func (b Bindings) Decode(out any) error {
+	return Decode(b, out)
 }
 
 func (b Bindings) Del(key string) {
@@ -168,13 +178,8 @@ func FromGoValue(v any, L *lua.LState) lua.LValue {
 		}
 		return table
 	case reflect.Struct:
-		table := L.NewTable()
-		for i := 0; i < r.NumField(); i++ {
-			fk := r.Type().Field(i).Name
-			fv := FromGoValue(r.Field(i).Interface(), L)
-			table.RawSet(lua.LString(fk), fv)
-		}
-		return table
+		// 字段名优先使用lua tag 其次json tag
+		return FromGoValue(toPlainValue(r), L)
 	case reflect.Pointer:
 		if !r.IsNil() {
 			return FromGoValue(r.Elem().Interface(), L)
@@ -239,41 +244,222 @@ func ExtraTableMapStringString(lv lua.LValue) map[string]string {
 	return ret
 }
 
+// Isolation LState复用时的隔离级别
+type Isolation int
+
+const (
+	// NoIsolation 不隔离 脚本设置的全局变量对之后的执行可见
+	NoIsolation Isolation = iota
+	// ResetGlobals 放回池中时恢复创建时的全局变量和string、table等库table的字段
+	// require加载的模块在下次执行时重新构建 只恢复到库table下一层 更深层table的修改不会被还原
+	ResetGlobals
+	// FreshEnv 每次执行使用新的环境table 读取时回退到全局环境 写入只在本次执行中可见
+	// 通过_G显式写入的全局变量、库table和模块的修改在放回池中时按ResetGlobals恢复
+	FreshEnv
+)
+
+// PoolStats LState池统计
+type PoolStats struct {
+	// Idle 空闲数量
+	Idle int
+	// Active 使用中数量
+	Active int
+	// Waiting 正在阻塞等待的数量
+	Waiting int
+	// Gets 累计获取次数
+	Gets int64
+	// Created 累计创建数量
+	Created int64
+	// Closed 累计关闭数量 包含Evicted和Retired
+	Closed int64
+	// Evicted 因空闲超时关闭的数量
+	Evicted int64
+	// Retired 因达到最大使用次数关闭的数量
+	Retired int64
+	// WaitTime 累计阻塞等待时间
+	WaitTime time.Duration
+}
+
+// stateMeta 池中LState的信息
+type stateMeta struct {
+	// uses 已使用次数
+	uses int
+	// tables 创建时全局变量、库table和已加载模块的快照 用于ResetGlobals和FreshEnv
+	tables []tableSnapshot
+}
+
+// tableSnapshot table的浅层快照
+type tableSnapshot struct {
+	t      *lua.LTable
+	fields map[lua.LValue]lua.LValue
+	mt     lua.LValue
+}
+
+func newTableSnapshot(L *lua.LState, t *lua.LTable) tableSnapshot {
+	ret := tableSnapshot{
+		t:      t,
+		fields: make(map[lua.LValue]lua.LValue),
+		mt:     L.GetMetatable(t),
+	}
+	t.ForEach(func(key, value lua.LValue) {
+		ret.fields[key] = value
+	})
+	return ret
+}
+
+// restore 恢复table的字段和元表
+func (s *tableSnapshot) restore(L *lua.LState) {
+	stale := make([]lua.LValue, 0)
+	s.t.ForEach(func(key, value lua.LValue) {
+		if origin, ok := s.fields[key]; !ok || origin != value {
+			stale = append(stale, key)
+		}
+	})
+	for _, key := range stale {
+		s.t.RawSet(key, lua.LNil)
+	}
+	for key, value := range s.fields {
+		if s.t.RawGet(key) != value {
+			s.t.RawSet(key, value)
+		}
+	}
+	L.SetMetatable(s.t, s.mt)
+}
+
+// snapshot 记录当前全局变量、作为全局变量的库table及其中的table以及package.loaded
+// 模块在require时才加载 恢复package.loaded后下次require会重新构建模块table
+func (m *stateMeta) snapshot(L *lua.LState) {
+	seen := map[*lua.LTable]bool{L.G.Global: true}
+	m.tables = []tableSnapshot{newTableSnapshot(L, L.G.Global)}
+	add := func(value lua.LValue) {
+		if t, ok := value.(*lua.LTable); ok && !seen[t] {
+			seen[t] = true
+			m.tables = append(m.tables, newTableSnapshot(L, t))
+		}
+	}
+	L.G.Global.ForEach(func(_, value lua.LValue) {
+		add(value)
+	})
+	add(L.G.Registry.RawGetString(loadedKey))
+	// 库table中的table 如package.preload
+	for _, snapshot := range m.tables[1:] {
+		snapshot.t.ForEach(func(_, value lua.LValue) {
+			add(value)
+		})
+	}
+}
+
+// reset 恢复到snapshot时的状态
+func (m *stateMeta) reset(L *lua.LState) {
+	for i := range m.tables {
+		m.tables[i].restore(L)
+	}
+}
+
+type idleState struct {
+	L *lua.LState
+	// since 放回池中的时间
+	since time.Time
+}
+
 // LStatePool LState池 复用LState
 type LStatePool struct {
-	mu   sync.Mutex
-	pool []*lua.LState
+	mu sync.Mutex
+	// idle 空闲的LState 按放回时间排序
+	idle []idleState
+	// states 池创建且未关闭的LState
+	states map[*lua.LState]*stateMeta
 	// 限制最大数量
 	maxSize int
 	// 初始化数量
 	initSize int
 	// 默认注册使用的go函数 不允许name为params
 	globalFn map[string]lua.LGFunction
+	// sandbox 沙箱配置
+	sandbox SandboxOpts
+	// modules 可通过require加载的模块
+	modules *ModuleRegistry
+	// isolation 隔离级别
+	isolation Isolation
+	// maxReuse 最大使用次数
+	maxReuse int
+	// idleTimeout 空闲超时时间
+	idleTimeout time.Duration
+	// blocking 达到maxSize时Get是否阻塞
+	blocking bool
+	// waitCh 有LState放回或关闭时close 唤醒等待者
+	waitCh  chan struct{}
+	waiting int
+	stats   PoolStats
+}
+
+type LStatePoolOpts struct {
+	MaxSize  int
+	InitSize int
+	FnMap    map[string]lua.LGFunction
+	Sandbox  SandboxOpts
+	// Modules 预加载的模块 为nil不加载
+	Modules *ModuleRegistry
+	// Isolation 复用隔离级别 默认NoIsolation
+	Isolation Isolation
+	// MaxReuse 单个LState最大使用次数 达到后关闭 为0不限制
+	MaxReuse int
+	// IdleTimeout 空闲超时时间 超时的LState在Get、Put或EvictIdle时关闭 至少保留InitSize个 为0不淘汰
+	IdleTimeout time.Duration
+	// Blocking 为true时LState总数不超过MaxSize 没有可用LState时Get阻塞等待
+	// 为false时Get总是立即返回 超出MaxSize的LState在Put时关闭
+	Blocking bool
 }
 
 // NewLStatePool 构建池
 func NewLStatePool(maxSize int, initSize int, fnMap map[string]lua.LGFunction) (*LStatePool, error) {
+	return NewLStatePoolWithOpts(LStatePoolOpts{
+		MaxSize:  maxSize,
+		InitSize: initSize,
+		FnMap:    fnMap,
+	})
+}
+
+func NewLStatePoolWithOpts(opts LStatePoolOpts) (*LStatePool, error) {
+	maxSize, initSize, fnMap := opts.MaxSize, opts.InitSize, opts.FnMap
 	if maxSize <= 0 {
 		return nil, errors.New("maxSize should greater than 0")
 	}
 	if maxSize < initSize {
 		return nil, errors.New("initSize should less than maxSize")
 	}
+	if opts.Isolation < NoIsolation || opts.Isolation > FreshEnv {
+		return nil, errors.New("unknown isolation")
+	}
+	if opts.MaxReuse < 0 || opts.IdleTimeout < 0 {
+		return nil, errors.New("maxReuse and idleTimeout should not be negative")
+	}
+	if err := validateLibs(opts.Sandbox.Libs); err != nil {
+		return nil, err
+	}
 	if fnMap == nil {
 		fnMap = make(map[string]lua.LGFunction)
 	}
-	var pool []*lua.LState
+	var idle []idleState
 	if initSize <= 0 {
-		pool = make([]*lua.LState, 0)
+		idle = make([]idleState, 0)
 	} else {
-		pool = make([]*lua.LState, 0, initSize)
+		idle = make([]idleState, 0, initSize)
 	}
 	ret := &LStatePool{
-		mu:       sync.Mutex{},
-		pool:     pool,
-		maxSize:  maxSize,
-		initSize: initSize,
-		globalFn: fnMap,
+		mu:          sync.Mutex{},
+		idle:        idle,
+		states:      make(map[*lua.LState]*stateMeta),
+		maxSize:     maxSize,
+		initSize:    initSize,
+		globalFn:    fnMap,
+		sandbox:     opts.Sandbox,
+		modules:     opts.Modules,
+		isolation:   opts.Isolation,
+		maxReuse:    opts.MaxReuse,
+		idleTimeout: opts.IdleTimeout,
+		blocking:    opts.Blocking,
+		waitCh:      make(chan struct{}),
 	}
 	ret.init()
 	return ret, nil
@@ -281,54 +467,217 @@ func NewLStatePool(maxSize int, initSize int, fnMap map[string]lua.LGFunction) (
 
 func (p *LStatePool) init() {
 	if p.initSize > 0 {
+		now := time.Now()
 		for i := 0; i < p.initSize; i++ {
-			p.pool = append(p.pool, p.newLState())
+			p.idle = append(p.idle, idleState{L: p.newLState(), since: now})
 		}
 	}
 }
 
-func (p *LStatePool) newLState() *lua.LState {
-	L := lua.NewState()
+// createLState 按池配置创建LState 不记录到池中
+func (p *LStatePool) createLState() *lua.LState {
+	// 库名称已在构建池时校验
+	L, _ := newSandboxState(p.sandbox)
 	if len(p.globalFn) > 0 {
 		for name, fn := range p.globalFn {
 			// 注册函数
 			L.SetGlobal(name, L.NewFunction(fn))
 		}
 	}
+	if p.modules != nil {
+		p.modules.preload(L)
+	}
+	return L
+}
+
+// newLState 创建LState并记录 需持有锁或在初始化时调用
+func (p *LStatePool) newLState() *lua.LState {
+	L := p.createLState()
+	meta := new(stateMeta)
+	if p.isolation != NoIsolation {
+		meta.snapshot(L)
+	}
+	p.states[L] = meta
+	p.stats.Created++
 	return L
 }
 
+// closeLocked 关闭LState 需持有锁
+func (p *LStatePool) closeLocked(state *lua.LState) {
+	delete(p.states, state)
+	state.Close()
+	p.stats.Closed++
+	p.notifyLocked()
+}
+
+// notifyLocked 唤醒阻塞在Get的等待者 需持有锁
+func (p *LStatePool) notifyLocked() {
+	if p.waiting > 0 {
+		close(p.waitCh)
+		p.waitCh = make(chan struct{})
+	}
+}
+
+// evictIdleLocked 关闭空闲超时的LState 需持有锁
+func (p *LStatePool) evictIdleLocked(now time.Time) {
+	if p.idleTimeout <= 0 {
+		return
+	}
+	i := 0
+	for ; i < len(p.idle) && len(p.idle)-i > p.initSize; i++ {
+		if now.Sub(p.idle[i].since) < p.idleTimeout {
+			break
+		}
+		p.closeLocked(p.idle[i].L)
+		p.stats.Evicted++
+	}
+	if i > 0 {
+		p.idle = append(p.idle[:0], p.idle[i:]...)
+	}
+}
+
 func (p *LStatePool) Put(state *lua.LState) {
 	if state != nil {
 		p.mu.Lock()
 		defer p.mu.Unlock()
-		if len(p.pool) >= p.maxSize {
-			state.Close()
+		now := time.Now()
+		defer p.evictIdleLocked(now)
+		meta, ok := p.states[state]
+		if !ok {
+			// 非池创建的LState
+			if len(p.states) >= p.maxSize {
+				state.Close()
+				return
+			}
+			meta = new(stateMeta)
+			if p.isolation != NoIsolation {
+				meta.snapshot(state)
+			}
+			p.states[state] = meta
+		}
+		meta.uses++
+		if p.maxReuse > 0 && meta.uses >= p.maxReuse {
+			p.closeLocked(state)
+			p.stats.Retired++
+			return
+		}
+		if len(p.idle) >= p.maxSize {
+			p.closeLocked(state)
+			return
+		}
+		if p.isolation != NoIsolation {
+			meta.reset(state)
+		}
+		p.idle = append(p.idle, idleState{L: state, since: now})
+		p.notifyLocked()
+	}
+}
+
+// Discard 关闭不可再复用的LState 如执行被中断的LState
+func (p *LStatePool) Discard(state *lua.LState) {
+	if state != nil {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if _, ok := p.states[state]; ok {
+			p.closeLocked(state)
 		} else {
-			p.pool = append(p.pool, state)
+			state.Close()
 		}
 	}
 }
 
+// Get 获取LState 使用后需通过Put或Discard归还
 func (p *LStatePool) Get() *lua.LState {
+	// context.Background不会结束 不会返回错误
+	L, _ := p.GetCtx(context.Background())
+	return L
+}
+
+// GetCtx 获取LState Blocking模式下没有可用LState时阻塞直到有LState放回或ctx结束
+func (p *LStatePool) GetCtx(ctx context.Context) (*lua.LState, error) {
+	var waitStart time.Time
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if len(p.pool) > 0 {
-		res := p.pool[0]
-		p.pool = p.pool[1:]
-		return res
+	p.stats.Gets++
+	for {
+		p.evictIdleLocked(time.Now())
+		if n := len(p.idle); n > 0 {
+			// 取最近放回的 便于空闲的LState超时淘汰
+			L := p.idle[n-1].L
+			p.idle[n-1] = idleState{}
+			p.idle = p.idle[:n-1]
+			p.endWaitLocked(waitStart)
+			return L, nil
+		}
+		if !p.blocking || len(p.states) < p.maxSize {
+			p.endWaitLocked(waitStart)
+			return p.newLState(), nil
+		}
+		if waitStart.IsZero() {
+			waitStart = time.Now()
+			p.waiting++
+		}
+		ch := p.waitCh
+		p.mu.Unlock()
+		select {
+		case <-ch:
+			p.mu.Lock()
+		case <-ctx.Done():
+			p.mu.Lock()
+			p.endWaitLocked(waitStart)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// endWaitLocked 结束等待 记录等待时间 需持有锁
+func (p *LStatePool) endWaitLocked(waitStart time.Time) {
+	if !waitStart.IsZero() {
+		p.waiting--
+		p.stats.WaitTime += time.Since(waitStart)
 	}
-	return p.newLState()
 }
 
-// CloseAll 关闭所有的LState
+// EvictIdle 关闭空闲超时的LState 可由调用方定时调用
+func (p *LStatePool) EvictIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.evictIdleLocked(time.Now())
+}
+
+// Stats 池统计
+func (p *LStatePool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ret := p.stats
+	ret.Idle = len(p.idle)
+	ret.Active = len(p.states) - len(p.idle)
+	ret.Waiting = p.waiting
+	return ret
+}
+
+// lintOpts 按池配置生成脚本检查配置
+func (p *LStatePool) lintOpts() LintOpts {
+	globals := make([]string, 0, len(p.globalFn))
+	for name := range p.globalFn {
+		globals = append(globals, name)
+	}
+	return LintOpts{
+		Globals:              globals,
+		Libs:                 p.sandbox.Libs,
+		AllowUnsafeBaseFuncs: p.sandbox.AllowUnsafeBaseFuncs,
+		Modules:              p.modules,
+	}
+}
+
+// CloseAll 关闭所有空闲的LState
 func (p *LStatePool) CloseAll() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	for _, state := range p.pool {
-		state.Close()
+	for _, s := range p.idle {
+		p.closeLocked(s.L)
 	}
-	p.pool = make([]*lua.LState, 0)
+	p.idle = make([]idleState, 0)
 }
 
 // CompileBoolLua 编译布尔表达式lua
@@ -365,6 +714,11 @@ type CachedScript struct {
 	ScriptContent string
 	//脚本缓存 *lua.FunctionProto
 	protoCache *lua.FunctionProto
+	// errCache 编译错误缓存
+	errCache error
+	// compiledContent 缓存对应的脚本内容 ScriptContent变化后重新编译
+	compiledContent string
+	compiled        bool
 	//编译锁
 	compileMu sync.RWMutex
 }
@@ -376,31 +730,58 @@ func NewCachedScript(scriptContent string) *CachedScript {
 	return p
 }
 
-// GetCompiledScript 脚本编译
+// Update 替换脚本内容 下一次获取时重新编译
+func (p *CachedScript) Update(scriptContent string) {
+	p.compileMu.Lock()
+	defer p.compileMu.Unlock()
+	p.ScriptContent = scriptContent
+	p.compiled = false
+	p.protoCache = nil
+	p.errCache = nil
+}
+
+// GetCompiledScript 脚本编译 编译结果和错误都会缓存到脚本内容变化为止
 func (p *CachedScript) GetCompiledScript() (*lua.FunctionProto, error) {
-	var (
-		proto *lua.FunctionProto
-		err   error
-	)
 	p.compileMu.RLock()
-	proto = p.protoCache
-	p.compileMu.RUnlock()
-	if proto != nil {
-		return proto, nil
+	if p.compiled && p.compiledContent == p.ScriptContent {
+		proto, err := p.protoCache, p.errCache
+		p.compileMu.RUnlock()
+		return proto, err
 	}
+	p.compileMu.RUnlock()
 	p.compileMu.Lock()
 	defer p.compileMu.Unlock()
-	if p.protoCache == nil {
-		proto, err = CompileLua(p.ScriptContent)
-		if err != nil {
-			return nil, err
-		}
-		p.protoCache = proto
+	if !p.compiled || p.compiledContent != p.ScriptContent {
+		// 相同内容的脚本共享全局编译缓存
+		p.protoCache, p.errCache = CompileLuaCached(p.ScriptContent)
+		p.compiledContent = p.ScriptContent
+		p.compiled = true
 	}
-	return p.protoCache, nil
+	return p.protoCache, p.errCache
+}
+
+// Diagnostics 编译失败时返回错误位置 编译成功返回nil
+func (p *CachedScript) Diagnostics() []Diagnostic {
+	p.compileMu.RLock()
+	content := p.ScriptContent
+	p.compileMu.RUnlock()
+	_, err := p.GetCompiledScript()
+	if err == nil {
+		return nil
+	}
+	return []Diagnostic{compileDiagnostic(err, content)}
 }
 
 func Execute(L *lua.LState, proto *lua.FunctionProto, bindings Bindings) ([]lua.LValue, error) {
+	return execute(L, proto, bindings, false)
+}
+
+// ExecuteInFreshEnv 使用新的环境table执行脚本 脚本写入的全局变量不会保留到LState中
+func ExecuteInFreshEnv(L *lua.LState, proto *lua.FunctionProto, bindings Bindings) ([]lua.LValue, error) {
+	return execute(L, proto, bindings, true)
+}
+
+func execute(L *lua.LState, proto *lua.FunctionProto, bindings Bindings, freshEnv bool) ([]lua.LValue, error) {
 	if proto == nil {
 		return nil, errors.New("nil proto")
 	}
@@ -408,11 +789,24 @@ func Execute(L *lua.LState, proto *lua.FunctionProto, bindings Bindings) ([]lua.
 		bindings = NewBindings()
 	}
 	// 默认入参的变量为params
-	params := bindings.ToLTable(L)
-	L.SetGlobal("params", params)
-	defer L.SetGlobal("params", L.CreateTable(0, 0))
+	return executeWithParams(L, proto, bindings.ToLTable(L), freshEnv)
+}
+
+func executeWithParams(L *lua.LState, proto *lua.FunctionProto, params *lua.LTable, freshEnv bool) ([]lua.LValue, error) {
+	fn := L.NewFunctionFromProto(proto)
+	if freshEnv {
+		env := L.NewTable()
+		mt := L.NewTable()
+		mt.RawSetString("__index", L.G.Global)
+		L.SetMetatable(env, mt)
+		env.RawSetString("params", params)
+		fn.Env = env
+	} else {
+		L.SetGlobal("params", params)
+		defer L.SetGlobal("params", L.CreateTable(0, 0))
+	}
 	err := L.CallByParam(lua.P{
-		Fn:      L.NewFunctionFromProto(proto),
+		Fn:      fn,
 		NRet:    lua.MultRet,
 		Protect: true,
 	})
@@ -424,33 +818,97 @@ func Execute(L *lua.LState, proto *lua.FunctionProto, bindings Bindings) ([]lua.
 
 // ScriptExecutor 脚本执行器
 type ScriptExecutor struct {
-	pool *LStatePool
+	pool        *LStatePool
+	timeout     time.Duration
+	resultCache *ResultCache
 }
 
-// NewScriptExecutor 构建执行器
+// NewScriptExecutor 构建执行器 使用默认沙箱配置
+// 隔离级别为NoIsolation 脚本写入的全局变量以及对库table、模块table的修改对之后复用同一LState的执行可见
+// 执行不可信或互相独立的脚本时使用NewScriptExecutorWithOpts并设置ResetGlobals或FreshEnv
 func NewScriptExecutor(maxSize int, initSize int, fnMap map[string]lua.LGFunction) (*ScriptExecutor, error) {
-	pool, err := NewLStatePool(maxSize, initSize, fnMap)
+	return NewScriptExecutorWithOpts(ScriptExecutorOpts{
+		LStatePoolOpts: LStatePoolOpts{
+			MaxSize:  maxSize,
+			InitSize: initSize,
+			FnMap:    fnMap,
+		},
+	})
+}
+
+// ScriptExecutorOpts 执行器配置
+type ScriptExecutorOpts struct {
+	LStatePoolOpts
+	// ResultCache ExecutePure的结果缓存 为nil不缓存
+	ResultCache *ResultCache
+}
+
+func NewScriptExecutorWithOpts(opts ScriptExecutorOpts) (*ScriptExecutor, error) {
+	pool, err := NewLStatePoolWithOpts(opts.LStatePoolOpts)
 	if err != nil {
 		return nil, err
 	}
-	return &ScriptExecutor{pool: pool}, nil
+	return &ScriptExecutor{
+		pool:        pool,
+		timeout:     opts.Sandbox.Timeout,
+		resultCache: opts.ResultCache,
+	}, nil
 }
 
-// CompileBoolLua 编译布尔表达式lua
+// CompileBoolLua 编译布尔表达式lua 使用全局编译缓存
 func (e *ScriptExecutor) CompileBoolLua(x string) (*lua.FunctionProto, error) {
-	return CompileBoolLua(x)
+	return CompileLuaCached(fmt.Sprintf(BoolExprTemplate, x))
 }
 
-// CompileLua 编译lua脚本
+// CompileLua 编译lua脚本 使用全局编译缓存
 func (e *ScriptExecutor) CompileLua(x string) (*lua.FunctionProto, error) {
-	return CompileLua(x)
+	return CompileLuaCached(x)
 }
 
 // Execute 执行lua脚本 仅返回单个返回值
 func (e *ScriptExecutor) Execute(proto *lua.FunctionProto, bindings Bindings) (lua.LValue, error) {
-	L := e.pool.Get()
-	defer e.pool.Put(L)
-	args, err := Execute(L, proto, bindings)
+	return e.ExecuteCtx(context.Background(), proto, bindings)
+}
+
+// ExecuteCtx 执行lua脚本 执行期间ctx绑定到LState 取消后脚本在下一条指令中断
+func (e *ScriptExecutor) ExecuteCtx(ctx context.Context, proto *lua.FunctionProto, bindings Bindings) (lua.LValue, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	callCtx := ctx
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+	L, err := e.pool.GetCtx(callCtx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("lua execution cancelled: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("%w: %v", TimeoutLimitError, e.timeout)
+	}
+	// 不可取消的context不绑定 避免每条指令检查的开销
+	bound := callCtx.Done() != nil
+	if bound {
+		L.SetContext(callCtx)
+	}
+	args, err, broken := safeExecute(func() ([]lua.LValue, error) {
+		return execute(L, proto, bindings, e.pool.isolation == FreshEnv)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("lua execution cancelled: %w", ctx.Err())
+			broken = true
+		} else if limitErr := limitError(callCtx, e.timeout, err); limitErr != nil {
+			err = limitErr
+			broken = true
+		}
+	}
+	e.release(L, bound, broken)
 	if err != nil {
 		return nil, err
 	}
@@ -460,14 +918,41 @@ func (e *ScriptExecutor) Execute(proto *lua.FunctionProto, bindings Bindings) (l
 	return lua.LNil, nil
 }
 
+// release 重置LState后放回池中 被中断或超出限制的LState状态不可靠 直接关闭
+func (e *ScriptExecutor) release(L *lua.LState, bound, broken bool) {
+	if broken {
+		e.pool.Discard(L)
+		return
+	}
+	if bound {
+		L.RemoveContext()
+	}
+	L.SetTop(0)
+	e.pool.Put(L)
+}
+
 func (e *ScriptExecutor) ExecuteAndReturnBool(proto *lua.FunctionProto, bindings Bindings) (bool, error) {
-	res, err := e.Execute(proto, bindings)
+	return e.ExecuteAndReturnBoolCtx(context.Background(), proto, bindings)
+}
+
+func (e *ScriptExecutor) ExecuteAndReturnBoolCtx(ctx context.Context, proto *lua.FunctionProto, bindings Bindings) (bool, error) {
+	res, err := e.ExecuteCtx(ctx, proto, bindings)
 	if err != nil {
 		return false, err
 	}
 	return cast.ToBool(ToGoValue(res)), nil
 }
 
+// Lint 按执行器的库、函数和模块配置检查脚本
+func (e *ScriptExecutor) Lint(script string) []Diagnostic {
+	return Lint(script, e.pool.lintOpts())
+}
+
+// PoolStats LState池统计
+func (e *ScriptExecutor) PoolStats() PoolStats {
+	return e.pool.Stats()
+}
+
 func (e *ScriptExecutor) Close() {
 	e.pool.CloseAll()
 }
@@ -0,0 +1,129 @@
+package luautil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestExecuteCancel(t *testing.T) {
+	executor := newSandboxExecutor(t, SandboxOpts{})
+	proto, err := executor.CompileLua("while true do end")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err = executor.ExecuteCtx(ctx, proto, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect canceled but got %v", err)
+	}
+	// 被中断的LState通过Discard关闭 不再复用
+	if stats := executor.PoolStats(); stats.Idle != 0 || stats.Active != 0 || stats.Closed != 1 {
+		t.Fatalf("unexpected pool stats %+v", stats)
+	}
+	// 已取消的ctx不获取LState
+	if _, err = executor.ExecuteCtx(ctx, proto, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect canceled but got %v", err)
+	}
+	if stats := executor.PoolStats(); stats.Gets != 1 {
+		t.Fatalf("expect no more gets but got %+v", stats)
+	}
+}
+
+func TestPoolIsolation(t *testing.T) {
+	tamper := `
+		leaked = 1
+		_G.explicit = 2
+		string.upper = nil
+		require("strings").rep = nil
+		return true
+	`
+	check := `return leaked == nil and explicit == nil and string.upper ~= nil and require("strings").rep ~= nil`
+	tests := []struct {
+		isolation Isolation
+		expect    bool
+	}{
+		{NoIsolation, false},
+		{ResetGlobals, true},
+		{FreshEnv, true},
+	}
+	for _, test := range tests {
+		executor, err := NewScriptExecutorWithOpts(ScriptExecutorOpts{
+			LStatePoolOpts: LStatePoolOpts{MaxSize: 1, Modules: NewStdModuleRegistry(), Isolation: test.isolation},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, script := range []string{tamper, check} {
+			proto, err := executor.CompileLua(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ret, err := executor.ExecuteAndReturnBool(proto, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if script == check && ret != test.expect {
+				t.Fatalf("isolation %d: expect %v but got %v", test.isolation, test.expect, ret)
+			}
+		}
+		// 复用同一个LState
+		if stats := executor.PoolStats(); stats.Created != 1 {
+			t.Fatalf("expect state reused but got %+v", stats)
+		}
+		executor.Close()
+	}
+}
+
+func TestPoolMaxReuse(t *testing.T) {
+	executor, err := NewScriptExecutorWithOpts(ScriptExecutorOpts{
+		LStatePoolOpts: LStatePoolOpts{MaxSize: 1, MaxReuse: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer executor.Close()
+	proto, err := executor.CompileLua("return 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err = executor.Execute(proto, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := executor.PoolStats(); stats.Created != 2 || stats.Retired != 1 || stats.Closed != 1 || stats.Idle != 1 {
+		t.Fatalf("unexpected pool stats %+v", stats)
+	}
+}
+
+func TestPoolBlocking(t *testing.T) {
+	pool, err := NewLStatePoolWithOpts(LStatePoolOpts{MaxSize: 1, Blocking: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.CloseAll()
+	L := pool.Get()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err = pool.GetCtx(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded but got %v", err)
+	}
+	got := make(chan *lua.LState, 1)
+	go func() {
+		got <- pool.Get()
+	}()
+	for pool.Stats().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	pool.Put(L)
+	if waited := <-got; waited != L {
+		t.Fatal("expect returned state reused")
+	}
+	if stats := pool.Stats(); stats.Created != 1 || stats.Waiting != 0 || stats.WaitTime <= 0 {
+		t.Fatalf("unexpected pool stats %+v", stats)
+	}
+}
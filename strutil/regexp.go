@@ -0,0 +1,25 @@
+package strutil
+
+import (
+	"github.com/LeeZXin/zsf-utils/collections/hashmap"
+	"regexp"
+)
+
+// regexpCacheSize 正则缓存最大数量 超过后淘汰最久未使用的
+const regexpCacheSize = 1024
+
+// regexps 正则缓存 表达式和脚本中动态传入的正则共用
+var regexps = hashmap.NewConcurrentLinkedHashMapWithLimitSize[string, *regexp.Regexp](true, regexpCacheSize)
+
+// CompileRegexp 编译正则 结果会被缓存 编译失败不缓存
+func CompileRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexps.Get(pattern); ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexps.Put(pattern, re)
+	return re, nil
+}
@@ -0,0 +1,77 @@
+package zengine
+
+import (
+	"context"
+	"github.com/LeeZXin/zsf-utils/exprutil"
+	"github.com/LeeZXin/zsf-utils/luautil"
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	// LuaConditionLang lua条件表达式 通过params访问bindings 如params.amount > 100
+	LuaConditionLang = "lua"
+	// ExprConditionLang 原生表达式 直接访问bindings 如amount > 100 && level == "vip"
+	ExprConditionLang = "expr"
+)
+
+// Condition 编译后的条件表达式 ctx用于控制执行超时和取消
+type Condition interface {
+	Evaluate(context.Context, luautil.Bindings) (bool, error)
+}
+
+// ConditionCompiler 条件表达式编译器
+type ConditionCompiler interface {
+	Compile(string) (Condition, error)
+}
+
+// LuaConditionCompiler 编译为lua 执行时从LState池借用
+type LuaConditionCompiler struct {
+	executor *luautil.ScriptExecutor
+}
+
+func NewLuaConditionCompiler(executor *luautil.ScriptExecutor) *LuaConditionCompiler {
+	return &LuaConditionCompiler{
+		executor: executor,
+	}
+}
+
+func (c *LuaConditionCompiler) Compile(expr string) (Condition, error) {
+	proto, err := c.executor.CompileBoolLua(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &luaCondition{
+		executor: c.executor,
+		proto:    proto,
+	}, nil
+}
+
+type luaCondition struct {
+	executor *luautil.ScriptExecutor
+	proto    *lua.FunctionProto
+}
+
+func (c *luaCondition) Evaluate(ctx context.Context, bindings luautil.Bindings) (bool, error) {
+	return c.executor.ExecuteAndReturnBoolCtx(ctx, c.proto, bindings)
+}
+
+// ExprConditionCompiler 使用exprutil编译 无需LState
+type ExprConditionCompiler struct{}
+
+func (*ExprConditionCompiler) Compile(expr string) (Condition, error) {
+	program, err := exprutil.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &exprCondition{
+		program: program,
+	}, nil
+}
+
+type exprCondition struct {
+	program *exprutil.Program
+}
+
+func (c *exprCondition) Evaluate(_ context.Context, bindings luautil.Bindings) (bool, error) {
+	return c.program.EvalBool(bindings)
+}
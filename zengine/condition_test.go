@@ -0,0 +1,119 @@
+package zengine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/LeeZXin/zsf-utils/luautil"
+)
+
+var conditionCases = []struct {
+	luaExpr  string
+	exprExpr string
+	expect   bool
+}{
+	{`params.amount > 100 and params.level == "vip"`, `amount > 100 && level == "vip"`, true},
+	{`params.amount * 2 - 1 >= 399`, `amount * 2 - 1 >= 399`, true},
+	{`params.user.age < 18 or params.user.name == "bob"`, `user.age < 18 || user.name == "bob"`, true},
+	{`string.upper(params.level) == "VIP"`, `upper(level) == "VIP"`, true},
+	{`params.tags[2] == "b"`, `tags[1] == "b"`, true},
+	{`not (params.amount % 3 == 0)`, `!(amount % 3 == 0)`, true},
+	{`params.amount < 100`, `amount < 100`, false},
+	{`params.amount > 100 and params.level ~= "vip"`, `amount > 100 && level != "vip"`, false},
+	{`params.user.age >= 30 and not (params.user.name == "bob")`, `user.age >= 30 && !(user.name == "bob")`, false},
+	{`params.missing == nil and params.amount + 1 == 201`, `missing == nil && amount + 1 == 201`, true},
+	{`params.user.missing ~= nil`, `user.missing != nil`, false},
+}
+
+func newConditionBindings() luautil.Bindings {
+	return luautil.Bindings{
+		"amount": 200,
+		"level":  "vip",
+		"user": map[string]any{
+			"name": "bob",
+			"age":  30,
+		},
+		"tags": []any{"a", "b"},
+	}
+}
+
+func TestConditionCompilers(t *testing.T) {
+	executor, err := luautil.NewScriptExecutor(10, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer executor.Close()
+	luaCompiler := NewLuaConditionCompiler(executor)
+	exprCompiler := &ExprConditionCompiler{}
+	bindings := newConditionBindings()
+	for _, c := range conditionCases {
+		luaCondition, err := luaCompiler.Compile(c.luaExpr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exprCondition, err := exprCompiler.Compile(c.exprExpr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		luaRet, err := luaCondition.Evaluate(context.Background(), bindings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exprRet, err := exprCondition.Evaluate(context.Background(), bindings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if luaRet != c.expect || exprRet != c.expect {
+			t.Fatalf("%s: expect %v but got lua %v, expr %v", c.exprExpr, c.expect, luaRet, exprRet)
+		}
+	}
+	for _, expr := range []string{`amount >`, `unknown(1)`, `"abc`, `a ? b`} {
+		if _, err = exprCompiler.Compile(expr); err == nil {
+			t.Fatalf("%s: expect compile error", expr)
+		}
+	}
+	// lua条件使用调用方的ctx 已取消时不再执行
+	condition, err := luaCompiler.Compile(conditionCases[0].luaExpr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = condition.Evaluate(ctx, bindings); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect canceled but got %v", err)
+	}
+}
+
+func BenchmarkLuaCondition(b *testing.B) {
+	executor, err := luautil.NewScriptExecutor(10, 1, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer executor.Close()
+	condition, err := NewLuaConditionCompiler(executor).Compile(conditionCases[0].luaExpr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	bindings := newConditionBindings()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err = condition.Evaluate(context.Background(), bindings); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExprCondition(b *testing.B) {
+	condition, err := (&ExprConditionCompiler{}).Compile(conditionCases[0].exprExpr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	bindings := newConditionBindings()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err = condition.Evaluate(context.Background(), bindings); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
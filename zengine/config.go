@@ -1,9 +1,10 @@
 package zengine
 
 import (
+	"github.com/LeeZXin/zsf-utils/backoffutil"
 	"github.com/LeeZXin/zsf-utils/collections/hashmap"
 	"github.com/LeeZXin/zsf-utils/luautil"
-	lua "github.com/yuin/gopher-lua"
+	"time"
 )
 
 // HandlerConfig 执行函数信息
@@ -28,24 +29,56 @@ type NodeConfig struct {
 	Handler HandlerConfig `json:"handler"`
 	// Next 下一节点信息
 	Next []NextConfig `json:"next"`
+	// Parallel 满足条件的下一节点并行执行 等待全部分支完成
+	Parallel bool `json:"parallel"`
+	// MergeStrategy 并行分支写入GlobalBindings的合并规则 默认override
+	MergeStrategy string `json:"mergeStrategy"`
+	// Join 汇聚节点 all等待所在并行块全部分支 any第一个到达即执行
+	Join string `json:"join"`
+	// MaxIterations 循环节点单次执行的最大次数 环中必须包含循环节点
+	MaxIterations int `json:"maxIterations"`
+	// Retry handler失败后的重试次数
+	Retry int `json:"retry"`
+	// RetryDelay 首次重试间隔 单位毫秒 之后指数退避 为0使用backoffutil默认配置
+	RetryDelay int64 `json:"retryDelay"`
+	// Timeout 单次执行超时时间 单位毫秒 为0不限制
+	Timeout int64 `json:"timeout"`
+	// OnError 失败处理 fail、skip或goto 默认fail
+	OnError string `json:"onError"`
+	// Fallback onError为goto时跳转的节点
+	Fallback string `json:"fallback"`
 }
 
 // DAGConfig 有向图
 type DAGConfig struct {
+	// Name 有向图名称 用于统计和并发限制
+	Name string `json:"name"`
+	// Timeout 单次执行的全局超时时间 单位毫秒 为0使用执行器默认配置
+	Timeout int64 `json:"timeout"`
 	// StartNode
 	StartNode string `json:"startNode"`
 	// Nodes 节点信息列表
 	Nodes []NodeConfig `json:"nodes"`
+	// Inputs 执行时由调用方传入的字段 用于检查handler的必填输入
+	Inputs Schema `json:"inputs"`
+	// ConditionLang 条件表达式语言 lua或expr 为空使用执行器默认配置
+	ConditionLang string `json:"conditionLang"`
 }
 
 // DAG 有向图
 type DAG struct {
+	name    string
+	timeout time.Duration
 	// startNode
 	startNode string
 	// nodes 节点信息列表
 	nodes *hashmap.HashMap[string, *Node]
 }
 
+func (d *DAG) Name() string {
+	return d.name
+}
+
 func (d *DAG) StartNode() string {
 	return d.startNode
 }
@@ -62,11 +95,31 @@ type Node struct {
 	Params *InputParams
 	// Next 下一节点信息
 	Next []Next
+	// Parallel 下一节点并行执行
+	Parallel bool
+	// MergeStrategy 并行分支合并规则
+	MergeStrategy string
+	// Join 汇聚类型
+	Join string
+	// MaxIterations 循环节点最大执行次数
+	MaxIterations int
+	// Retry 重试次数
+	Retry int
+	// RetryStrategy 重试退避策略
+	RetryStrategy backoffutil.Strategy
+	// Timeout 单次执行超时时间
+	Timeout time.Duration
+	// OnError 失败处理
+	OnError string
+	// Fallback 失败跳转节点
+	Fallback string
 }
 
 // Next 下一节点
 type Next struct {
-	Condition *lua.FunctionProto
+	// ConditionExpr 条件表达式原文
+	ConditionExpr string
+	Condition     Condition
 	// NextNode 下一节点名称
 	NextNode string
 }
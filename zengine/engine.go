@@ -4,9 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/LeeZXin/zsf-utils/collections/hashmap"
+	"github.com/LeeZXin/zsf-utils/executor"
 	"github.com/LeeZXin/zsf-utils/luautil"
 	"strconv"
+	"sync"
+	"time"
 )
 
 type InputParams struct {
@@ -40,6 +44,45 @@ type ExecContext struct {
 	globalBindings luautil.Bindings
 	ctx            context.Context
 	luaExecutor    *luautil.ScriptExecutor
+	// scope 所在并行块的汇聚作用域
+	scope *joinScope
+	// loops 循环节点执行次数 并行分支共享
+	loops *loopCounter
+	// tracer 执行追踪 为nil不记录
+	tracer *Tracer
+	// suspends 挂起的节点 仅工作流执行时不为nil
+	suspends *suspendList
+	executor *DAGExecutor
+	// depth 子图嵌套深度
+	depth int
+}
+
+// loopCounter 循环节点计数
+type loopCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+	// sum 所有循环节点的执行次数
+	sum int
+}
+
+func newLoopCounter() *loopCounter {
+	return &loopCounter{
+		counts: make(map[string]int, 8),
+	}
+}
+
+func (c *loopCounter) incr(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[name]++
+	c.sum++
+	return c.counts[name]
+}
+
+func (c *loopCounter) total() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sum
 }
 
 func (e *ExecContext) Context() context.Context {
@@ -54,29 +97,106 @@ func (e *ExecContext) LuaExecutor() *luautil.ScriptExecutor {
 	return e.luaExecutor
 }
 
+// SetTracer 开启执行追踪
+func (e *ExecContext) SetTracer(tracer *Tracer) {
+	e.tracer = tracer
+}
+
+func (e *ExecContext) Tracer() *Tracer {
+	return e.tracer
+}
+
+// fork 派生并行分支的上下文
+func (e *ExecContext) fork(ctx context.Context, bindings luautil.Bindings, scope *joinScope) *ExecContext {
+	return &ExecContext{
+		globalBindings: bindings,
+		ctx:            ctx,
+		luaExecutor:    e.luaExecutor,
+		scope:          scope,
+		loops:          e.loops,
+		tracer:         e.tracer,
+		executor:       e.executor,
+		depth:          e.depth,
+	}
+}
+
 type DAGExecutor struct {
-	handlerMap  *hashmap.HashMap[string, Handler]
-	luaExecutor *luautil.ScriptExecutor
-	limitTimes  int
+	handlerMap       *hashmap.HashMap[string, Handler]
+	luaExecutor      *luautil.ScriptExecutor
+	limitTimes       int
+	parallelExecutor *executor.Executor
+	// conditionLang 默认条件表达式语言
+	conditionLang      string
+	conditionCompilers map[string]ConditionCompiler
+	metrics            *hashmap.ConcurrentHashMap[string, *dagMetrics]
+	limiters           *hashmap.ConcurrentHashMap[string, *runLimiter]
+	runTimeoutDuration time.Duration
+}
+
+type DAGExecutorOpts struct {
+	Handlers    []Handler
+	LuaExecutor *luautil.ScriptExecutor
+	LimitTimes  int
+	// ParallelExecutor 并行分支使用的协程池 为nil或被拒绝时新开协程
+	ParallelExecutor *executor.Executor
+	// ConditionLang 默认条件表达式语言 为空使用lua
+	ConditionLang string
+	// ConditionCompilers 自定义条件表达式语言 内置lua和expr
+	ConditionCompilers map[string]ConditionCompiler
+	// ConcurrencyLimits 按有向图名称限制并发执行数
+	ConcurrencyLimits map[string]ConcurrencyLimit
+	// RunTimeout 单次执行的全局超时时间 不依赖调用方的context 为0不限制
+	RunTimeout time.Duration
 }
 
 func NewDAGExecutor(handlers []Handler, luaExecutor *luautil.ScriptExecutor, limitTimes int) *DAGExecutor {
+	return NewDAGExecutorWithOpts(DAGExecutorOpts{
+		Handlers:    handlers,
+		LuaExecutor: luaExecutor,
+		LimitTimes:  limitTimes,
+	})
+}
+
+func NewDAGExecutorWithOpts(opts DAGExecutorOpts) *DAGExecutor {
 	handlerMap := hashmap.NewHashMap[string, Handler]()
-	for i := range handlers {
-		handler := handlers[i]
+	for i := range opts.Handlers {
+		handler := opts.Handlers[i]
 		handlerMap.Put(handler.GetName(), handler)
 	}
+	luaExecutor := opts.LuaExecutor
 	if luaExecutor == nil {
 		luaExecutor, _ = luautil.NewScriptExecutor(1000, 1, nil)
 	}
+	limitTimes := opts.LimitTimes
 	if limitTimes <= 0 {
 		limitTimes = 10000
 	}
-	return &DAGExecutor{
-		handlerMap:  handlerMap,
-		luaExecutor: luaExecutor,
-		limitTimes:  limitTimes,
+	compilers := map[string]ConditionCompiler{
+		LuaConditionLang:  NewLuaConditionCompiler(luaExecutor),
+		ExprConditionLang: &ExprConditionCompiler{},
+	}
+	for lang, compiler := range opts.ConditionCompilers {
+		compilers[lang] = compiler
+	}
+	conditionLang := opts.ConditionLang
+	if conditionLang == "" {
+		conditionLang = LuaConditionLang
+	}
+	ret := &DAGExecutor{
+		handlerMap:         handlerMap,
+		luaExecutor:        luaExecutor,
+		limitTimes:         limitTimes,
+		parallelExecutor:   opts.ParallelExecutor,
+		conditionLang:      conditionLang,
+		conditionCompilers: compilers,
+		metrics:            hashmap.NewConcurrentHashMap[string, *dagMetrics](),
+		limiters:           hashmap.NewConcurrentHashMap[string, *runLimiter](),
+		runTimeoutDuration: opts.RunTimeout,
 	}
+	for name, limit := range opts.ConcurrencyLimits {
+		ret.SetConcurrencyLimit(name, limit)
+	}
+	return ret
 }
 
 func (d *DAGExecutor) NewExecContext(ctx context.Context) *ExecContext {
@@ -87,6 +207,9 @@ func (d *DAGExecutor) NewExecContext(ctx context.Context) *ExecContext {
 		globalBindings: luautil.NewBindings(),
 		ctx:            ctx,
 		luaExecutor:    d.luaExecutor,
+		scope:          newJoinScope(),
+		loops:          newLoopCounter(),
+		executor:       d,
 	}
 }
 
@@ -99,7 +222,54 @@ func (d *DAGExecutor) Execute(dag *DAG, ectx *ExecContext) error {
 	if dag == nil {
 		return errors.New("nil dag")
 	}
-	return d.findAndExecute(dag, dag.StartNode(), ectx, 0)
+	return d.run(dag, ectx, func() error {
+		err := d.findAndExecute(dag, dag.StartNode(), ectx, 0)
+		if err == nil {
+			// 执行不在并行块内的all类型join节点
+			err = d.drainScope(dag, ectx.scope, ectx, 0)
+		}
+		return err
+	})
+}
+
+// run 单次执行的统一入口 包含全局截止时间、并发限制、统计和追踪 工作流执行同样经过这里
+func (d *DAGExecutor) run(dag *DAG, ectx *ExecContext, fn func() error) error {
+	if ectx.scope == nil {
+		ectx.scope = newJoinScope()
+	}
+	if ectx.loops == nil {
+		ectx.loops = newLoopCounter()
+	}
+	parent := ectx.ctx
+	// 全局截止时间包含排队时间
+	if timeout := d.runTimeout(dag); timeout > 0 {
+		ctx, cancel := context.WithTimeout(parent, timeout)
+		defer cancel()
+		ectx.ctx = ctx
+		defer func() {
+			ectx.ctx = parent
+		}()
+	}
+	release, err := d.acquireRun(ectx.ctx, dag.name)
+	if err != nil {
+		return d.wrapRunErr(parent, ectx.ctx, dag, err)
+	}
+	defer release()
+	startTime := time.Now()
+	ectx.tracer.begin(ectx.GlobalBindings())
+	err = fn()
+	err = d.wrapRunErr(parent, ectx.ctx, dag, err)
+	ectx.tracer.finish(ectx.GlobalBindings(), err)
+	d.recordRun(dag, time.Since(startTime), err)
+	return err
+}
+
+// wrapRunErr 调用方context未结束而全局截止时间已到时返回RunTimeoutError
+func (d *DAGExecutor) wrapRunErr(parent, ctx context.Context, dag *DAG, err error) error {
+	if err != nil && parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", RunTimeoutError, d.runTimeout(dag))
+	}
+	return err
 }
 
 // findAndExecute 找到节点信息并执行
@@ -114,27 +284,71 @@ func (d *DAGExecutor) findAndExecute(dag *DAG, name string, ectx *ExecContext, t
 	if !ok {
 		return errors.New("unknown node: " + name)
 	}
+	// join节点由所在作用域决定何时执行
+	if node.Join != "" && !ectx.scope.arrive(node, ectx) {
+		return nil
+	}
 	return d.executeNode(dag, node, ectx, times)
 }
 
 // executeNode 执行节点 递归深度优先遍历
 func (d *DAGExecutor) executeNode(dag *DAG, node *Node, ectx *ExecContext, times int) error {
-	handler, ok := d.handlerMap.Get(node.Params.HandlerConfig.Name)
-	if !ok {
-		return errors.New("unknown handler:" + node.Params.HandlerConfig.Name)
+	if node.MaxIterations > 0 && ectx.loops.incr(node.Name) > node.MaxIterations {
+		return fmt.Errorf("node %s out of max iterations: %d", node.Name, node.MaxIterations)
 	}
-	output, err := handler.Do(node.Params, ectx.GlobalBindings(), ectx)
-	if err != nil {
-		return err
+	nodeTrace := ectx.tracer.beginNode(node, ectx.GlobalBindings())
+	startTime := time.Now()
+	attempts, err := d.handleWithPolicy(node, ectx)
+	var suspendErr *SuspendError
+	if errors.As(err, &suspendErr) {
+		d.recordNode(dag, node, time.Since(startTime), nil)
+		nodeTrace.end(ectx.GlobalBindings(), nil)
+		return ectx.suspend(node, suspendErr, times)
 	}
-	if output != nil {
-		ectx.GlobalBindings().PutAll(output)
+	d.recordNode(dag, node, time.Since(startTime), err)
+	// 整体执行已取消时不再降级
+	recoverable := err != nil && ectx.ctx.Err() == nil && (node.OnError == SkipOnError || node.OnError == GotoOnError)
+	if recoverable {
+		ectx.GlobalBindings()[ErrorBindingKey] = errorDetail(node, attempts, err)
 	}
+	nodeTrace.end(ectx.GlobalBindings(), err)
+	if err != nil {
+		if !recoverable {
+			return err
+		}
+		if node.OnError == GotoOnError {
+			return d.findAndExecute(dag, node.Fallback, ectx, times+1)
+		}
+	}
+	return d.executeNext(dag, node, ectx, nodeTrace, times)
+}
+
+// executeNext 计算下一节点条件并执行
+func (d *DAGExecutor) executeNext(dag *DAG, node *Node, ectx *ExecContext, nodeTrace *NodeTrace, times int) error {
 	next := node.Next
 	if next != nil {
 		times = times + 1
+		if node.Parallel {
+			// 并行时先计算全部条件 再同时执行
+			names := make([]string, 0, len(next))
+			for _, n := range next {
+				res, err := n.Condition.Evaluate(ectx.Context(), ectx.GlobalBindings())
+				nodeTrace.addEdge(n, res, err)
+				if err != nil {
+					return err
+				}
+				if res {
+					names = append(names, n.NextNode)
+				}
+			}
+			if len(names) > 0 {
+				return d.executeParallel(dag, node, names, ectx, times)
+			}
+			return nil
+		}
 		for _, n := range next {
-			res, err := d.luaExecutor.ExecuteAndReturnBool(n.Condition, ectx.GlobalBindings())
+			res, err := n.Condition.Evaluate(ectx.Context(), ectx.GlobalBindings())
+			nodeTrace.addEdge(n, res, err)
 			if err != nil {
 				return err
 			}
@@ -149,6 +363,28 @@ func (d *DAGExecutor) executeNode(dag *DAG, node *Node, ectx *ExecContext, times
 	return nil
 }
 
+// doHandle 执行节点handler 并写入全局bindings
+func (d *DAGExecutor) doHandle(node *Node, ectx *ExecContext) error {
+	handler, ok := d.handlerMap.Get(node.Params.HandlerConfig.Name)
+	if !ok {
+		return errors.New("unknown handler:" + node.Params.HandlerConfig.Name)
+	}
+	if err := validateInput(node, handler, ectx.GlobalBindings()); err != nil {
+		return err
+	}
+	output, err := handler.Do(node.Params, ectx.GlobalBindings(), ectx)
+	if err != nil {
+		return err
+	}
+	if err = validateOutput(node, handler, output); err != nil {
+		return err
+	}
+	if output != nil {
+		ectx.GlobalBindings().PutAll(output)
+	}
+	return nil
+}
+
 func (d *DAGExecutor) BuildDAGFromJson(jsonConfig string) (*DAG, error) {
 	var c DAGConfig
 	err := json.Unmarshal([]byte(jsonConfig), &c)
@@ -158,58 +394,79 @@ func (d *DAGExecutor) BuildDAGFromJson(jsonConfig string) (*DAG, error) {
 	return d.BuildDAG(c)
 }
 
+// BuildDAG 校验并构建有向图 返回的DAGValidateError包含全部问题
 func (d *DAGExecutor) BuildDAG(config DAGConfig) (*DAG, error) {
-	nodes, err := d.buildNodes(config.Nodes)
-	if err != nil {
-		return nil, err
+	problems := d.validateConfig(config)
+	compiler, ok := d.conditionCompiler(config)
+	if !ok {
+		return nil, &DAGValidateError{Problems: problems}
+	}
+	nodes := hashmap.NewHashMap[string, *Node]()
+	for _, nodeConfig := range config.Nodes {
+		node, err := d.buildNode(nodeConfig, compiler)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("node %s: %v", nodeConfig.Name, err))
+			continue
+		}
+		nodes.Put(node.Name, node)
+	}
+	if len(problems) > 0 {
+		return nil, &DAGValidateError{Problems: problems}
 	}
 	return &DAG{
+		name:      config.Name,
+		timeout:   time.Duration(config.Timeout) * time.Millisecond,
 		startNode: config.StartNode,
 		nodes:     nodes,
 	}, nil
 }
 
-func (d *DAGExecutor) buildNext(config []NextConfig) ([]Next, error) {
+// conditionCompiler 获取有向图使用的条件表达式编译器
+func (d *DAGExecutor) conditionCompiler(config DAGConfig) (ConditionCompiler, bool) {
+	lang := config.ConditionLang
+	if lang == "" {
+		lang = d.conditionLang
+	}
+	compiler, ok := d.conditionCompilers[lang]
+	return compiler, ok
+}
+
+func (d *DAGExecutor) buildNext(config []NextConfig, compiler ConditionCompiler) ([]Next, error) {
 	if config == nil {
 		return nil, nil
 	}
 	ret := make([]Next, 0, len(config))
 	for _, nextConfig := range config {
-		proto, err := d.luaExecutor.CompileBoolLua(nextConfig.ConditionExpr)
+		condition, err := compiler.Compile(nextConfig.ConditionExpr)
 		if err != nil {
 			return nil, err
 		}
 		ret = append(ret, Next{
-			Condition: proto,
-			NextNode:  nextConfig.NextNode,
+			ConditionExpr: nextConfig.ConditionExpr,
+			Condition:     condition,
+			NextNode:      nextConfig.NextNode,
 		})
 	}
 	return ret, nil
 }
 
-func (d *DAGExecutor) buildNode(config NodeConfig) (*Node, error) {
-	next, err := d.buildNext(config.Next)
+func (d *DAGExecutor) buildNode(config NodeConfig, compiler ConditionCompiler) (*Node, error) {
+	next, err := d.buildNext(config.Next, compiler)
 	if err != nil {
 		return nil, err
 	}
 	return &Node{
-		Name:   config.Name,
-		Params: NewInputParams(config.Handler),
-		Next:   next,
+		Name:          config.Name,
+		Params:        NewInputParams(config.Handler),
+		Next:          next,
+		Parallel:      config.Parallel,
+		MergeStrategy: config.MergeStrategy,
+		Join:          config.Join,
+		MaxIterations: config.MaxIterations,
+		Retry:         config.Retry,
+		RetryStrategy: newRetryStrategy(config.RetryDelay),
+		Timeout:       time.Duration(config.Timeout) * time.Millisecond,
+		OnError:       config.OnError,
+		Fallback:      config.Fallback,
 	}, nil
 }
-
-func (d *DAGExecutor) buildNodes(config []NodeConfig) (*hashmap.HashMap[string, *Node], error) {
-	if config == nil {
-		return hashmap.NewHashMap[string, *Node](), nil
-	}
-	ret := hashmap.NewHashMap[string, *Node]()
-	for _, nodeConfig := range config {
-		node, err := d.buildNode(nodeConfig)
-		if err != nil {
-			return nil, err
-		}
-		ret.Put(node.Name, node)
-	}
-	return ret, nil
-}
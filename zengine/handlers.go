@@ -1,10 +1,27 @@
 package zengine
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zsf-utils/collections/hashmap"
+	"github.com/LeeZXin/zsf-utils/featuretree/tree"
+	"github.com/LeeZXin/zsf-utils/httputil"
 	"github.com/LeeZXin/zsf-utils/luautil"
+	"github.com/spf13/cast"
 	lua "github.com/yuin/gopher-lua"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
 )
 
+// MaxSubDAGDepth 子图最大嵌套深度
+const MaxSubDAGDepth = 32
+
+var templateRegexp = regexp.MustCompile(`\$\{([^}]+)}`)
+
 // ScriptHandler 脚本执行节点
 type ScriptHandler struct {
 }
@@ -15,15 +32,11 @@ func (*ScriptHandler) GetName() string {
 
 func (*ScriptHandler) Do(params *InputParams, bindings luautil.Bindings, ectx *ExecContext) (luautil.Bindings, error) {
 	output := luautil.NewBindings()
-	ctx := ectx.Context()
-	if ctx.Err() != nil {
-		return nil, ctx.Err()
-	}
 	script, err := params.GetCompiledScript()
 	if err != nil {
 		return output, err
 	}
-	scriptRet, err := ectx.LuaExecutor().Execute(script, bindings)
+	scriptRet, err := ectx.LuaExecutor().ExecuteCtx(ectx.Context(), script, bindings)
 	if err != nil {
 		return output, err
 	}
@@ -35,3 +48,372 @@ func (*ScriptHandler) Do(params *InputParams, bindings luautil.Bindings, ectx *E
 	}
 	return output, nil
 }
+
+// HttpHandler http调用节点
+// args: url、method(GET或POST 默认POST)、header、body 字符串中的${path}替换为bindings中的值
+// url中替换的值按所在位置转义 query {参数名: 值} 编码后追加到url
+// mapping {bindingKey: 响应路径} 为空时响应全部写入bindings
+type HttpHandler struct {
+	client *http.Client
+}
+
+func NewHttpHandler(client *http.Client) *HttpHandler {
+	if client == nil {
+		client = httputil.NewHttpClient()
+	}
+	return &HttpHandler{
+		client: client,
+	}
+}
+
+func (*HttpHandler) GetName() string {
+	return "httpNode"
+}
+
+func (h *HttpHandler) Do(params *InputParams, bindings luautil.Bindings, ectx *ExecContext) (luautil.Bindings, error) {
+	args := params.HandlerConfig.Args
+	rawUrl, ok := args.GetString("url")
+	if !ok || rawUrl == "" {
+		return nil, errors.New("empty url")
+	}
+	rawUrl = RenderUrl(rawUrl, bindings)
+	if query := argsMap(args, "query"); len(query) > 0 {
+		values := make(url.Values, len(query))
+		for k, v := range query {
+			values.Set(k, cast.ToString(RenderValue(v, bindings)))
+		}
+		rawUrl = appendQuery(rawUrl, values.Encode())
+	}
+	header := make(map[string]string)
+	for k, v := range argsMap(args, "header") {
+		header[k] = RenderTemplate(cast.ToString(v), bindings)
+	}
+	method, _ := args.GetString("method")
+	resp := luautil.NewBindings()
+	var err error
+	switch strings.ToUpper(method) {
+	case "", http.MethodPost:
+		var body any
+		if b, ok := args["body"]; ok {
+			body = RenderValue(b, bindings)
+		}
+		err = httputil.Post(ectx.Context(), h.client, rawUrl, header, body, &resp)
+	case http.MethodGet:
+		err = httputil.Get(ectx.Context(), h.client, rawUrl, header, &resp)
+	default:
+		return nil, errors.New("unsupported method: " + method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	mapping := argsMap(args, "mapping")
+	if len(mapping) == 0 {
+		return resp, nil
+	}
+	return mapBindings(mapping, resp), nil
+}
+
+// FeatureTreeHandler 特征树执行节点 结果写入bool类型binding
+// args: treeId、outputKey(默认treeId)、message(报文所在路径 为空使用全部bindings)
+type FeatureTreeHandler struct {
+	trees *hashmap.ConcurrentHashMap[string, *tree.FeatureTree]
+}
+
+func NewFeatureTreeHandler() *FeatureTreeHandler {
+	return &FeatureTreeHandler{
+		trees: hashmap.NewConcurrentHashMap[string, *tree.FeatureTree](),
+	}
+}
+
+func (*FeatureTreeHandler) GetName() string {
+	return "featureTreeNode"
+}
+
+// PutTree 注册特征树
+func (h *FeatureTreeHandler) PutTree(featureTree *tree.FeatureTree) {
+	if featureTree != nil {
+		h.trees.Put(featureTree.Id, featureTree)
+	}
+}
+
+// RemoveTree 删除特征树
+func (h *FeatureTreeHandler) RemoveTree(treeId string) {
+	h.trees.Remove(treeId)
+}
+
+func (h *FeatureTreeHandler) Do(params *InputParams, bindings luautil.Bindings, ectx *ExecContext) (luautil.Bindings, error) {
+	args := params.HandlerConfig.Args
+	treeId, _ := args.GetString("treeId")
+	featureTree, ok := h.trees.Get(treeId)
+	if !ok {
+		return nil, errors.New("unknown feature tree: " + treeId)
+	}
+	message := map[string]any(bindings)
+	if path, _ := args.GetString("message"); path != "" {
+		val, ok := bindings.Get(path)
+		if !ok {
+			return nil, errors.New("message not found: " + path)
+		}
+		message, ok = toStringMap(val)
+		if !ok {
+			return nil, errors.New("message should be a map: " + path)
+		}
+	}
+	outputKey, _ := args.GetString("outputKey")
+	if outputKey == "" {
+		outputKey = treeId
+	}
+	fctx := tree.BuildFeatureAnalyseContext(featureTree, message, ectx.Context())
+	result := tree.InitTreeAnalyser(fctx).Analyse()
+	// 超时和取消同样视为失败 交由节点策略处理
+	switch r := result.(type) {
+	case *tree.ErrMetricsResult:
+		return nil, r.Err
+	case *tree.TimeoutMetricsResult:
+		return nil, fmt.Errorf("feature tree %s: %w", treeId, context.DeadlineExceeded)
+	case *tree.CancelMetricsResult:
+		return nil, fmt.Errorf("feature tree %s: %w", treeId, context.Canceled)
+	}
+	return luautil.Bindings{
+		outputKey: result.IsSuccess(),
+	}, nil
+}
+
+// SubDAGHandler 子图执行节点
+// args: dag 子图名称、input {子图key: 路径} 为空时复制全部bindings、output {key: 子图路径} 为空时子图bindings全部写回
+type SubDAGHandler struct {
+	dags *hashmap.ConcurrentHashMap[string, *DAG]
+}
+
+func NewSubDAGHandler() *SubDAGHandler {
+	return &SubDAGHandler{
+		dags: hashmap.NewConcurrentHashMap[string, *DAG](),
+	}
+}
+
+func (*SubDAGHandler) GetName() string {
+	return "subDagNode"
+}
+
+// PutDAG 注册子图
+func (h *SubDAGHandler) PutDAG(name string, dag *DAG) {
+	if dag != nil {
+		h.dags.Put(name, dag)
+	}
+}
+
+// RemoveDAG 删除子图
+func (h *SubDAGHandler) RemoveDAG(name string) {
+	h.dags.Remove(name)
+}
+
+func (h *SubDAGHandler) Do(params *InputParams, bindings luautil.Bindings, ectx *ExecContext) (luautil.Bindings, error) {
+	args := params.HandlerConfig.Args
+	name, _ := args.GetString("dag")
+	dag, ok := h.dags.Get(name)
+	if !ok {
+		return nil, errors.New("unknown dag: " + name)
+	}
+	if ectx.depth >= MaxSubDAGDepth {
+		return nil, fmt.Errorf("sub dag out of max depth: %d", MaxSubDAGDepth)
+	}
+	sub := ectx.executor.NewExecContext(ectx.Context())
+	sub.depth = ectx.depth + 1
+	if input := argsMap(args, "input"); len(input) > 0 {
+		sub.GlobalBindings().PutAll(mapBindings(input, bindings))
+	} else {
+		sub.GlobalBindings().PutAll(copyBindings(bindings))
+	}
+	if err := ectx.executor.Execute(dag, sub); err != nil {
+		return nil, fmt.Errorf("sub dag %s: %w", name, err)
+	}
+	if output := argsMap(args, "output"); len(output) > 0 {
+		return mapBindings(output, sub.GlobalBindings()), nil
+	}
+	return sub.GlobalBindings(), nil
+}
+
+// MappingHandler bindings转换节点
+// args: mapping {key: 路径} 复制已有值、set {key: 值} 字符串中的${path}替换为bindings中的值
+type MappingHandler struct{}
+
+func (*MappingHandler) GetName() string {
+	return "mappingNode"
+}
+
+func (*MappingHandler) Do(params *InputParams, bindings luautil.Bindings, _ *ExecContext) (luautil.Bindings, error) {
+	args := params.HandlerConfig.Args
+	output := mapBindings(argsMap(args, "mapping"), bindings)
+	for k, v := range argsMap(args, "set") {
+		output[k] = RenderValue(v, bindings)
+	}
+	return output, nil
+}
+
+// SleepHandler 延时节点 args: duration 毫秒
+type SleepHandler struct{}
+
+func (*SleepHandler) GetName() string {
+	return "sleepNode"
+}
+
+func (*SleepHandler) InputSchema() Schema {
+	return nil
+}
+
+// OutputSchema 只等待 不写入bindings
+func (*SleepHandler) OutputSchema() Schema {
+	return nil
+}
+
+func (*SleepHandler) Do(params *InputParams, _ luautil.Bindings, ectx *ExecContext) (luautil.Bindings, error) {
+	duration, _ := params.HandlerConfig.Args.GetInt("duration")
+	if duration <= 0 {
+		return nil, nil
+	}
+	timer := time.NewTimer(time.Duration(duration) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-ectx.Context().Done():
+		return nil, ectx.Context().Err()
+	case <-timer.C:
+		return nil, nil
+	}
+}
+
+// EndHandler 空节点 用于标记结束
+type EndHandler struct{}
+
+func (*EndHandler) GetName() string {
+	return "endNode"
+}
+
+func (*EndHandler) InputSchema() Schema {
+	return nil
+}
+
+// OutputSchema 结束标记 没有输出字段
+func (*EndHandler) OutputSchema() Schema {
+	return nil
+}
+
+func (*EndHandler) Do(*InputParams, luautil.Bindings, *ExecContext) (luautil.Bindings, error) {
+	return nil, nil
+}
+
+// RenderTemplate 把${path}替换为bindings中的值 不存在替换为空字符串
+func RenderTemplate(tpl string, bindings luautil.Bindings) string {
+	return templateRegexp.ReplaceAllStringFunc(tpl, func(s string) string {
+		val, ok := bindings.Get(strings.TrimSpace(s[2 : len(s)-1]))
+		if !ok {
+			return ""
+		}
+		return cast.ToString(val)
+	})
+}
+
+// RenderUrl 同RenderTemplate 替换的值在path和fragment中按PathEscape转义 在query中按QueryEscape转义
+// 避免值中的/、?、&、#改变请求地址
+func RenderUrl(tpl string, bindings luautil.Bindings) string {
+	sb := strings.Builder{}
+	inQuery, inFragment := false, false
+	last := 0
+	for _, loc := range templateRegexp.FindAllStringIndex(tpl, -1) {
+		literal := tpl[last:loc[0]]
+		sb.WriteString(literal)
+		// 只有模板中的字面量决定所在位置
+		if strings.IndexByte(literal, '#') >= 0 {
+			inFragment = true
+		} else if !inFragment && strings.IndexByte(literal, '?') >= 0 {
+			inQuery = true
+		}
+		var val string
+		if v, ok := bindings.Get(strings.TrimSpace(tpl[loc[0]+2 : loc[1]-1])); ok {
+			val = cast.ToString(v)
+		}
+		if inQuery && !inFragment {
+			sb.WriteString(url.QueryEscape(val))
+		} else {
+			sb.WriteString(url.PathEscape(val))
+		}
+		last = loc[1]
+	}
+	sb.WriteString(tpl[last:])
+	return sb.String()
+}
+
+// appendQuery 追加编码后的query 保留fragment
+func appendQuery(rawUrl, query string) string {
+	fragment := ""
+	if i := strings.IndexByte(rawUrl, '#'); i >= 0 {
+		rawUrl, fragment = rawUrl[:i], rawUrl[i:]
+	}
+	switch {
+	case !strings.Contains(rawUrl, "?"):
+		rawUrl += "?"
+	case !strings.HasSuffix(rawUrl, "?") && !strings.HasSuffix(rawUrl, "&"):
+		rawUrl += "&"
+	}
+	return rawUrl + query + fragment
+}
+
+// RenderValue 递归替换字符串中的模板 整个字符串只有一个${path}时保留原类型
+func RenderValue(v any, bindings luautil.Bindings) any {
+	switch t := v.(type) {
+	case string:
+		loc := templateRegexp.FindStringSubmatchIndex(t)
+		if loc != nil && loc[0] == 0 && loc[1] == len(t) {
+			val, _ := bindings.Get(strings.TrimSpace(t[loc[2]:loc[3]]))
+			return val
+		}
+		return RenderTemplate(t, bindings)
+	case map[string]any:
+		ret := make(map[string]any, len(t))
+		for k, val := range t {
+			ret[k] = RenderValue(val, bindings)
+		}
+		return ret
+	case luautil.Bindings:
+		return RenderValue(map[string]any(t), bindings)
+	case []any:
+		ret := make([]any, 0, len(t))
+		for _, val := range t {
+			ret = append(ret, RenderValue(val, bindings))
+		}
+		return ret
+	default:
+		return v
+	}
+}
+
+// mapBindings 按{key: 路径}从bindings中取值 路径不存在的忽略
+func mapBindings(mapping map[string]any, bindings luautil.Bindings) luautil.Bindings {
+	ret := luautil.NewBindings()
+	for k, v := range mapping {
+		val, ok := bindings.Get(cast.ToString(v))
+		if ok {
+			ret[k] = val
+		}
+	}
+	return ret
+}
+
+func argsMap(args luautil.Bindings, key string) map[string]any {
+	val, ok := args[key]
+	if !ok {
+		return nil
+	}
+	ret, _ := toStringMap(val)
+	return ret
+}
+
+func toStringMap(v any) (map[string]any, bool) {
+	switch t := v.(type) {
+	case map[string]any:
+		return t, true
+	case luautil.Bindings:
+		return t, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,62 @@
+package zengine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/LeeZXin/zsf-utils/featuretree/tree"
+	"github.com/LeeZXin/zsf-utils/luautil"
+)
+
+func TestRenderUrl(t *testing.T) {
+	bindings := luautil.Bindings{
+		"id":   "1/../admin?x=1#f",
+		"name": "a&b=c d",
+		"user": map[string]any{"uid": 10},
+	}
+	tests := []struct {
+		tpl    string
+		expect string
+	}{
+		{"http://host/users/${id}", "http://host/users/1%2F..%2Fadmin%3Fx=1%23f"},
+		{"http://host/users?name=${name}&uid=${user.uid}", "http://host/users?name=a%26b%3Dc+d&uid=10"},
+		{"http://host/${user.uid}/items?q=${id}#${name}", "http://host/10/items?q=1%2F..%2Fadmin%3Fx%3D1%23f#a&b=c%20d"},
+		{"http://host/${missing}", "http://host/"},
+	}
+	for _, test := range tests {
+		if got := RenderUrl(test.tpl, bindings); got != test.expect {
+			t.Fatalf("render %s expect %s but got %s", test.tpl, test.expect, got)
+		}
+	}
+	if got := appendQuery("http://host/a?x=1#f", "y=2"); got != "http://host/a?x=1&y=2#f" {
+		t.Fatalf("unexpected url: %s", got)
+	}
+	if got := appendQuery("http://host/a", "y=2"); got != "http://host/a?y=2" {
+		t.Fatalf("unexpected url: %s", got)
+	}
+}
+
+func TestFeatureTreeHandler(t *testing.T) {
+	featureTree, err := tree.BuildFeatureTree("t", &tree.PlainInfo{
+		FeatureType: "message", FeatureKey: "x", DataType: "number", Operator: "eq", Value: "1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewFeatureTreeHandler()
+	handler.PutTree(featureTree)
+	executor := NewDAGExecutorWithOpts(DAGExecutorOpts{ConditionLang: ExprConditionLang})
+	defer executor.Close()
+	params := &InputParams{HandlerConfig: HandlerConfig{Args: luautil.Bindings{"treeId": "t"}}}
+	ret, err := handler.Do(params, luautil.Bindings{"x": 1}, executor.NewExecContext(context.Background()))
+	if err != nil || ret["t"] != true {
+		t.Fatalf("expect success but got %v %v", ret, err)
+	}
+	// 取消不能当作未命中
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = handler.Do(params, luautil.Bindings{"x": 1}, executor.NewExecContext(ctx)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect canceled but got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package zengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zsf-utils/collections/hashmap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencySampleSize 计算分位数保留的最近耗时样本数
+const latencySampleSize = 1024
+
+var (
+	// TooManyRunsError 超过最大并发执行数且配置为拒绝
+	TooManyRunsError = errors.New("too many concurrent runs")
+	// RunTimeoutError 单次执行超过全局截止时间
+	RunTimeoutError = errors.New("run deadline exceeded")
+)
+
+// ExecStats 执行统计快照
+type ExecStats struct {
+	Runs       int64         `json:"runs"`
+	Failures   int64         `json:"failures"`
+	AvgLatency time.Duration `json:"avgLatency"`
+	MaxLatency time.Duration `json:"maxLatency"`
+	// P50 P90 P99 基于最近的耗时样本
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+}
+
+// DAGStats 有向图及其节点的执行统计
+type DAGStats struct {
+	ExecStats
+	Nodes map[string]ExecStats `json:"nodes"`
+}
+
+type latencyStats struct {
+	mu       sync.Mutex
+	runs     int64
+	failures int64
+	total    time.Duration
+	max      time.Duration
+	samples  []time.Duration
+	next     int
+}
+
+func (s *latencyStats) record(latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs++
+	if err != nil {
+		s.failures++
+	}
+	s.total += latency
+	if latency > s.max {
+		s.max = latency
+	}
+	// 环形缓冲
+	if len(s.samples) < latencySampleSize {
+		s.samples = append(s.samples, latency)
+	} else {
+		s.samples[s.next] = latency
+		s.next = (s.next + 1) % latencySampleSize
+	}
+}
+
+func (s *latencyStats) snapshot() ExecStats {
+	s.mu.Lock()
+	samples := make([]time.Duration, len(s.samples))
+	copy(samples, s.samples)
+	ret := ExecStats{
+		Runs:       s.runs,
+		Failures:   s.failures,
+		MaxLatency: s.max,
+	}
+	if s.runs > 0 {
+		ret.AvgLatency = s.total / time.Duration(s.runs)
+	}
+	s.mu.Unlock()
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	ret.P50 = percentile(samples, 0.5)
+	ret.P90 = percentile(samples, 0.9)
+	ret.P99 = percentile(samples, 0.99)
+	return ret
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(float64(len(sorted))*p+0.5) - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+	return sorted[index]
+}
+
+type dagMetrics struct {
+	run   *latencyStats
+	nodes *hashmap.ConcurrentHashMap[string, *latencyStats]
+}
+
+func (d *DAGExecutor) dagMetricsOf(name string) *dagMetrics {
+	ret, _ := d.metrics.GetOrPut(name, &dagMetrics{
+		run:   &latencyStats{},
+		nodes: hashmap.NewConcurrentHashMap[string, *latencyStats](),
+	})
+	return ret
+}
+
+func (d *DAGExecutor) recordRun(dag *DAG, latency time.Duration, err error) {
+	d.dagMetricsOf(dag.name).run.record(latency, err)
+}
+
+func (d *DAGExecutor) recordNode(dag *DAG, node *Node, latency time.Duration, err error) {
+	stats, _ := d.dagMetricsOf(dag.name).nodes.GetOrPut(node.Name, &latencyStats{})
+	stats.record(latency, err)
+}
+
+// Stats 按有向图名称返回执行统计快照
+func (d *DAGExecutor) Stats() map[string]DAGStats {
+	ret := make(map[string]DAGStats)
+	d.metrics.Range(func(name string, m *dagMetrics) {
+		stats := DAGStats{
+			ExecStats: m.run.snapshot(),
+			Nodes:     make(map[string]ExecStats),
+		}
+		m.nodes.Range(func(node string, s *latencyStats) {
+			stats.Nodes[node] = s.snapshot()
+		})
+		ret[name] = stats
+	})
+	return ret
+}
+
+// ResetStats 清空执行统计
+func (d *DAGExecutor) ResetStats() {
+	d.metrics.Clear()
+}
+
+// ConcurrencyLimit 单个有向图的并发执行限制
+type ConcurrencyLimit struct {
+	// MaxRuns 最大并发执行数
+	MaxRuns int
+	// Reject 达到上限时直接返回TooManyRunsError 否则排队等待
+	Reject bool
+}
+
+type runLimiter struct {
+	sem    chan struct{}
+	reject bool
+}
+
+// SetConcurrencyLimit 设置有向图的并发执行限制 maxRuns小于等于0时取消限制
+// 修改前已获取的执行名额仍在旧限制内释放
+func (d *DAGExecutor) SetConcurrencyLimit(name string, limit ConcurrencyLimit) {
+	if limit.MaxRuns <= 0 {
+		d.limiters.Remove(name)
+		return
+	}
+	d.limiters.Put(name, &runLimiter{
+		sem:    make(chan struct{}, limit.MaxRuns),
+		reject: limit.Reject,
+	})
+}
+
+// acquireRun 获取执行名额 返回释放函数
+func (d *DAGExecutor) acquireRun(ctx context.Context, name string) (func(), error) {
+	limiter, ok := d.limiters.Get(name)
+	if !ok {
+		return func() {}, nil
+	}
+	release := func() {
+		<-limiter.sem
+	}
+	if limiter.reject {
+		select {
+		case limiter.sem <- struct{}{}:
+			return release, nil
+		default:
+			return nil, fmt.Errorf("%w: %s", TooManyRunsError, name)
+		}
+	}
+	select {
+	case limiter.sem <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// runTimeout 单次执行的全局截止时间 有向图配置优先
+func (d *DAGExecutor) runTimeout(dag *DAG) time.Duration {
+	if dag.timeout > 0 {
+		return dag.timeout
+	}
+	return d.runTimeoutDuration
+}
@@ -0,0 +1,112 @@
+package zengine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LeeZXin/zsf-utils/luautil"
+)
+
+func TestLatencyPercentile(t *testing.T) {
+	stats := &latencyStats{}
+	// 超过样本数 环形缓冲只保留最近的1024个
+	for i := 1; i <= 2000; i++ {
+		stats.record(time.Duration(i)*time.Millisecond, nil)
+	}
+	snapshot := stats.snapshot()
+	if snapshot.Runs != 2000 || snapshot.MaxLatency != 2000*time.Millisecond {
+		t.Fatalf("unexpected stats %+v", snapshot)
+	}
+	if snapshot.P50 != 1488*time.Millisecond || snapshot.P99 != 1990*time.Millisecond {
+		t.Fatalf("unexpected percentile p50 %v p99 %v", snapshot.P50, snapshot.P99)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	block := &funcHandler{
+		name: "block",
+		fn: func(_ *InputParams, _ luautil.Bindings, ectx *ExecContext) (luautil.Bindings, error) {
+			started <- struct{}{}
+			select {
+			case <-release:
+				return nil, nil
+			case <-ectx.Context().Done():
+				return nil, ectx.Context().Err()
+			}
+		},
+	}
+	executor := NewDAGExecutorWithOpts(DAGExecutorOpts{
+		Handlers:      []Handler{block},
+		ConditionLang: ExprConditionLang,
+		RunTimeout:    100 * time.Millisecond,
+	})
+	defer executor.Close()
+	dag, err := executor.BuildDAG(DAGConfig{
+		Name:      "limited",
+		StartNode: "block",
+		Nodes:     []NodeConfig{{Name: "block", Handler: HandlerConfig{Name: "block"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	execute := func() <-chan error {
+		ret := make(chan error, 1)
+		go func() {
+			ret <- executor.Execute(dag, executor.NewExecContext(context.Background()))
+		}()
+		return ret
+	}
+	t.Run("reject", func(t *testing.T) {
+		executor.SetConcurrencyLimit("limited", ConcurrencyLimit{MaxRuns: 1, Reject: true})
+		first := execute()
+		<-started
+		if err := executor.Execute(dag, executor.NewExecContext(context.Background())); !errors.Is(err, TooManyRunsError) {
+			t.Fatalf("expect too many runs but got %v", err)
+		}
+		release <- struct{}{}
+		if err := <-first; err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("wait", func(t *testing.T) {
+		executor.SetConcurrencyLimit("limited", ConcurrencyLimit{MaxRuns: 1})
+		first := execute()
+		<-started
+		second := execute()
+		select {
+		case <-started:
+			t.Fatal("expect second run waiting")
+		case <-time.After(20 * time.Millisecond):
+		}
+		release <- struct{}{}
+		<-started
+		release <- struct{}{}
+		if err := <-first; err != nil {
+			t.Fatal(err)
+		}
+		if err := <-second; err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("run timeout", func(t *testing.T) {
+		executor.ResetStats()
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		first := execute()
+		<-started
+		// 排队时间计入全局截止时间
+		if err := executor.Execute(dag, executor.NewExecContext(ctx)); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expect caller deadline but got %v", err)
+		}
+		if err := <-first; !errors.Is(err, RunTimeoutError) {
+			t.Fatalf("expect run timeout but got %v", err)
+		}
+		stats := executor.Stats()["limited"]
+		if stats.Runs != 1 || stats.Failures != 1 || stats.Nodes["block"].Failures != 1 {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+	})
+}
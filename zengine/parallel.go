@@ -0,0 +1,226 @@
+package zengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zsf-utils/luautil"
+	"reflect"
+	"sync"
+)
+
+const (
+	// JoinAll 等待所在并行块的全部分支完成后执行一次
+	JoinAll = "all"
+	// JoinAny 第一个到达的分支执行 之后到达的忽略
+	JoinAny = "any"
+)
+
+const (
+	// OverrideMerge 按分支顺序合并 后面的分支覆盖前面的
+	OverrideMerge = "override"
+	// KeepFirstMerge 按分支顺序合并 保留先写入的值
+	KeepFirstMerge = "keepFirst"
+	// ConflictMerge 不同分支写入同一key且值不同时报错
+	ConflictMerge = "conflict"
+)
+
+// anyArrival any类型join节点的执行记录
+type anyArrival struct {
+	// branch 执行join节点的分支
+	branch *ExecContext
+	// iterations 执行时循环节点的总执行次数
+	iterations int
+}
+
+// joinScope 并行块的汇聚作用域 记录到达的join节点
+type joinScope struct {
+	mu sync.Mutex
+	// pending 等待执行的all类型join节点 按到达顺序
+	pending []*Node
+	// arrived 已到达未执行的all类型join节点
+	arrived map[string]bool
+	// anyArrived 已执行的any类型join节点
+	anyArrived map[string]anyArrival
+}
+
+func newJoinScope() *joinScope {
+	return &joinScope{
+		arrived:    make(map[string]bool, 8),
+		anyArrived: make(map[string]anyArrival, 8),
+	}
+}
+
+// arrive 分支到达join节点 返回是否需要立即执行
+// all类型执行后可再次到达 any类型只有执行过的分支经过循环再次到达时才会重新执行
+func (s *joinScope) arrive(node *Node, ectx *ExecContext) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if node.Join == JoinAny {
+		iterations := ectx.loops.total()
+		if prev, ok := s.anyArrived[node.Name]; ok {
+			if prev.branch != ectx || prev.iterations == iterations {
+				return false
+			}
+		}
+		s.anyArrived[node.Name] = anyArrival{
+			branch:     ectx,
+			iterations: iterations,
+		}
+		return true
+	}
+	if s.arrived[node.Name] {
+		return false
+	}
+	s.arrived[node.Name] = true
+	s.pending = append(s.pending, node)
+	return false
+}
+
+// poll 取出一个等待执行的join节点 取出后可再次到达
+func (s *joinScope) poll() (*Node, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 {
+		return nil, false
+	}
+	ret := s.pending[0]
+	s.pending = s.pending[1:]
+	delete(s.arrived, ret.Name)
+	return ret, true
+}
+
+// drainScope 执行作用域内等待的join节点
+func (d *DAGExecutor) drainScope(dag *DAG, scope *joinScope, ectx *ExecContext, times int) error {
+	for {
+		node, ok := scope.poll()
+		if !ok {
+			return nil
+		}
+		if err := d.executeNode(dag, node, ectx, times); err != nil {
+			return err
+		}
+	}
+}
+
+// executeParallel 并行执行满足条件的下一节点 每个分支使用独立的bindings深拷贝 完成后合并
+func (d *DAGExecutor) executeParallel(dag *DAG, node *Node, names []string, ectx *ExecContext, times int) error {
+	ctx, cancel := context.WithCancel(ectx.ctx)
+	defer cancel()
+	snapshot := copyBindings(ectx.GlobalBindings())
+	scope := newJoinScope()
+	branches := make([]*ExecContext, len(names))
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i := range names {
+		branches[i] = ectx.fork(ctx, copyBindings(snapshot), scope)
+		index := i
+		wg.Add(1)
+		fn := func() {
+			defer wg.Done()
+			err := d.findAndExecute(dag, names[index], branches[index], times)
+			if err != nil {
+				errs[index] = err
+				// 取消兄弟分支
+				cancel()
+			}
+		}
+		if d.parallelExecutor == nil || d.parallelExecutor.Execute(fn) != nil {
+			go fn()
+		}
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+	}
+	if ectx.ctx.Err() != nil {
+		return ectx.ctx.Err()
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	if err := mergeBranches(ectx.GlobalBindings(), snapshot, branches, node.MergeStrategy); err != nil {
+		return fmt.Errorf("node %s: %w", node.Name, err)
+	}
+	return d.drainScope(dag, scope, ectx, times)
+}
+
+// mergeBranches 把各分支写入的值合并到全局bindings
+func mergeBranches(global, snapshot luautil.Bindings, branches []*ExecContext, strategy string) error {
+	written := make(map[string]int, 8)
+	for i, branch := range branches {
+		for k, v := range branch.GlobalBindings() {
+			old, ok := snapshot[k]
+			if ok && reflect.DeepEqual(old, v) {
+				continue
+			}
+			prev, hasPrev := written[k]
+			switch strategy {
+			case KeepFirstMerge:
+				if hasPrev {
+					continue
+				}
+			case ConflictMerge:
+				if hasPrev && !reflect.DeepEqual(branches[prev].GlobalBindings()[k], v) {
+					return fmt.Errorf("parallel branches write conflict on key: %s", k)
+				}
+			}
+			global[k] = v
+			written[k] = i
+		}
+	}
+	return nil
+}
+
+// copyBindings 深拷贝bindings 避免并行分支共享嵌套的map和切片
+func copyBindings(b luautil.Bindings) luautil.Bindings {
+	ret := make(luautil.Bindings, len(b))
+	for k, v := range b {
+		ret[k] = deepCopyValue(v)
+	}
+	return ret
+}
+
+// deepCopyValue 深拷贝map和切片 指针等其他类型不拷贝
+func deepCopyValue(v any) any {
+	if v == nil {
+		return nil
+	}
+	return deepCopyReflect(reflect.ValueOf(v)).Interface()
+}
+
+func deepCopyReflect(r reflect.Value) reflect.Value {
+	switch r.Kind() {
+	case reflect.Map:
+		if r.IsNil() {
+			return r
+		}
+		ret := reflect.MakeMapWithSize(r.Type(), r.Len())
+		iter := r.MapRange()
+		for iter.Next() {
+			ret.SetMapIndex(iter.Key(), deepCopyReflect(iter.Value()))
+		}
+		return ret
+	case reflect.Slice:
+		if r.IsNil() {
+			return r
+		}
+		ret := reflect.MakeSlice(r.Type(), r.Len(), r.Len())
+		for i := 0; i < r.Len(); i++ {
+			ret.Index(i).Set(deepCopyReflect(r.Index(i)))
+		}
+		return ret
+	case reflect.Interface:
+		if r.IsNil() {
+			return r
+		}
+		ret := reflect.New(r.Type()).Elem()
+		ret.Set(deepCopyReflect(r.Elem()))
+		return ret
+	}
+	return r
+}
@@ -0,0 +1,174 @@
+package zengine
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/LeeZXin/zsf-utils/luautil"
+)
+
+// funcHandler 测试用handler
+type funcHandler struct {
+	name string
+	fn   func(*InputParams, luautil.Bindings, *ExecContext) (luautil.Bindings, error)
+}
+
+func (h *funcHandler) GetName() string {
+	return h.name
+}
+
+func (h *funcHandler) Do(params *InputParams, bindings luautil.Bindings, ectx *ExecContext) (luautil.Bindings, error) {
+	return h.fn(params, bindings, ectx)
+}
+
+// counter 按节点统计执行次数
+type counter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *counter) handler() Handler {
+	return &funcHandler{
+		name: "count",
+		fn: func(params *InputParams, bindings luautil.Bindings, ectx *ExecContext) (luautil.Bindings, error) {
+			name, _ := params.HandlerConfig.Args.GetString("node")
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.counts[name]++
+			return luautil.Bindings{name: c.counts[name]}, nil
+		},
+	}
+}
+
+func (c *counter) get(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[name]
+}
+
+func countNode(name string, next ...NextConfig) NodeConfig {
+	return NodeConfig{
+		Name:    name,
+		Handler: HandlerConfig{Name: "count", Args: luautil.Bindings{"node": name}},
+		Next:    next,
+	}
+}
+
+func TestParallelNestedBindings(t *testing.T) {
+	write := &funcHandler{
+		name: "write",
+		fn: func(params *InputParams, bindings luautil.Bindings, ectx *ExecContext) (luautil.Bindings, error) {
+			branch, _ := params.HandlerConfig.Args.GetString("branch")
+			for i := 0; i < 100; i++ {
+				if err := bindings.SetPath("nested.values."+branch, i); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		},
+	}
+	executor := NewDAGExecutorWithOpts(DAGExecutorOpts{
+		Handlers:      []Handler{write, (&counter{counts: map[string]int{}}).handler()},
+		ConditionLang: ExprConditionLang,
+	})
+	defer executor.Close()
+	config := DAGConfig{
+		StartNode: "start",
+		Nodes: []NodeConfig{
+			{
+				Name:     "start",
+				Handler:  HandlerConfig{Name: "count", Args: luautil.Bindings{"node": "start"}},
+				Parallel: true,
+			},
+		},
+	}
+	for _, branch := range []string{"a", "b", "c", "d"} {
+		config.Nodes[0].Next = append(config.Nodes[0].Next, NextConfig{ConditionExpr: "true", NextNode: branch})
+		config.Nodes = append(config.Nodes, NodeConfig{
+			Name:    branch,
+			Handler: HandlerConfig{Name: "write", Args: luautil.Bindings{"branch": branch}},
+		})
+	}
+	dag, err := executor.BuildDAG(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ectx := executor.NewExecContext(context.Background())
+	nested := map[string]any{"values": map[string]any{}}
+	ectx.GlobalBindings()["nested"] = nested
+	if err = executor.Execute(dag, ectx); err != nil {
+		t.Fatal(err)
+	}
+	// 分支修改的是各自的副本
+	if len(nested["values"].(map[string]any)) != 0 {
+		t.Fatalf("snapshot modified: %v", nested)
+	}
+	if _, ok := ectx.GlobalBindings().Get("nested.values"); !ok {
+		t.Fatal("branch result not merged")
+	}
+}
+
+func TestJoinInLoop(t *testing.T) {
+	for _, join := range []string{JoinAll, JoinAny} {
+		t.Run(join, func(t *testing.T) {
+			c := &counter{counts: map[string]int{}}
+			executor := NewDAGExecutorWithOpts(DAGExecutorOpts{
+				Handlers:      []Handler{c.handler()},
+				ConditionLang: ExprConditionLang,
+			})
+			defer executor.Close()
+			loop := countNode("loop", NextConfig{ConditionExpr: "true", NextNode: "join"})
+			loop.MaxIterations = 10
+			joinNode := countNode("join", NextConfig{ConditionExpr: "join < 3", NextNode: "loop"})
+			joinNode.Join = join
+			dag, err := executor.BuildDAG(DAGConfig{
+				StartNode: "loop",
+				Nodes:     []NodeConfig{loop, joinNode},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = executor.Execute(dag, executor.NewExecContext(context.Background())); err != nil {
+				t.Fatal(err)
+			}
+			if c.get("join") != 3 || c.get("loop") != 3 {
+				t.Fatalf("expect join and loop executed 3 times but got %v", c.counts)
+			}
+		})
+	}
+}
+
+func TestJoinAnyInParallel(t *testing.T) {
+	c := &counter{counts: map[string]int{}}
+	executor := NewDAGExecutorWithOpts(DAGExecutorOpts{
+		Handlers:      []Handler{c.handler()},
+		ConditionLang: ExprConditionLang,
+	})
+	defer executor.Close()
+	start := countNode("start",
+		NextConfig{ConditionExpr: "true", NextNode: "a"},
+		NextConfig{ConditionExpr: "true", NextNode: "b"},
+	)
+	start.Parallel = true
+	joinNode := countNode("join")
+	joinNode.Join = JoinAny
+	dag, err := executor.BuildDAG(DAGConfig{
+		StartNode: "start",
+		Nodes: []NodeConfig{
+			start,
+			countNode("a", NextConfig{ConditionExpr: "true", NextNode: "join"}),
+			countNode("b", NextConfig{ConditionExpr: "true", NextNode: "join"}),
+			joinNode,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = executor.Execute(dag, executor.NewExecContext(context.Background())); err != nil {
+		t.Fatal(err)
+	}
+	if c.get("join") != 1 {
+		t.Fatalf("expect join executed once but got %d", c.get("join"))
+	}
+}
@@ -0,0 +1,94 @@
+package zengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zsf-utils/backoffutil"
+	"time"
+)
+
+const (
+	// FailOnError 节点执行失败时终止整个执行 默认
+	FailOnError = "fail"
+	// SkipOnError 忽略错误 继续计算下一节点条件
+	SkipOnError = "skip"
+	// GotoOnError 跳转到fallback节点执行 不再计算下一节点条件
+	GotoOnError = "goto"
+)
+
+// ErrorBindingKey 节点失败且未终止时 错误信息写入全局bindings的key
+// 值为map 包含node、message、timeout、attempts 条件表达式可通过params.nodeError.node判断
+const ErrorBindingKey = "nodeError"
+
+// NodeTimeoutError 节点执行超时
+var NodeTimeoutError = errors.New("node execute timeout")
+
+// withContext 替换上下文 其余信息共享
+func (e *ExecContext) withContext(ctx context.Context) *ExecContext {
+	return &ExecContext{
+		globalBindings: e.globalBindings,
+		ctx:            ctx,
+		luaExecutor:    e.luaExecutor,
+		scope:          e.scope,
+		loops:          e.loops,
+		tracer:         e.tracer,
+		suspends:       e.suspends,
+		executor:       e.executor,
+		depth:          e.depth,
+	}
+}
+
+// handleWithPolicy 按节点的重试和超时配置执行handler 返回错误和执行次数
+func (d *DAGExecutor) handleWithPolicy(node *Node, ectx *ExecContext) (int, error) {
+	var err error
+	attempts := 0
+	for {
+		attempts++
+		err = d.handleWithTimeout(node, ectx)
+		if err == nil || attempts > node.Retry || ectx.ctx.Err() != nil || isSuspendError(err) {
+			return attempts, err
+		}
+		timer := time.NewTimer(node.RetryStrategy.Backoff(attempts - 1))
+		select {
+		case <-ectx.ctx.Done():
+			timer.Stop()
+			return attempts, err
+		case <-timer.C:
+		}
+	}
+}
+
+// handleWithTimeout 超时通过子context传递给handler handler需响应ctx取消
+func (d *DAGExecutor) handleWithTimeout(node *Node, ectx *ExecContext) error {
+	if node.Timeout <= 0 {
+		return d.doHandle(node, ectx)
+	}
+	ctx, cancel := context.WithTimeout(ectx.ctx, node.Timeout)
+	defer cancel()
+	err := d.doHandle(node, ectx.withContext(ctx))
+	// 父context未结束 子context超时 handler已成功返回时输出已写入 保留结果避免重试重复执行
+	if err != nil && ectx.ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", NodeTimeoutError, node.Timeout)
+	}
+	return err
+}
+
+// errorDetail 暴露给下游条件的错误信息
+func errorDetail(node *Node, attempts int, err error) map[string]any {
+	return map[string]any{
+		"node":     node.Name,
+		"message":  err.Error(),
+		"timeout":  errors.Is(err, NodeTimeoutError),
+		"attempts": attempts,
+	}
+}
+
+// newRetryStrategy 以retryDelay为初始间隔的指数退避 为0使用默认配置
+func newRetryStrategy(retryDelay int64) backoffutil.Strategy {
+	config := backoffutil.DefaultConfig
+	if retryDelay > 0 {
+		config.BaseDelay = time.Duration(retryDelay) * time.Millisecond
+	}
+	return &backoffutil.Exponential{Config: config}
+}
@@ -0,0 +1,114 @@
+package zengine
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LeeZXin/zsf-utils/luautil"
+)
+
+func TestNodePolicy(t *testing.T) {
+	var calls int32
+	// flaky 前两次失败
+	flaky := &funcHandler{
+		name: "flaky",
+		fn: func(*InputParams, luautil.Bindings, *ExecContext) (luautil.Bindings, error) {
+			if atomic.AddInt32(&calls, 1) <= 2 {
+				return nil, errors.New("flaky")
+			}
+			return luautil.Bindings{"flaky": true}, nil
+		},
+	}
+	// slow 不响应ctx 超过超时时间后成功返回
+	slow := &funcHandler{
+		name: "slow",
+		fn: func(*InputParams, luautil.Bindings, *ExecContext) (luautil.Bindings, error) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(30 * time.Millisecond)
+			return luautil.Bindings{"slow": true}, nil
+		},
+	}
+	wait := &funcHandler{
+		name: "wait",
+		fn: func(_ *InputParams, _ luautil.Bindings, ectx *ExecContext) (luautil.Bindings, error) {
+			atomic.AddInt32(&calls, 1)
+			<-ectx.Context().Done()
+			return nil, ectx.Context().Err()
+		},
+	}
+	c := &counter{counts: map[string]int{}}
+	executor := NewDAGExecutorWithOpts(DAGExecutorOpts{
+		Handlers:      []Handler{flaky, slow, wait, c.handler()},
+		ConditionLang: ExprConditionLang,
+	})
+	defer executor.Close()
+	run := func(t *testing.T, start NodeConfig, others ...NodeConfig) (luautil.Bindings, error) {
+		atomic.StoreInt32(&calls, 0)
+		dag, err := executor.BuildDAG(DAGConfig{StartNode: start.Name, Nodes: append([]NodeConfig{start}, others...)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ectx := executor.NewExecContext(context.Background())
+		err = executor.Execute(dag, ectx)
+		return ectx.GlobalBindings(), err
+	}
+	t.Run("retry", func(t *testing.T) {
+		_, err := run(t, NodeConfig{Name: "a", Handler: HandlerConfig{Name: "flaky"}, Retry: 1, RetryDelay: 1})
+		if err == nil || calls != 2 {
+			t.Fatalf("expect failed after 2 calls but got %v %d", err, calls)
+		}
+		bindings, err := run(t, NodeConfig{Name: "a", Handler: HandlerConfig{Name: "flaky"}, Retry: 2, RetryDelay: 1})
+		if err != nil || calls != 3 || bindings["flaky"] != true {
+			t.Fatalf("expect success after 3 calls but got %v %d", err, calls)
+		}
+	})
+	t.Run("timeout", func(t *testing.T) {
+		_, err := run(t, NodeConfig{Name: "a", Handler: HandlerConfig{Name: "wait"}, Timeout: 10, Retry: 1, RetryDelay: 1})
+		if !errors.Is(err, NodeTimeoutError) || calls != 2 {
+			t.Fatalf("expect timeout after 2 calls but got %v %d", err, calls)
+		}
+		// 超时后成功返回的结果保留 不重试
+		bindings, err := run(t, NodeConfig{Name: "a", Handler: HandlerConfig{Name: "slow"}, Timeout: 10, Retry: 1, RetryDelay: 1})
+		if err != nil || calls != 1 || bindings["slow"] != true {
+			t.Fatalf("expect success kept but got %v %d", err, calls)
+		}
+	})
+	t.Run("skip", func(t *testing.T) {
+		bindings, err := run(t,
+			NodeConfig{
+				Name:    "a",
+				Handler: HandlerConfig{Name: "wait"},
+				Timeout: 10,
+				OnError: SkipOnError,
+				Next:    []NextConfig{{ConditionExpr: "nodeError.timeout", NextNode: "b"}},
+			},
+			countNode("b"),
+		)
+		if err != nil || c.get("b") != 1 {
+			t.Fatalf("expect b executed but got %v", err)
+		}
+		detail, _ := bindings[ErrorBindingKey].(map[string]any)
+		if detail["node"] != "a" || detail["attempts"] != 1 {
+			t.Fatalf("unexpected error detail %v", detail)
+		}
+	})
+	t.Run("goto", func(t *testing.T) {
+		_, err := run(t,
+			NodeConfig{
+				Name:     "a",
+				Handler:  HandlerConfig{Name: "flaky"},
+				OnError:  GotoOnError,
+				Fallback: "fallback",
+				Next:     []NextConfig{{ConditionExpr: "true", NextNode: "b"}},
+			},
+			countNode("b"),
+			countNode("fallback"),
+		)
+		if err != nil || c.get("fallback") != 1 || c.get("b") != 1 {
+			t.Fatalf("expect fallback executed only but got %v %v", err, c.counts)
+		}
+	})
+}
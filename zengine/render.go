@@ -0,0 +1,443 @@
+package zengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// graphNode 渲染用的节点信息
+type graphNode struct {
+	name     string
+	handler  string
+	join     string
+	parallel bool
+	fallback string
+	edges    []graphEdge
+}
+
+type graphEdge struct {
+	condition string
+	next      string
+}
+
+// ToDot 渲染为graphviz dot格式
+func (c DAGConfig) ToDot() string {
+	return renderDot(c.StartNode, configGraphNodes(c))
+}
+
+// ToMermaid 渲染为mermaid flowchart格式
+func (c DAGConfig) ToMermaid() string {
+	return renderMermaid(c.StartNode, configGraphNodes(c))
+}
+
+// ToDot 渲染为graphviz dot格式
+func (d *DAG) ToDot() string {
+	return renderDot(d.startNode, dagGraphNodes(d))
+}
+
+// ToMermaid 渲染为mermaid flowchart格式
+func (d *DAG) ToMermaid() string {
+	return renderMermaid(d.startNode, dagGraphNodes(d))
+}
+
+func configGraphNodes(c DAGConfig) []graphNode {
+	ret := make([]graphNode, 0, len(c.Nodes))
+	for _, node := range c.Nodes {
+		gn := graphNode{
+			name:     node.Name,
+			handler:  node.Handler.Name,
+			join:     node.Join,
+			parallel: node.Parallel,
+			edges:    make([]graphEdge, 0, len(node.Next)),
+		}
+		if node.OnError == GotoOnError {
+			gn.fallback = node.Fallback
+		}
+		for _, next := range node.Next {
+			gn.edges = append(gn.edges, graphEdge{
+				condition: next.ConditionExpr,
+				next:      next.NextNode,
+			})
+		}
+		ret = append(ret, gn)
+	}
+	return ret
+}
+
+func dagGraphNodes(d *DAG) []graphNode {
+	ret := make([]graphNode, 0, d.nodes.Size())
+	d.nodes.Range(func(_ string, node *Node) {
+		gn := graphNode{
+			name:     node.Name,
+			handler:  node.Params.HandlerConfig.Name,
+			join:     node.Join,
+			parallel: node.Parallel,
+			edges:    make([]graphEdge, 0, len(node.Next)),
+		}
+		if node.OnError == GotoOnError {
+			gn.fallback = node.Fallback
+		}
+		for _, next := range node.Next {
+			gn.edges = append(gn.edges, graphEdge{
+				condition: next.ConditionExpr,
+				next:      next.NextNode,
+			})
+		}
+		ret = append(ret, gn)
+	})
+	// map无序 开始节点在前 其余按名称排序
+	sort.SliceStable(ret, func(i, j int) bool {
+		if (ret[i].name == d.startNode) != (ret[j].name == d.startNode) {
+			return ret[i].name == d.startNode
+		}
+		return ret[i].name < ret[j].name
+	})
+	return ret
+}
+
+func renderDot(startNode string, nodes []graphNode) string {
+	var sb strings.Builder
+	sb.WriteString("digraph dag {\n")
+	sb.WriteString("  node [shape=box];\n")
+	for _, node := range nodes {
+		attrs := []string{"label=" + dotQuote(node.name+"\n"+node.handler)}
+		switch {
+		case node.name == startNode:
+			attrs = append(attrs, "shape=doubleoctagon")
+		case node.join != "":
+			attrs = append(attrs, "shape=diamond")
+		}
+		if node.parallel {
+			attrs = append(attrs, "peripheries=2")
+		}
+		fmt.Fprintf(&sb, "  %s [%s];\n", dotQuote(node.name), strings.Join(attrs, ", "))
+	}
+	for _, node := range nodes {
+		for _, edge := range node.edges {
+			fmt.Fprintf(&sb, "  %s -> %s [label=%s];\n", dotQuote(node.name), dotQuote(edge.next), dotQuote(edge.condition))
+		}
+		if node.fallback != "" {
+			fmt.Fprintf(&sb, "  %s -> %s [label=\"onError\", style=dashed];\n", dotQuote(node.name), dotQuote(node.fallback))
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+func renderMermaid(startNode string, nodes []graphNode) string {
+	// 节点名称可能包含mermaid保留字符 使用序号作为id
+	ids := make(map[string]string, len(nodes))
+	idOf := func(name string) string {
+		id, ok := ids[name]
+		if !ok {
+			id = "n" + strconv.Itoa(len(ids))
+			ids[name] = id
+		}
+		return id
+	}
+	var sb strings.Builder
+	sb.WriteString("flowchart TD\n")
+	for _, node := range nodes {
+		label := mermaidQuote(node.name + "<br/>" + node.handler)
+		switch {
+		case node.name == startNode:
+			fmt.Fprintf(&sb, "  %s([%s])\n", idOf(node.name), label)
+		case node.join != "":
+			fmt.Fprintf(&sb, "  %s{{%s}}\n", idOf(node.name), label)
+		default:
+			fmt.Fprintf(&sb, "  %s[%s]\n", idOf(node.name), label)
+		}
+	}
+	for _, node := range nodes {
+		arrow := "-->"
+		if node.parallel {
+			arrow = "==>"
+		}
+		for _, edge := range node.edges {
+			fmt.Fprintf(&sb, "  %s %s|%s| %s\n", idOf(node.name), arrow, mermaidQuote(edge.condition), idOf(edge.next))
+		}
+		if node.fallback != "" {
+			fmt.Fprintf(&sb, "  %s -.->|onError| %s\n", idOf(node.name), idOf(node.fallback))
+		}
+	}
+	return sb.String()
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
+
+// FieldChange 字段变化
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// NodeDiff 节点变化
+type NodeDiff struct {
+	Node    string        `json:"node"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// EdgeDiff 边变化 同一对节点间的多条边按顺序对应
+type EdgeDiff struct {
+	From         string `json:"from"`
+	To           string `json:"to"`
+	OldCondition string `json:"oldCondition,omitempty"`
+	NewCondition string `json:"newCondition,omitempty"`
+}
+
+// DAGConfigDiff 两个版本有向图配置的结构差异
+type DAGConfigDiff struct {
+	OldStartNode string `json:"oldStartNode,omitempty"`
+	NewStartNode string `json:"newStartNode,omitempty"`
+	// Changes 有向图级别的字段变化 如conditionLang、timeout
+	Changes      []FieldChange `json:"changes"`
+	AddedNodes   []string      `json:"addedNodes"`
+	RemovedNodes []string      `json:"removedNodes"`
+	ChangedNodes []NodeDiff    `json:"changedNodes"`
+	AddedEdges   []EdgeDiff    `json:"addedEdges"`
+	RemovedEdges []EdgeDiff    `json:"removedEdges"`
+	ChangedEdges []EdgeDiff    `json:"changedEdges"`
+}
+
+// IsEmpty 是否无变化
+func (d *DAGConfigDiff) IsEmpty() bool {
+	return d.OldStartNode == d.NewStartNode &&
+		len(d.Changes) == 0 &&
+		len(d.AddedNodes) == 0 &&
+		len(d.RemovedNodes) == 0 &&
+		len(d.ChangedNodes) == 0 &&
+		len(d.AddedEdges) == 0 &&
+		len(d.RemovedEdges) == 0 &&
+		len(d.ChangedEdges) == 0
+}
+
+// String 便于评审的文本格式 +新增 -删除 ~修改
+func (d *DAGConfigDiff) String() string {
+	var sb strings.Builder
+	if d.OldStartNode != d.NewStartNode {
+		fmt.Fprintf(&sb, "~ start node: %s -> %s\n", d.OldStartNode, d.NewStartNode)
+	}
+	for _, c := range d.Changes {
+		fmt.Fprintf(&sb, "~ dag %s: %s -> %s\n", c.Field, diffValue(c.Old), diffValue(c.New))
+	}
+	for _, node := range d.AddedNodes {
+		fmt.Fprintf(&sb, "+ node %s\n", node)
+	}
+	for _, node := range d.RemovedNodes {
+		fmt.Fprintf(&sb, "- node %s\n", node)
+	}
+	for _, node := range d.ChangedNodes {
+		for _, c := range node.Changes {
+			fmt.Fprintf(&sb, "~ node %s %s: %s -> %s\n", node.Node, c.Field, diffValue(c.Old), diffValue(c.New))
+		}
+	}
+	for _, edge := range d.AddedEdges {
+		fmt.Fprintf(&sb, "+ edge %s -> %s [%s]\n", edge.From, edge.To, edge.NewCondition)
+	}
+	for _, edge := range d.RemovedEdges {
+		fmt.Fprintf(&sb, "- edge %s -> %s [%s]\n", edge.From, edge.To, edge.OldCondition)
+	}
+	for _, edge := range d.ChangedEdges {
+		fmt.Fprintf(&sb, "~ edge %s -> %s: [%s] -> [%s]\n", edge.From, edge.To, edge.OldCondition, edge.NewCondition)
+	}
+	return sb.String()
+}
+
+func diffValue(v any) string {
+	if v == nil {
+		return "<nil>"
+	}
+	content, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(content)
+}
+
+// DiffDAGConfig 对比两个版本的有向图配置
+func DiffDAGConfig(oldConfig, newConfig DAGConfig) *DAGConfigDiff {
+	ret := &DAGConfigDiff{
+		Changes:      diffDAGFields(oldConfig, newConfig),
+		AddedNodes:   make([]string, 0),
+		RemovedNodes: make([]string, 0),
+		ChangedNodes: make([]NodeDiff, 0),
+		AddedEdges:   make([]EdgeDiff, 0),
+		RemovedEdges: make([]EdgeDiff, 0),
+		ChangedEdges: make([]EdgeDiff, 0),
+	}
+	if oldConfig.StartNode != newConfig.StartNode {
+		ret.OldStartNode = oldConfig.StartNode
+		ret.NewStartNode = newConfig.StartNode
+	}
+	oldNodes := make(map[string]NodeConfig, len(oldConfig.Nodes))
+	for _, node := range oldConfig.Nodes {
+		oldNodes[node.Name] = node
+	}
+	newNodes := make(map[string]NodeConfig, len(newConfig.Nodes))
+	for _, node := range newConfig.Nodes {
+		newNodes[node.Name] = node
+	}
+	for _, node := range newConfig.Nodes {
+		oldNode, ok := oldNodes[node.Name]
+		if !ok {
+			ret.AddedNodes = append(ret.AddedNodes, node.Name)
+			ret.AddedEdges = append(ret.AddedEdges, diffEdges(node.Name, nil, node.Next).AddedEdges...)
+			continue
+		}
+		if changes := diffNodeFields(oldNode, node); len(changes) > 0 {
+			ret.ChangedNodes = append(ret.ChangedNodes, NodeDiff{
+				Node:    node.Name,
+				Changes: changes,
+			})
+		}
+		edges := diffEdges(node.Name, oldNode.Next, node.Next)
+		ret.AddedEdges = append(ret.AddedEdges, edges.AddedEdges...)
+		ret.RemovedEdges = append(ret.RemovedEdges, edges.RemovedEdges...)
+		ret.ChangedEdges = append(ret.ChangedEdges, edges.ChangedEdges...)
+	}
+	for _, node := range oldConfig.Nodes {
+		if _, ok := newNodes[node.Name]; !ok {
+			ret.RemovedNodes = append(ret.RemovedNodes, node.Name)
+			ret.RemovedEdges = append(ret.RemovedEdges, diffEdges(node.Name, node.Next, nil).RemovedEdges...)
+		}
+	}
+	return ret
+}
+
+// diffDAGFields 对比有向图级别的字段 conditionLang变化时所有边条件的含义都会变化
+func diffDAGFields(oldConfig, newConfig DAGConfig) []FieldChange {
+	ret := make([]FieldChange, 0)
+	oldInputs, newInputs := oldConfig.Inputs, newConfig.Inputs
+	// 空的inputs视为相同
+	if len(oldInputs) == 0 && len(newInputs) == 0 {
+		oldInputs, newInputs = nil, nil
+	}
+	fields := []struct {
+		field    string
+		old, new any
+	}{
+		{"name", oldConfig.Name, newConfig.Name},
+		{"timeout", oldConfig.Timeout, newConfig.Timeout},
+		{"conditionLang", oldConfig.ConditionLang, newConfig.ConditionLang},
+		{"inputs", oldInputs, newInputs},
+	}
+	for _, f := range fields {
+		if reflect.DeepEqual(f.old, f.new) {
+			continue
+		}
+		ret = append(ret, FieldChange{
+			Field: f.field,
+			Old:   f.old,
+			New:   f.new,
+		})
+	}
+	return ret
+}
+
+// nodeFields 参与对比的节点字段 按固定顺序
+func nodeFields(node NodeConfig) [][2]any {
+	return [][2]any{
+		{"handler", node.Handler.Name},
+		{"parallel", node.Parallel},
+		{"mergeStrategy", node.MergeStrategy},
+		{"join", node.Join},
+		{"maxIterations", node.MaxIterations},
+		{"retry", node.Retry},
+		{"retryDelay", node.RetryDelay},
+		{"timeout", node.Timeout},
+		{"onError", node.OnError},
+		{"fallback", node.Fallback},
+	}
+}
+
+func diffNodeFields(oldNode, newNode NodeConfig) []FieldChange {
+	ret := make([]FieldChange, 0)
+	oldFields, newFields := nodeFields(oldNode), nodeFields(newNode)
+	for i := range oldFields {
+		if oldFields[i][1] != newFields[i][1] {
+			ret = append(ret, FieldChange{
+				Field: oldFields[i][0].(string),
+				Old:   oldFields[i][1],
+				New:   newFields[i][1],
+			})
+		}
+	}
+	keys := make([]string, 0, len(oldNode.Handler.Args)+len(newNode.Handler.Args))
+	for k := range oldNode.Handler.Args {
+		keys = append(keys, k)
+	}
+	for k := range newNode.Handler.Args {
+		if _, ok := oldNode.Handler.Args[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		oldVal, oldOk := oldNode.Handler.Args[k]
+		newVal, newOk := newNode.Handler.Args[k]
+		if oldOk == newOk && reflect.DeepEqual(oldVal, newVal) {
+			continue
+		}
+		ret = append(ret, FieldChange{
+			Field: "args." + k,
+			Old:   oldVal,
+			New:   newVal,
+		})
+	}
+	return ret
+}
+
+// diffEdges 对比同一节点的出边 相同目标节点的边按出现顺序对应
+func diffEdges(from string, oldNext, newNext []NextConfig) *DAGConfigDiff {
+	ret := &DAGConfigDiff{}
+	oldByTarget := make(map[string][]string)
+	for _, next := range oldNext {
+		oldByTarget[next.NextNode] = append(oldByTarget[next.NextNode], next.ConditionExpr)
+	}
+	used := make(map[string]int)
+	for _, next := range newNext {
+		index := used[next.NextNode]
+		used[next.NextNode]++
+		conditions := oldByTarget[next.NextNode]
+		if index >= len(conditions) {
+			ret.AddedEdges = append(ret.AddedEdges, EdgeDiff{
+				From:         from,
+				To:           next.NextNode,
+				NewCondition: next.ConditionExpr,
+			})
+		} else if conditions[index] != next.ConditionExpr {
+			ret.ChangedEdges = append(ret.ChangedEdges, EdgeDiff{
+				From:         from,
+				To:           next.NextNode,
+				OldCondition: conditions[index],
+				NewCondition: next.ConditionExpr,
+			})
+		}
+	}
+	for _, next := range oldNext {
+		if used[next.NextNode] > 0 {
+			used[next.NextNode]--
+			continue
+		}
+		ret.RemovedEdges = append(ret.RemovedEdges, EdgeDiff{
+			From:         from,
+			To:           next.NextNode,
+			OldCondition: next.ConditionExpr,
+		})
+	}
+	return ret
+}
@@ -0,0 +1,45 @@
+package zengine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffDAGConfig(t *testing.T) {
+	base := DAGConfig{
+		Name:      "dag",
+		StartNode: "a",
+		Nodes: []NodeConfig{
+			countNode("a", NextConfig{ConditionExpr: "params.x > 1", NextNode: "b"}),
+			countNode("b"),
+		},
+	}
+	if diff := DiffDAGConfig(base, base); !diff.IsEmpty() {
+		t.Fatalf("expect empty diff but got %s", diff)
+	}
+	changed := base
+	changed.Name = "dag2"
+	changed.Timeout = 100
+	changed.ConditionLang = ExprConditionLang
+	changed.Inputs = Schema{{Path: "x", Type: NumberType, Required: true}}
+	diff := DiffDAGConfig(base, changed)
+	if diff.IsEmpty() {
+		t.Fatal("expect dag level changes")
+	}
+	fields := make([]string, 0, len(diff.Changes))
+	for _, c := range diff.Changes {
+		fields = append(fields, c.Field)
+	}
+	if strings.Join(fields, ",") != "name,timeout,conditionLang,inputs" {
+		t.Fatalf("unexpected changes: %v", fields)
+	}
+	if !strings.Contains(diff.String(), `~ dag conditionLang: "" -> "expr"`) {
+		t.Fatalf("unexpected diff text: %s", diff)
+	}
+	// 空inputs视为相同
+	empty := base
+	empty.Inputs = Schema{}
+	if diff = DiffDAGConfig(base, empty); !diff.IsEmpty() {
+		t.Fatalf("expect empty diff but got %s", diff)
+	}
+}
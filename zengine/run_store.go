@@ -0,0 +1,213 @@
+package zengine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+	"xorm.io/xorm"
+)
+
+// RunStore 工作流执行状态存储
+type RunStore interface {
+	// Insert 保存新的执行状态
+	Insert(context.Context, *RunState) error
+	// Get 获取执行状态
+	Get(context.Context, string) (*RunState, bool, error)
+	// Update 版本号与存储一致时更新 成功后版本号加一
+	Update(context.Context, *RunState) (bool, error)
+	// Delete 删除执行状态
+	Delete(context.Context, string) error
+}
+
+// MemRunStore 内存存储 用于测试
+type MemRunStore struct {
+	mu     sync.Mutex
+	states map[string][]byte
+}
+
+func NewMemRunStore() *MemRunStore {
+	return &MemRunStore{
+		states: make(map[string][]byte, 8),
+	}
+}
+
+func (s *MemRunStore) Insert(_ context.Context, state *RunState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.states[state.RunId]; ok {
+		return errors.New("duplicate run id: " + state.RunId)
+	}
+	// 序列化保存 和持久化存储行为保持一致
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	s.states[state.RunId] = content
+	return nil
+}
+
+func (s *MemRunStore) Get(_ context.Context, runId string) (*RunState, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, ok := s.states[runId]
+	if !ok {
+		return nil, false, nil
+	}
+	var ret RunState
+	err := json.Unmarshal(content, &ret)
+	if err != nil {
+		return nil, false, err
+	}
+	return &ret, true, nil
+}
+
+func (s *MemRunStore) Update(_ context.Context, state *RunState) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, ok := s.states[state.RunId]
+	if !ok {
+		return false, nil
+	}
+	var old RunState
+	err := json.Unmarshal(content, &old)
+	if err != nil {
+		return false, err
+	}
+	if old.Version != state.Version {
+		return false, nil
+	}
+	state.Version++
+	content, err = json.Marshal(state)
+	if err != nil {
+		state.Version--
+		return false, err
+	}
+	s.states[state.RunId] = content
+	return true, nil
+}
+
+func (s *MemRunStore) Delete(_ context.Context, runId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, runId)
+	return nil
+}
+
+// RunModel 执行状态表结构 run_id唯一
+type RunModel struct {
+	Id       int64     `json:"id" xorm:"pk autoincr"`
+	RunId    string    `json:"runId" xorm:"varchar(64) notnull unique"`
+	Workflow string    `json:"workflow"`
+	Status   string    `json:"status"`
+	Content  string    `json:"content" xorm:"text"`
+	Version  int64     `json:"version"`
+	Created  time.Time `json:"created" xorm:"created"`
+	Updated  time.Time `json:"updated" xorm:"updated"`
+}
+
+type dbRunStore struct {
+	TableName string
+	Engine    *xorm.Engine
+}
+
+// CreateDbRunTable 创建执行状态表 run_id带唯一索引 表已存在时同步缺失的列和索引
+func CreateDbRunTable(engine *xorm.Engine, tableName string) error {
+	if engine == nil {
+		return errors.New("nil Engine")
+	}
+	if tableName == "" {
+		return errors.New("empty table name")
+	}
+	return engine.Table(tableName).Sync2(new(RunModel))
+}
+
+// NewDbRunStore xorm存储 使用乐观锁更新
+func NewDbRunStore(tableName string, engine *xorm.Engine) (RunStore, error) {
+	if tableName == "" {
+		return nil, errors.New("empty table name")
+	}
+	if engine == nil {
+		return nil, errors.New("nil Engine")
+	}
+	return &dbRunStore{
+		TableName: tableName,
+		Engine:    engine,
+	}, nil
+}
+
+func (s *dbRunStore) Insert(ctx context.Context, state *RunState) error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	session := s.Engine.NewSession().Context(ctx)
+	defer session.Close()
+	_, err = session.Table(s.TableName).Insert(&RunModel{
+		RunId:    state.RunId,
+		Workflow: state.Workflow,
+		Status:   state.Status,
+		Content:  string(content),
+		Version:  state.Version,
+	})
+	return err
+}
+
+func (s *dbRunStore) Get(ctx context.Context, runId string) (*RunState, bool, error) {
+	session := s.Engine.NewSession().Context(ctx)
+	defer session.Close()
+	var md RunModel
+	b, err := session.
+		Where("run_id = ?", runId).
+		Table(s.TableName).
+		Get(&md)
+	if err != nil || !b {
+		return nil, false, err
+	}
+	var ret RunState
+	err = json.Unmarshal([]byte(md.Content), &ret)
+	if err != nil {
+		return nil, false, err
+	}
+	// 以表中版本号为准
+	ret.Version = md.Version
+	return &ret, true, nil
+}
+
+func (s *dbRunStore) Update(ctx context.Context, state *RunState) (bool, error) {
+	version := state.Version
+	state.Version++
+	content, err := json.Marshal(state)
+	if err != nil {
+		state.Version = version
+		return false, err
+	}
+	session := s.Engine.NewSession().Context(ctx)
+	defer session.Close()
+	rows, err := session.
+		Where("run_id = ?", state.RunId).
+		And("version = ?", version).
+		Table(s.TableName).
+		Cols("status", "content", "version").
+		Update(&RunModel{
+			Status:  state.Status,
+			Content: string(content),
+			Version: state.Version,
+		})
+	if err != nil || rows != 1 {
+		state.Version = version
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *dbRunStore) Delete(ctx context.Context, runId string) error {
+	session := s.Engine.NewSession().Context(ctx)
+	defer session.Close()
+	_, err := session.
+		Where("run_id = ?", runId).
+		Table(s.TableName).
+		Delete(new(RunModel))
+	return err
+}
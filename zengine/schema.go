@@ -0,0 +1,310 @@
+package zengine
+
+import (
+	"fmt"
+	"github.com/LeeZXin/zsf-utils/luautil"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type FieldType string
+
+const (
+	AnyType    FieldType = "any"
+	StringType FieldType = "string"
+	NumberType FieldType = "number"
+	BoolType   FieldType = "bool"
+	MapType    FieldType = "map"
+	ArrayType  FieldType = "array"
+)
+
+// Field 字段定义 Path支持a.b嵌套路径
+type Field struct {
+	Path     string    `json:"path"`
+	Type     FieldType `json:"type"`
+	Required bool      `json:"required"`
+}
+
+// Schema 输入或输出的字段定义
+type Schema []Field
+
+// SchemaHandler 声明输入输出字段的handler
+// BuildDAG时静态检查必填输入在每条路径上都已产生 执行时校验输入输出
+type SchemaHandler interface {
+	Handler
+	InputSchema() Schema
+	OutputSchema() Schema
+}
+
+// SchemaError 输入输出校验错误
+type SchemaError struct {
+	Node string
+	// Kind input或output
+	Kind     string
+	Problems []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("node %s %s invalid: %s", e.Node, e.Kind, strings.Join(e.Problems, "; "))
+}
+
+// Validate 校验bindings 返回问题列表
+func (s Schema) Validate(bindings luautil.Bindings) []string {
+	problems := make([]string, 0)
+	for _, field := range s {
+		val, ok := bindings.Get(field.Path)
+		if !ok || val == nil {
+			if field.Required {
+				problems = append(problems, field.Path+": required")
+			}
+			continue
+		}
+		if actual := typeOf(val); !field.Type.accept(actual) {
+			problems = append(problems, fmt.Sprintf("%s: expect %s but got %s", field.Path, field.Type, actual))
+		}
+	}
+	return problems
+}
+
+func (t FieldType) accept(actual FieldType) bool {
+	return t == "" || t == AnyType || actual == AnyType || t == actual
+}
+
+func typeOf(val any) FieldType {
+	switch reflect.ValueOf(val).Kind() {
+	case reflect.String:
+		return StringType
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return NumberType
+	case reflect.Bool:
+		return BoolType
+	case reflect.Map, reflect.Struct:
+		return MapType
+	case reflect.Slice, reflect.Array:
+		return ArrayType
+	default:
+		return AnyType
+	}
+}
+
+// validateInput 执行前校验输入
+func validateInput(node *Node, handler Handler, bindings luautil.Bindings) error {
+	sh, ok := handler.(SchemaHandler)
+	if !ok {
+		return nil
+	}
+	if problems := sh.InputSchema().Validate(bindings); len(problems) > 0 {
+		return &SchemaError{Node: node.Name, Kind: "input", Problems: problems}
+	}
+	return nil
+}
+
+// validateOutput 执行后校验输出
+func validateOutput(node *Node, handler Handler, output luautil.Bindings) error {
+	sh, ok := handler.(SchemaHandler)
+	if !ok {
+		return nil
+	}
+	if output == nil {
+		output = luautil.NewBindings()
+	}
+	if problems := sh.OutputSchema().Validate(output); len(problems) > 0 {
+		return &SchemaError{Node: node.Name, Kind: "output", Problems: problems}
+	}
+	return nil
+}
+
+// fieldSet 路径上已确定产生的字段 all表示未知 可能产生任意字段
+type fieldSet struct {
+	all    bool
+	fields map[string]FieldType
+}
+
+func newFieldSet(schema Schema) *fieldSet {
+	ret := &fieldSet{
+		fields: make(map[string]FieldType, len(schema)),
+	}
+	ret.addSchema(schema, true)
+	return ret
+}
+
+func (s *fieldSet) copy() *fieldSet {
+	ret := &fieldSet{
+		all:    s.all,
+		fields: make(map[string]FieldType, len(s.fields)),
+	}
+	for k, v := range s.fields {
+		ret.fields[k] = v
+	}
+	return ret
+}
+
+// addSchema 加入schema中的字段 onlyRequired为false时可选字段也加入
+func (s *fieldSet) addSchema(schema Schema, onlyRequired bool) {
+	for _, field := range schema {
+		if onlyRequired && !field.Required {
+			continue
+		}
+		t := field.Type
+		if t == "" {
+			t = AnyType
+		}
+		s.fields[field.Path] = t
+	}
+}
+
+// intersect 每条路径都产生的字段
+func (s *fieldSet) intersect(o *fieldSet) *fieldSet {
+	if s.all {
+		return o.copy()
+	}
+	if o.all {
+		return s.copy()
+	}
+	ret := &fieldSet{
+		fields: make(map[string]FieldType, len(s.fields)),
+	}
+	for k, t := range s.fields {
+		if ot, ok := o.fields[k]; ok {
+			if ot != t {
+				t = AnyType
+			}
+			ret.fields[k] = t
+		}
+	}
+	return ret
+}
+
+// union 任一分支产生的字段
+func (s *fieldSet) union(o *fieldSet) *fieldSet {
+	ret := s.copy()
+	ret.all = s.all || o.all
+	for k, t := range o.fields {
+		if old, ok := ret.fields[k]; ok && old != t {
+			t = AnyType
+		}
+		ret.fields[k] = t
+	}
+	return ret
+}
+
+func (s *fieldSet) equal(o *fieldSet) bool {
+	return s.all == o.all && reflect.DeepEqual(s.fields, o.fields)
+}
+
+// lookup 查找路径 祖先或后代路径存在也视为存在
+func (s *fieldSet) lookup(path string) (FieldType, bool) {
+	if s.all {
+		return AnyType, true
+	}
+	if t, ok := s.fields[path]; ok {
+		return t, true
+	}
+	for k := range s.fields {
+		if strings.HasPrefix(path, k+".") {
+			return AnyType, true
+		}
+		if strings.HasPrefix(k, path+".") {
+			return MapType, true
+		}
+	}
+	return "", false
+}
+
+// checkSchemas 数据流分析 检查必填输入在每条到达路径上都已产生
+func (d *DAGExecutor) checkSchemas(config DAGConfig) []string {
+	nodes := make(map[string]NodeConfig, len(config.Nodes))
+	for _, node := range config.Nodes {
+		if node.Name != "" {
+			nodes[node.Name] = node
+		}
+	}
+	if _, ok := nodes[config.StartNode]; !ok {
+		return nil
+	}
+	schemaOf := func(node NodeConfig) (SchemaHandler, bool) {
+		handler, ok := d.handlerMap.Get(node.Handler.Name)
+		if !ok {
+			return nil, false
+		}
+		sh, ok := handler.(SchemaHandler)
+		return sh, ok
+	}
+	// in 到达节点时已产生的字段 nil表示尚未到达
+	in := make(map[string]*fieldSet, len(nodes))
+	in[config.StartNode] = newFieldSet(config.Inputs)
+	for changed := true; changed; {
+		changed = false
+		incoming := make(map[string][]*fieldSet, len(nodes))
+		incoming[config.StartNode] = []*fieldSet{newFieldSet(config.Inputs)}
+		for name, node := range nodes {
+			before, ok := in[name]
+			if !ok {
+				continue
+			}
+			after := before.copy()
+			if sh, ok := schemaOf(node); ok {
+				after.addSchema(sh.OutputSchema(), true)
+			} else {
+				after.all = true
+			}
+			// skip时输出不保证产生
+			nextSet := after
+			if node.OnError == SkipOnError {
+				nextSet = before
+			}
+			for _, next := range node.Next {
+				if _, ok := nodes[next.NextNode]; ok {
+					incoming[next.NextNode] = append(incoming[next.NextNode], nextSet)
+				}
+			}
+			if node.OnError == GotoOnError {
+				if _, ok := nodes[node.Fallback]; ok {
+					incoming[node.Fallback] = append(incoming[node.Fallback], before)
+				}
+			}
+		}
+		for name, sets := range incoming {
+			merged := sets[0]
+			for _, set := range sets[1:] {
+				// all类型join在全部到达的分支合并后执行
+				if nodes[name].Join == JoinAll {
+					merged = merged.union(set)
+				} else {
+					merged = merged.intersect(set)
+				}
+			}
+			if old, ok := in[name]; !ok || !old.equal(merged) {
+				in[name] = merged
+				changed = true
+			}
+		}
+	}
+	problems := make([]string, 0)
+	for _, node := range config.Nodes {
+		set, ok := in[node.Name]
+		if !ok {
+			continue
+		}
+		sh, ok := schemaOf(node)
+		if !ok {
+			continue
+		}
+		for _, field := range sh.InputSchema() {
+			if !field.Required {
+				continue
+			}
+			t, ok := set.lookup(field.Path)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("node %s: required input %s is not produced on every path", node.Name, field.Path))
+			} else if !field.Type.accept(t) {
+				problems = append(problems, fmt.Sprintf("node %s: input %s expect %s but upstream produces %s", node.Name, field.Path, field.Type, t))
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
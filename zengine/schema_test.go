@@ -0,0 +1,145 @@
+package zengine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/LeeZXin/zsf-utils/luautil"
+)
+
+// schemaHandler 测试用声明输入输出的handler
+type schemaHandler struct {
+	name    string
+	in, out Schema
+}
+
+func (h *schemaHandler) GetName() string {
+	return h.name
+}
+
+func (*schemaHandler) Do(*InputParams, luautil.Bindings, *ExecContext) (luautil.Bindings, error) {
+	return nil, nil
+}
+
+func (h *schemaHandler) InputSchema() Schema {
+	return h.in
+}
+
+func (h *schemaHandler) OutputSchema() Schema {
+	return h.out
+}
+
+func TestCheckSchemas(t *testing.T) {
+	required := func(path string, fieldType FieldType) Field {
+		return Field{Path: path, Type: fieldType, Required: true}
+	}
+	executor := NewDAGExecutorWithOpts(DAGExecutorOpts{
+		Handlers: []Handler{
+			&schemaHandler{name: "none"},
+			&schemaHandler{name: "produceX", out: Schema{required("x", NumberType)}},
+			&schemaHandler{name: "produceY", out: Schema{required("y", StringType)}},
+			&schemaHandler{name: "needX", in: Schema{required("x", NumberType)}},
+			&schemaHandler{name: "needXY", in: Schema{required("x", NumberType), required("y", StringType)}},
+			&schemaHandler{name: "needStringX", in: Schema{required("x", StringType)}},
+		},
+		ConditionLang: ExprConditionLang,
+	})
+	defer executor.Close()
+	node := func(name, handler string, next ...string) NodeConfig {
+		ret := NodeConfig{Name: name, Handler: HandlerConfig{Name: handler}}
+		for _, n := range next {
+			ret.Next = append(ret.Next, NextConfig{ConditionExpr: "true", NextNode: n})
+		}
+		return ret
+	}
+	parallel := func(n NodeConfig) NodeConfig {
+		n.Parallel = true
+		return n
+	}
+	join := func(n NodeConfig, joinType string) NodeConfig {
+		n.Join = joinType
+		return n
+	}
+	loop := func(n NodeConfig) NodeConfig {
+		n.MaxIterations = 3
+		return n
+	}
+	tests := []struct {
+		name   string
+		nodes  []NodeConfig
+		expect []string
+	}{
+		{
+			name:  "produced upstream",
+			nodes: []NodeConfig{node("a", "produceX", "b"), node("b", "needX")},
+		},
+		{
+			name:   "missing upstream output",
+			nodes:  []NodeConfig{node("a", "produceY", "b"), node("b", "needX")},
+			expect: []string{"node b: required input x is not produced on every path"},
+		},
+		{
+			name:   "type mismatch",
+			nodes:  []NodeConfig{node("a", "produceX", "b"), node("b", "needStringX")},
+			expect: []string{"node b: input x expect string but upstream produces number"},
+		},
+		{
+			name: "join all merges branches",
+			nodes: []NodeConfig{
+				parallel(node("s", "none", "p", "q")),
+				node("p", "produceX", "j"),
+				node("q", "produceY", "j"),
+				join(node("j", "needXY"), JoinAll),
+			},
+		},
+		{
+			name: "join any requires every branch",
+			nodes: []NodeConfig{
+				parallel(node("s", "none", "p", "q")),
+				node("p", "produceX", "j"),
+				node("q", "produceY", "j"),
+				join(node("j", "needXY"), JoinAny),
+			},
+			expect: []string{
+				"node j: required input x is not produced on every path",
+				"node j: required input y is not produced on every path",
+			},
+		},
+		{
+			name: "loop back edge keeps upstream output",
+			nodes: []NodeConfig{
+				node("s", "produceX", "l"),
+				loop(node("l", "needX", "m")),
+				node("m", "produceY", "l"),
+			},
+		},
+		{
+			name: "loop back edge only",
+			nodes: []NodeConfig{
+				node("s", "none", "l"),
+				loop(node("l", "needX", "m")),
+				node("m", "produceX", "l"),
+			},
+			expect: []string{"node l: required input x is not produced on every path"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := executor.Validate(DAGConfig{StartNode: test.nodes[0].Name, Nodes: test.nodes})
+			if len(test.expect) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var validateErr *DAGValidateError
+			if !errors.As(err, &validateErr) {
+				t.Fatalf("expect DAGValidateError but got %v", err)
+			}
+			if strings.Join(validateErr.Problems, "\n") != strings.Join(test.expect, "\n") {
+				t.Fatalf("expect %v but got %v", test.expect, validateErr.Problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package zengine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/LeeZXin/zsf-utils/luautil"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BindingsDiff bindings变化
+type BindingsDiff struct {
+	Added   map[string]any `json:"added,omitempty"`
+	Changed map[string]any `json:"changed,omitempty"`
+	Removed []string       `json:"removed,omitempty"`
+}
+
+// IsEmpty 是否无变化
+func (d *BindingsDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0 && len(d.Removed) == 0
+}
+
+// DiffBindings 计算after相对before的变化
+func DiffBindings(before, after luautil.Bindings) *BindingsDiff {
+	ret := &BindingsDiff{
+		Added:   make(map[string]any),
+		Changed: make(map[string]any),
+		Removed: make([]string, 0),
+	}
+	for k, v := range after {
+		old, ok := before[k]
+		if !ok {
+			ret.Added[k] = v
+		} else if !reflect.DeepEqual(old, v) {
+			ret.Changed[k] = v
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			ret.Removed = append(ret.Removed, k)
+		}
+	}
+	sort.Strings(ret.Removed)
+	return ret
+}
+
+// EdgeTrace 边条件执行记录
+type EdgeTrace struct {
+	ConditionExpr string `json:"conditionExpr"`
+	NextNode      string `json:"nextNode"`
+	Result        bool   `json:"result"`
+	Err           string `json:"err,omitempty"`
+}
+
+// NodeTrace 单个节点执行记录
+type NodeTrace struct {
+	Node     string        `json:"node"`
+	Handler  string        `json:"handler"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"duration"`
+	// Input 执行前的全局bindings
+	Input luautil.Bindings `json:"input"`
+	// Diff 执行后全局bindings的变化
+	Diff  *BindingsDiff `json:"diff"`
+	Edges []EdgeTrace   `json:"edges"`
+	Err   string        `json:"err,omitempty"`
+}
+
+func (t *NodeTrace) end(bindings luautil.Bindings, err error) {
+	if t == nil {
+		return
+	}
+	t.End = time.Now()
+	t.Duration = t.End.Sub(t.Start)
+	t.Diff = DiffBindings(t.Input, bindings)
+	if err != nil {
+		t.Err = err.Error()
+	}
+}
+
+func (t *NodeTrace) addEdge(next Next, result bool, err error) {
+	if t == nil {
+		return
+	}
+	edge := EdgeTrace{
+		ConditionExpr: next.ConditionExpr,
+		NextNode:      next.NextNode,
+		Result:        result,
+	}
+	if err != nil {
+		edge.Err = err.Error()
+	}
+	t.Edges = append(t.Edges, edge)
+}
+
+// Tracer 单次执行的追踪记录 可序列化为json
+type Tracer struct {
+	mu    sync.Mutex
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Input 开始执行时的全局bindings
+	Input luautil.Bindings `json:"input"`
+	// Output 结束时的全局bindings
+	Output luautil.Bindings `json:"output"`
+	Err    string           `json:"err,omitempty"`
+	Nodes  []*NodeTrace     `json:"nodes"`
+}
+
+func NewTracer() *Tracer {
+	return &Tracer{
+		Nodes: make([]*NodeTrace, 0),
+	}
+}
+
+// ParseTracer 从json解析追踪记录
+func ParseTracer(content []byte) (*Tracer, error) {
+	ret := NewTracer()
+	err := json.Unmarshal(content, ret)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Json 序列化追踪记录
+func (t *Tracer) Json() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return json.Marshal(t)
+}
+
+// ExecutedNodes 按执行顺序返回执行过的节点名称
+func (t *Tracer) ExecutedNodes() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ret := make([]string, 0, len(t.Nodes))
+	for _, node := range t.Nodes {
+		ret = append(ret, node.Node)
+	}
+	return ret
+}
+
+func (t *Tracer) begin(bindings luautil.Bindings) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Start = time.Now()
+	t.Input = copyBindings(bindings)
+}
+
+func (t *Tracer) finish(bindings luautil.Bindings, err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.End = time.Now()
+	t.Output = copyBindings(bindings)
+	if err != nil {
+		t.Err = err.Error()
+	}
+}
+
+func (t *Tracer) beginNode(node *Node, bindings luautil.Bindings) *NodeTrace {
+	if t == nil {
+		return nil
+	}
+	ret := &NodeTrace{
+		Node:    node.Name,
+		Handler: node.Params.HandlerConfig.Name,
+		Start:   time.Now(),
+		Input:   copyBindings(bindings),
+		Edges:   make([]EdgeTrace, 0, len(node.Next)),
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Nodes = append(t.Nodes, ret)
+	return ret
+}
+
+// ReplayResult 回放结果
+type ReplayResult struct {
+	// Tracer 新版本的执行记录
+	Tracer *Tracer `json:"tracer"`
+	// OutputDiff 新版本输出相对记录输出的变化
+	OutputDiff *BindingsDiff `json:"outputDiff"`
+	// ErrChanged 执行错误是否变化
+	ErrChanged bool `json:"errChanged"`
+	// AddedNodes 新版本多执行的节点
+	AddedNodes []string `json:"addedNodes"`
+	// RemovedNodes 新版本未执行的节点
+	RemovedNodes []string `json:"removedNodes"`
+}
+
+// IsSame 新旧版本执行结果是否一致
+func (r *ReplayResult) IsSame() bool {
+	return r.OutputDiff.IsEmpty() && !r.ErrChanged && len(r.AddedNodes) == 0 && len(r.RemovedNodes) == 0
+}
+
+// Replay 用记录的输入在新版本有向图上重新执行 并对比输出
+func (d *DAGExecutor) Replay(ctx context.Context, dag *DAG, recorded *Tracer) (*ReplayResult, error) {
+	if recorded == nil {
+		return nil, errors.New("nil tracer")
+	}
+	ectx := d.NewExecContext(ctx)
+	ectx.globalBindings.PutAll(copyBindings(recorded.Input))
+	tracer := NewTracer()
+	ectx.SetTracer(tracer)
+	err := d.Execute(dag, ectx)
+	var errStr string
+	if err != nil {
+		errStr = err.Error()
+	}
+	return &ReplayResult{
+		Tracer:       tracer,
+		OutputDiff:   DiffBindings(normaliseBindings(recorded.Output), normaliseBindings(tracer.Output)),
+		ErrChanged:   errStr != recorded.Err,
+		AddedNodes:   diffNodes(tracer.ExecutedNodes(), recorded.ExecutedNodes()),
+		RemovedNodes: diffNodes(recorded.ExecutedNodes(), tracer.ExecutedNodes()),
+	}, nil
+}
+
+// normaliseBindings 经过json序列化统一数字等类型 便于和json解析出的记录对比
+func normaliseBindings(b luautil.Bindings) luautil.Bindings {
+	content, err := json.Marshal(b)
+	if err != nil {
+		return b
+	}
+	ret := luautil.NewBindings()
+	if err = json.Unmarshal(content, &ret); err != nil {
+		return b
+	}
+	return ret
+}
+
+// diffNodes 在nodes1中但不在nodes2中的节点
+func diffNodes(nodes1, nodes2 []string) []string {
+	set := make(map[string]struct{}, len(nodes2))
+	for _, node := range nodes2 {
+		set[node] = struct{}{}
+	}
+	ret := make([]string, 0)
+	seen := make(map[string]struct{}, len(nodes1))
+	for _, node := range nodes1 {
+		if _, ok := set[node]; ok {
+			continue
+		}
+		if _, ok := seen[node]; ok {
+			continue
+		}
+		seen[node] = struct{}{}
+		ret = append(ret, node)
+	}
+	return ret
+}
@@ -0,0 +1,106 @@
+package zengine
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/LeeZXin/zsf-utils/luautil"
+)
+
+// echoHandler 输出节点名称到amount的映射 结果只由输入决定
+var echoHandler = &funcHandler{
+	name: "echo",
+	fn: func(params *InputParams, bindings luautil.Bindings, _ *ExecContext) (luautil.Bindings, error) {
+		name, _ := params.HandlerConfig.Args.GetString("node")
+		amount, _ := bindings.Get("amount")
+		return luautil.Bindings{name: amount}, nil
+	},
+}
+
+func echoNode(name string, next ...NextConfig) NodeConfig {
+	return NodeConfig{
+		Name:    name,
+		Handler: HandlerConfig{Name: "echo", Args: luautil.Bindings{"node": name}},
+		Next:    next,
+	}
+}
+
+func TestTraceReplay(t *testing.T) {
+	executor := NewDAGExecutorWithOpts(DAGExecutorOpts{
+		Handlers:      []Handler{echoHandler},
+		ConditionLang: ExprConditionLang,
+	})
+	defer executor.Close()
+	config := DAGConfig{
+		StartNode: "a",
+		Nodes: []NodeConfig{
+			echoNode("a",
+				NextConfig{ConditionExpr: "amount > 100", NextNode: "big"},
+				NextConfig{ConditionExpr: "amount <= 100", NextNode: "b"},
+			),
+			echoNode("b"),
+			echoNode("big"),
+		},
+	}
+	dag, err := executor.BuildDAG(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ectx := executor.NewExecContext(context.Background())
+	ectx.GlobalBindings()["amount"] = 10
+	tracer := NewTracer()
+	ectx.SetTracer(tracer)
+	if err = executor.Execute(dag, ectx); err != nil {
+		t.Fatal(err)
+	}
+	if nodes := tracer.ExecutedNodes(); !reflect.DeepEqual(nodes, []string{"a", "b"}) {
+		t.Fatalf("unexpected nodes %v", nodes)
+	}
+	first := tracer.Nodes[0]
+	if first.Diff.Added["a"] != 10 || len(first.Edges) != 2 || first.Edges[0].Result || !first.Edges[1].Result {
+		t.Fatalf("unexpected node trace %+v", first)
+	}
+	if tracer.Output["b"] != 10 {
+		t.Fatalf("unexpected output %v", tracer.Output)
+	}
+	content, err := tracer.Json()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := ParseTracer(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(recorded.ExecutedNodes(), []string{"a", "b"}) {
+		t.Fatalf("unexpected parsed nodes %v", recorded.ExecutedNodes())
+	}
+	// 同一版本回放结果一致
+	result, err := executor.Replay(context.Background(), dag, recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsSame() {
+		t.Fatalf("expect same but got %+v", result)
+	}
+	// 新版本b之后多执行c
+	config.Nodes[1] = echoNode("b", NextConfig{ConditionExpr: "true", NextNode: "c"})
+	config.Nodes = append(config.Nodes, echoNode("c"))
+	newDag, err := executor.BuildDAG(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = executor.Replay(context.Background(), newDag, recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsSame() || !reflect.DeepEqual(result.AddedNodes, []string{"c"}) || len(result.RemovedNodes) != 0 {
+		t.Fatalf("unexpected replay result %+v", result)
+	}
+	if _, ok := result.OutputDiff.Added["c"]; !ok {
+		t.Fatalf("expect c added in output but got %+v", result.OutputDiff)
+	}
+	if !reflect.DeepEqual(result.Tracer.ExecutedNodes(), []string{"a", "b", "c"}) {
+		t.Fatalf("unexpected replay nodes %v", result.Tracer.ExecutedNodes())
+	}
+}
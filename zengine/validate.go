@@ -0,0 +1,207 @@
+package zengine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DAGValidateError 有向图配置校验错误 包含全部问题
+type DAGValidateError struct {
+	Problems []string
+}
+
+func (e *DAGValidateError) Error() string {
+	return "invalid dag config: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate 校验有向图配置 不编译条件表达式
+func (d *DAGExecutor) Validate(config DAGConfig) error {
+	problems := d.validateConfig(config)
+	if len(problems) > 0 {
+		return &DAGValidateError{Problems: problems}
+	}
+	return nil
+}
+
+// validateConfig 校验开始节点、重复节点、未知handler、悬空的边、不可达节点和环
+func (d *DAGExecutor) validateConfig(config DAGConfig) []string {
+	problems := make([]string, 0)
+	if _, ok := d.conditionCompiler(config); !ok {
+		problems = append(problems, "unknown condition lang: "+config.ConditionLang)
+	}
+	if config.Timeout < 0 {
+		problems = append(problems, "timeout should not less than 0")
+	}
+	nodes := make(map[string]NodeConfig, len(config.Nodes))
+	for _, node := range config.Nodes {
+		if node.Name == "" {
+			problems = append(problems, "node with empty name")
+			continue
+		}
+		if _, ok := nodes[node.Name]; ok {
+			problems = append(problems, fmt.Sprintf("node %s: duplicate name", node.Name))
+			continue
+		}
+		nodes[node.Name] = node
+		if !d.handlerMap.Contains(node.Handler.Name) {
+			problems = append(problems, fmt.Sprintf("node %s: unknown handler %s", node.Name, node.Handler.Name))
+		}
+		switch node.Join {
+		case "", JoinAll, JoinAny:
+		default:
+			problems = append(problems, fmt.Sprintf("node %s: unknown join %s", node.Name, node.Join))
+		}
+		switch node.MergeStrategy {
+		case "", OverrideMerge, KeepFirstMerge, ConflictMerge:
+		default:
+			problems = append(problems, fmt.Sprintf("node %s: unknown merge strategy %s", node.Name, node.MergeStrategy))
+		}
+		if node.MaxIterations < 0 {
+			problems = append(problems, fmt.Sprintf("node %s: maxIterations should not less than 0", node.Name))
+		}
+		if node.Retry < 0 || node.RetryDelay < 0 || node.Timeout < 0 {
+			problems = append(problems, fmt.Sprintf("node %s: retry, retryDelay and timeout should not less than 0", node.Name))
+		}
+		switch node.OnError {
+		case "", FailOnError, SkipOnError:
+		case GotoOnError:
+			if node.Fallback == "" {
+				problems = append(problems, fmt.Sprintf("node %s: empty fallback node", node.Name))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("node %s: unknown onError %s", node.Name, node.OnError))
+		}
+	}
+	for _, node := range config.Nodes {
+		for _, next := range node.Next {
+			if _, ok := nodes[next.NextNode]; !ok {
+				problems = append(problems, fmt.Sprintf("node %s: unknown next node %s", node.Name, next.NextNode))
+			}
+		}
+		if node.OnError == GotoOnError && node.Fallback != "" {
+			if _, ok := nodes[node.Fallback]; !ok {
+				problems = append(problems, fmt.Sprintf("node %s: unknown fallback node %s", node.Name, node.Fallback))
+			}
+		}
+	}
+	if config.StartNode == "" {
+		problems = append(problems, "empty start node")
+	} else if _, ok := nodes[config.StartNode]; !ok {
+		problems = append(problems, "unknown start node: "+config.StartNode)
+	} else {
+		reachable := reachableNodes(config.StartNode, nodes)
+		for _, node := range config.Nodes {
+			if _, ok := reachable[node.Name]; !ok && node.Name != "" {
+				problems = append(problems, fmt.Sprintf("node %s: unreachable from start node", node.Name))
+			}
+		}
+	}
+	for _, cycle := range findCycles(config.Nodes, nodes) {
+		hasLoopNode := false
+		for _, name := range cycle {
+			if nodes[name].MaxIterations > 0 {
+				hasLoopNode = true
+				break
+			}
+		}
+		if !hasLoopNode {
+			problems = append(problems, "cycle without loop node: "+strings.Join(cycle, ", "))
+		}
+	}
+	return append(problems, d.checkSchemas(config)...)
+}
+
+func reachableNodes(start string, nodes map[string]NodeConfig) map[string]struct{} {
+	ret := map[string]struct{}{start: {}}
+	stack := []string{start}
+	for len(stack) > 0 {
+		name := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, next := range successors(nodes[name]) {
+			if _, ok := nodes[next]; !ok {
+				continue
+			}
+			if _, ok := ret[next]; !ok {
+				ret[next] = struct{}{}
+				stack = append(stack, next)
+			}
+		}
+	}
+	return ret
+}
+
+// successors 节点可能跳转的下一节点 包含失败跳转节点
+func successors(node NodeConfig) []string {
+	ret := make([]string, 0, len(node.Next)+1)
+	for _, next := range node.Next {
+		ret = append(ret, next.NextNode)
+	}
+	if node.OnError == GotoOnError && node.Fallback != "" {
+		ret = append(ret, node.Fallback)
+	}
+	return ret
+}
+
+// findCycles tarjan强连通分量 返回每个环包含的节点
+func findCycles(configs []NodeConfig, nodes map[string]NodeConfig) [][]string {
+	var (
+		index   = 0
+		indexes = make(map[string]int, len(nodes))
+		lowLink = make(map[string]int, len(nodes))
+		onStack = make(map[string]bool, len(nodes))
+		stack   = make([]string, 0, len(nodes))
+		ret     = make([][]string, 0)
+		connect func(string)
+	)
+	connect = func(name string) {
+		indexes[name] = index
+		lowLink[name] = index
+		index++
+		stack = append(stack, name)
+		onStack[name] = true
+		selfLoop := false
+		for _, next := range successors(nodes[name]) {
+			if _, ok := nodes[next]; !ok {
+				continue
+			}
+			if next == name {
+				selfLoop = true
+			}
+			if _, ok := indexes[next]; !ok {
+				connect(next)
+				if lowLink[next] < lowLink[name] {
+					lowLink[name] = lowLink[next]
+				}
+			} else if onStack[next] && indexes[next] < lowLink[name] {
+				lowLink[name] = indexes[next]
+			}
+		}
+		if lowLink[name] != indexes[name] {
+			return
+		}
+		component := make([]string, 0)
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == name {
+				break
+			}
+		}
+		if len(component) > 1 || selfLoop {
+			sort.Strings(component)
+			ret = append(ret, component)
+		}
+	}
+	for _, node := range configs {
+		if _, ok := nodes[node.Name]; !ok {
+			continue
+		}
+		if _, ok := indexes[node.Name]; !ok {
+			connect(node.Name)
+		}
+	}
+	return ret
+}
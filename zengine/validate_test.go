@@ -0,0 +1,114 @@
+package zengine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	c := &counter{counts: map[string]int{}}
+	executor := NewDAGExecutorWithOpts(DAGExecutorOpts{
+		Handlers:      []Handler{c.handler()},
+		ConditionLang: ExprConditionLang,
+	})
+	defer executor.Close()
+	next := func(name string) NextConfig {
+		return NextConfig{ConditionExpr: "true", NextNode: name}
+	}
+	loop := countNode("b", next("a"))
+	loop.MaxIterations = 3
+	tests := []struct {
+		name   string
+		config DAGConfig
+		// expect 为空表示校验通过
+		expect []string
+	}{
+		{
+			name:   "valid",
+			config: DAGConfig{StartNode: "a", Nodes: []NodeConfig{countNode("a", next("b")), countNode("b")}},
+		},
+		{
+			name:   "unreachable node",
+			config: DAGConfig{StartNode: "a", Nodes: []NodeConfig{countNode("a"), countNode("b")}},
+			expect: []string{"node b: unreachable from start node"},
+		},
+		{
+			name:   "dangling edge",
+			config: DAGConfig{StartNode: "a", Nodes: []NodeConfig{countNode("a", next("missing"))}},
+			expect: []string{"node a: unknown next node missing"},
+		},
+		{
+			name: "unknown handler",
+			config: DAGConfig{StartNode: "a", Nodes: []NodeConfig{
+				{Name: "a", Handler: HandlerConfig{Name: "missing"}},
+			}},
+			expect: []string{"node a: unknown handler missing"},
+		},
+		{
+			name:   "cycle without loop node",
+			config: DAGConfig{StartNode: "a", Nodes: []NodeConfig{countNode("a", next("b")), countNode("b", next("a"))}},
+			expect: []string{"cycle without loop node: a, b"},
+		},
+		{
+			name:   "self loop",
+			config: DAGConfig{StartNode: "a", Nodes: []NodeConfig{countNode("a", next("a"))}},
+			expect: []string{"cycle without loop node: a"},
+		},
+		{
+			name:   "cycle with loop node",
+			config: DAGConfig{StartNode: "a", Nodes: []NodeConfig{countNode("a", next("b")), loop}},
+		},
+		{
+			name:   "unknown start node",
+			config: DAGConfig{StartNode: "missing", Nodes: []NodeConfig{countNode("a")}},
+			expect: []string{"unknown start node: missing"},
+		},
+		{
+			name: "goto without fallback",
+			config: DAGConfig{StartNode: "a", Nodes: []NodeConfig{
+				{Name: "a", Handler: HandlerConfig{Name: "count"}, OnError: GotoOnError},
+			}},
+			expect: []string{"node a: empty fallback node"},
+		},
+		{
+			name: "multiple problems",
+			config: DAGConfig{StartNode: "a", Nodes: []NodeConfig{
+				countNode("a", next("missing")),
+				countNode("a"),
+				countNode("c"),
+			}},
+			expect: []string{"node a: duplicate name", "node a: unknown next node missing", "node c: unreachable from start node"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := executor.Validate(test.config)
+			if len(test.expect) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var validateErr *DAGValidateError
+			if !errors.As(err, &validateErr) {
+				t.Fatalf("expect DAGValidateError but got %v", err)
+			}
+			if len(validateErr.Problems) != len(test.expect) {
+				t.Fatalf("expect %v but got %v", test.expect, validateErr.Problems)
+			}
+			for _, expect := range test.expect {
+				found := false
+				for _, problem := range validateErr.Problems {
+					if strings.Contains(problem, expect) {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Fatalf("expect problem %q in %v", expect, validateErr.Problems)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package zengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zsf-utils/idutil"
+	"github.com/LeeZXin/zsf-utils/luautil"
+	"time"
+)
+
+const (
+	// RunningStatus 执行中
+	RunningStatus = "running"
+	// SuspendedStatus 挂起 等待Resume
+	SuspendedStatus = "suspended"
+	// FinishedStatus 执行完成
+	FinishedStatus = "finished"
+	// FailedStatus 执行失败
+	FailedStatus = "failed"
+)
+
+// TimerSignal 定时器到期的信号名称
+const TimerSignal = "timer"
+
+// SignalBindingKey Resume时信号写入全局bindings的key 值为map 包含name、payload
+const SignalBindingKey = "signal"
+
+var (
+	RunNotFoundError     = errors.New("run not found")
+	RunNotSuspendedError = errors.New("run is not suspended")
+	// RunConflictError 同一次执行被并发Resume
+	RunConflictError = errors.New("run state conflict")
+)
+
+// SuspendError handler返回此错误使节点挂起 等待信号或定时器
+type SuspendError struct {
+	// Signal 等待的信号名称
+	Signal string
+	// WakeAt 定时器到期时间 Signal为TimerSignal时有效
+	WakeAt time.Time
+}
+
+func (e *SuspendError) Error() string {
+	if e.Signal == TimerSignal {
+		return "suspend until " + e.WakeAt.Format(time.RFC3339)
+	}
+	return "suspend for signal " + e.Signal
+}
+
+// NewSignalSuspendError 等待信号挂起
+func NewSignalSuspendError(signal string) *SuspendError {
+	return &SuspendError{
+		Signal: signal,
+	}
+}
+
+// NewTimerSuspendError 等待定时器到期挂起
+func NewTimerSuspendError(d time.Duration) *SuspendError {
+	return &SuspendError{
+		Signal: TimerSignal,
+		WakeAt: time.Now().Add(d),
+	}
+}
+
+func isSuspendError(err error) bool {
+	var suspendErr *SuspendError
+	return errors.As(err, &suspendErr)
+}
+
+// Signal 外部信号
+type Signal struct {
+	Name    string           `json:"name"`
+	Payload luautil.Bindings `json:"payload"`
+}
+
+// SuspendedNode 挂起的节点
+type SuspendedNode struct {
+	Node   string    `json:"node"`
+	Signal string    `json:"signal"`
+	WakeAt time.Time `json:"wakeAt"`
+	// Times 挂起时的执行深度
+	Times int `json:"times"`
+}
+
+type suspendList struct {
+	nodes []SuspendedNode
+}
+
+// suspend 记录挂起节点 当前路径停止 其他路径继续执行
+func (e *ExecContext) suspend(node *Node, err *SuspendError, times int) error {
+	// 并行分支合并bindings后无法恢复 不支持挂起
+	if e.suspends == nil {
+		return fmt.Errorf("node %s: suspend is only supported in sequential workflow runs", node.Name)
+	}
+	e.suspends.nodes = append(e.suspends.nodes, SuspendedNode{
+		Node:   node.Name,
+		Signal: err.Signal,
+		WakeAt: err.WakeAt,
+		Times:  times,
+	})
+	return nil
+}
+
+// RunState 工作流单次执行的持久化状态
+type RunState struct {
+	RunId    string `json:"runId"`
+	Workflow string `json:"workflow"`
+	Status   string `json:"status"`
+	// Bindings 全局bindings
+	Bindings luautil.Bindings `json:"bindings"`
+	// Suspended 当前挂起的节点
+	Suspended []SuspendedNode `json:"suspended"`
+	// Loops 循环节点已执行次数
+	Loops map[string]int `json:"loops"`
+	// Arrived 已到达的join节点
+	Arrived []string `json:"arrived"`
+	// PendingJoins 等待全部路径完成后执行的all类型join节点
+	PendingJoins []string `json:"pendingJoins"`
+	Err          string   `json:"err,omitempty"`
+	// Version 乐观锁版本号 由store维护
+	Version int64     `json:"version"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// Workflow 可挂起恢复的有向图执行
+type Workflow struct {
+	name     string
+	executor *DAGExecutor
+	dag      *DAG
+	store    RunStore
+	// newTracer 每次Start和Resume创建追踪 为nil不记录
+	newTracer func(runId string) *Tracer
+}
+
+func NewWorkflow(name string, executor *DAGExecutor, dag *DAG, store RunStore) (*Workflow, error) {
+	if name == "" {
+		return nil, errors.New("empty name")
+	}
+	if executor == nil {
+		return nil, errors.New("nil executor")
+	}
+	if dag == nil {
+		return nil, errors.New("nil dag")
+	}
+	if store == nil {
+		return nil, errors.New("nil store")
+	}
+	return &Workflow{
+		name:     name,
+		executor: executor,
+		dag:      dag,
+		store:    store,
+	}, nil
+}
+
+// SetTracerFactory 设置每次Start和Resume使用的追踪
+func (w *Workflow) SetTracerFactory(newTracer func(runId string) *Tracer) {
+	w.newTracer = newTracer
+}
+
+// Start 开始一次执行 执行到结束或全部路径挂起后保存状态
+// 执行失败时状态为failed并返回错误
+func (w *Workflow) Start(ctx context.Context, bindings luautil.Bindings) (*RunState, error) {
+	now := time.Now()
+	state := &RunState{
+		RunId:    idutil.RandomUuid(),
+		Workflow: w.name,
+		Status:   RunningStatus,
+		Created:  now,
+		Updated:  now,
+	}
+	ectx := w.executor.NewExecContext(ctx)
+	ectx.GlobalBindings().PutAll(bindings)
+	ectx.suspends = &suspendList{}
+	w.setTracer(ectx, state.RunId)
+	err := w.executor.run(w.dag, ectx, func() error {
+		return w.drain(ectx, w.executor.findAndExecute(w.dag, w.dag.StartNode(), ectx, 0))
+	})
+	err = w.complete(state, ectx, err)
+	if insertErr := w.store.Insert(ctx, state); insertErr != nil {
+		return nil, insertErr
+	}
+	return state, err
+}
+
+// Resume 用信号恢复等待该信号的挂起节点 继续执行下一节点
+func (w *Workflow) Resume(ctx context.Context, runId string, signal Signal) (*RunState, error) {
+	state, b, err := w.store.Get(ctx, runId)
+	if err != nil {
+		return nil, err
+	}
+	if !b || state.Workflow != w.name {
+		return nil, RunNotFoundError
+	}
+	if state.Status != SuspendedStatus {
+		return nil, RunNotSuspendedError
+	}
+	now := time.Now()
+	matched := make([]SuspendedNode, 0, len(state.Suspended))
+	remaining := make([]SuspendedNode, 0, len(state.Suspended))
+	for _, s := range state.Suspended {
+		if s.Signal == signal.Name && (s.Signal != TimerSignal || !now.Before(s.WakeAt)) {
+			matched = append(matched, s)
+		} else {
+			remaining = append(remaining, s)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no node waiting for signal: %s", signal.Name)
+	}
+	// 先通过乐观锁抢占执行 避免并发Resume重复执行handler
+	state.Status = RunningStatus
+	state.Updated = now
+	b, err = w.store.Update(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	if !b {
+		return nil, RunConflictError
+	}
+	ectx := w.restore(ctx, state, remaining)
+	w.setTracer(ectx, runId)
+	ectx.GlobalBindings()[SignalBindingKey] = map[string]any{
+		"name":    signal.Name,
+		"payload": map[string]any(signal.Payload),
+	}
+	err = w.executor.run(w.dag, ectx, func() error {
+		for _, s := range matched {
+			node, ok := w.dag.GetNode(s.Node)
+			if !ok {
+				return errors.New("unknown node: " + s.Node)
+			}
+			if err := w.executor.executeNext(w.dag, node, ectx, nil, s.Times); err != nil {
+				return err
+			}
+		}
+		return w.drain(ectx, nil)
+	})
+	err = w.complete(state, ectx, err)
+	b, updateErr := w.store.Update(ctx, state)
+	if updateErr != nil {
+		return nil, updateErr
+	}
+	if !b {
+		return nil, RunConflictError
+	}
+	return state, err
+}
+
+// Wake 恢复定时器已到期的挂起节点
+func (w *Workflow) Wake(ctx context.Context, runId string) (*RunState, error) {
+	return w.Resume(ctx, runId, Signal{Name: TimerSignal})
+}
+
+// Get 获取执行状态
+func (w *Workflow) Get(ctx context.Context, runId string) (*RunState, bool, error) {
+	state, b, err := w.store.Get(ctx, runId)
+	if err != nil || !b || state.Workflow != w.name {
+		return nil, false, err
+	}
+	return state, true, nil
+}
+
+func (w *Workflow) setTracer(ectx *ExecContext, runId string) {
+	if w.newTracer != nil {
+		ectx.SetTracer(w.newTracer(runId))
+	}
+}
+
+// restore 从持久化状态恢复执行上下文
+func (w *Workflow) restore(ctx context.Context, state *RunState, remaining []SuspendedNode) *ExecContext {
+	ectx := w.executor.NewExecContext(ctx)
+	ectx.GlobalBindings().PutAll(state.Bindings)
+	ectx.suspends = &suspendList{
+		nodes: remaining,
+	}
+	for k, v := range state.Loops {
+		ectx.loops.counts[k] = v
+		ectx.loops.sum += v
+	}
+	for _, name := range state.Arrived {
+		node, ok := w.dag.GetNode(name)
+		if !ok {
+			continue
+		}
+		if node.Join == JoinAny {
+			ectx.scope.anyArrived[name] = anyArrival{
+				branch:     ectx,
+				iterations: ectx.loops.sum,
+			}
+		} else {
+			ectx.scope.arrived[name] = true
+		}
+	}
+	for _, name := range state.PendingJoins {
+		if node, ok := w.dag.GetNode(name); ok {
+			ectx.scope.pending = append(ectx.scope.pending, node)
+		}
+	}
+	return ectx
+}
+
+// drain 没有挂起节点时执行等待中的join节点
+func (w *Workflow) drain(ectx *ExecContext, err error) error {
+	if err == nil && len(ectx.suspends.nodes) == 0 {
+		err = w.executor.drainScope(w.dag, ectx.scope, ectx, 0)
+	}
+	return err
+}
+
+// complete 把上下文写回状态
+func (w *Workflow) complete(state *RunState, ectx *ExecContext, err error) error {
+	state.Bindings = ectx.GlobalBindings()
+	state.Suspended = ectx.suspends.nodes
+	state.Loops = ectx.loops.counts
+	state.Arrived = make([]string, 0, len(ectx.scope.arrived)+len(ectx.scope.anyArrived))
+	for name := range ectx.scope.arrived {
+		state.Arrived = append(state.Arrived, name)
+	}
+	for name := range ectx.scope.anyArrived {
+		state.Arrived = append(state.Arrived, name)
+	}
+	state.PendingJoins = make([]string, 0, len(ectx.scope.pending))
+	for _, node := range ectx.scope.pending {
+		state.PendingJoins = append(state.PendingJoins, node.Name)
+	}
+	state.Updated = time.Now()
+	switch {
+	case err != nil:
+		state.Status = FailedStatus
+		state.Err = err.Error()
+	case len(state.Suspended) > 0:
+		state.Status = SuspendedStatus
+	default:
+		state.Status = FinishedStatus
+	}
+	return err
+}
+
+// WaitSignalHandler 挂起等待args中signal指定的信号
+type WaitSignalHandler struct{}
+
+func (*WaitSignalHandler) GetName() string {
+	return "waitSignal"
+}
+
+func (*WaitSignalHandler) Do(params *InputParams, _ luautil.Bindings, _ *ExecContext) (luautil.Bindings, error) {
+	signal, ok := params.HandlerConfig.Args.GetString("signal")
+	if !ok || signal == "" {
+		return nil, errors.New("empty signal")
+	}
+	return nil, NewSignalSuspendError(signal)
+}
+
+// TimerHandler 挂起args中duration毫秒 到期后通过Wake恢复
+type TimerHandler struct{}
+
+func (*TimerHandler) GetName() string {
+	return "timer"
+}
+
+func (*TimerHandler) Do(params *InputParams, _ luautil.Bindings, _ *ExecContext) (luautil.Bindings, error) {
+	duration, ok := params.HandlerConfig.Args.GetInt("duration")
+	if !ok || duration < 0 {
+		return nil, errors.New("wrong duration")
+	}
+	return nil, NewTimerSuspendError(time.Duration(duration) * time.Millisecond)
+}
@@ -0,0 +1,194 @@
+package zengine
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LeeZXin/zsf-utils/luautil"
+	_ "github.com/mattn/go-sqlite3"
+	"xorm.io/xorm"
+)
+
+func newWorkflowExecutor(runTimeout time.Duration, handlers ...Handler) *DAGExecutor {
+	return NewDAGExecutorWithOpts(DAGExecutorOpts{
+		Handlers:      append(handlers, &WaitSignalHandler{}),
+		ConditionLang: ExprConditionLang,
+		RunTimeout:    runTimeout,
+	})
+}
+
+func TestWorkflowUsesExecutorEntry(t *testing.T) {
+	c := &counter{counts: map[string]int{}}
+	executor := newWorkflowExecutor(0, c.handler())
+	defer executor.Close()
+	dag, err := executor.BuildDAG(DAGConfig{
+		Name:      "wf",
+		StartNode: "wait",
+		Nodes: []NodeConfig{
+			{
+				Name:    "wait",
+				Handler: HandlerConfig{Name: "waitSignal", Args: luautil.Bindings{"signal": "approve"}},
+				Next:    []NextConfig{{ConditionExpr: "true", NextNode: "done"}},
+			},
+			countNode("done"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	workflow, err := NewWorkflow("wf", executor, dag, NewMemRunStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracers := make([]*Tracer, 0, 2)
+	workflow.SetTracerFactory(func(string) *Tracer {
+		tracer := NewTracer()
+		tracers = append(tracers, tracer)
+		return tracer
+	})
+	state, err := workflow.Start(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Status != SuspendedStatus {
+		t.Fatalf("expect suspended but got %s", state.Status)
+	}
+	state, err = workflow.Resume(context.Background(), state.RunId, Signal{Name: "approve"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Status != FinishedStatus || c.get("done") != 1 {
+		t.Fatalf("expect finished but got %s", state.Status)
+	}
+	if runs := executor.Stats()["wf"].Runs; runs != 2 {
+		t.Fatalf("expect 2 runs in stats but got %d", runs)
+	}
+	if len(tracers) != 2 || len(tracers[1].ExecutedNodes()) != 1 {
+		t.Fatalf("expect tracer for each run")
+	}
+}
+
+func TestWorkflowConcurrentResume(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls int32
+	block := &funcHandler{
+		name: "block",
+		fn: func(*InputParams, luautil.Bindings, *ExecContext) (luautil.Bindings, error) {
+			atomic.AddInt32(&calls, 1)
+			close(started)
+			<-release
+			return nil, nil
+		},
+	}
+	executor := newWorkflowExecutor(0, block)
+	defer executor.Close()
+	dag, err := executor.BuildDAG(DAGConfig{
+		StartNode: "wait",
+		Nodes: []NodeConfig{
+			{
+				Name:    "wait",
+				Handler: HandlerConfig{Name: "waitSignal", Args: luautil.Bindings{"signal": "approve"}},
+				Next:    []NextConfig{{ConditionExpr: "true", NextNode: "block"}},
+			},
+			{Name: "block", Handler: HandlerConfig{Name: "block"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	workflow, err := NewWorkflow("wf", executor, dag, NewMemRunStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := workflow.Start(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := workflow.Resume(context.Background(), state.RunId, Signal{Name: "approve"})
+		done <- err
+	}()
+	<-started
+	// 执行中的run已被抢占 不会重复执行handler
+	if _, err = workflow.Resume(context.Background(), state.RunId, Signal{Name: "approve"}); !errors.Is(err, RunNotSuspendedError) {
+		t.Fatalf("expect not suspended but got %v", err)
+	}
+	close(release)
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	state, _, err = workflow.Get(context.Background(), state.RunId)
+	if err != nil || state.Status != FinishedStatus || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("expect finished once but got %v %d", err, calls)
+	}
+}
+
+func TestWorkflowRunTimeout(t *testing.T) {
+	slow := &funcHandler{
+		name: "slow",
+		fn: func(_ *InputParams, _ luautil.Bindings, ectx *ExecContext) (luautil.Bindings, error) {
+			<-ectx.Context().Done()
+			return nil, ectx.Context().Err()
+		},
+	}
+	executor := newWorkflowExecutor(20*time.Millisecond, slow)
+	defer executor.Close()
+	dag, err := executor.BuildDAG(DAGConfig{
+		StartNode: "slow",
+		Nodes:     []NodeConfig{{Name: "slow", Handler: HandlerConfig{Name: "slow"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	workflow, err := NewWorkflow("wf", executor, dag, NewMemRunStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := workflow.Start(context.Background(), nil)
+	if !errors.Is(err, RunTimeoutError) {
+		t.Fatalf("expect run timeout but got %v", err)
+	}
+	if state.Status != FailedStatus {
+		t.Fatalf("expect failed but got %s", state.Status)
+	}
+}
+
+func TestDbRunStore(t *testing.T) {
+	engine, err := xorm.NewEngine("sqlite3", filepath.Join(t.TempDir(), "run.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	if err = CreateDbRunTable(engine, "run"); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewDbRunStore("run", engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	state := &RunState{RunId: "r1", Workflow: "wf", Status: RunningStatus}
+	if err = store.Insert(ctx, state); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Insert(ctx, state); err == nil {
+		t.Fatal("expect duplicate run id error")
+	}
+	got, b, err := store.Get(ctx, "r1")
+	if err != nil || !b {
+		t.Fatal("run not found", err)
+	}
+	got.Status = FinishedStatus
+	if b, err = store.Update(ctx, got); err != nil || !b {
+		t.Fatal("update failed", err)
+	}
+	// 旧版本更新失败
+	if b, err = store.Update(ctx, state); err != nil || b {
+		t.Fatal("expect version conflict", err)
+	}
+}